@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Chocapikk/pgread/pgdump"
 )
@@ -20,30 +26,49 @@ func main() {
 		listOnly, verbose, showVersion             bool
 		detectPaths, listDBs, debug                bool
 		sqlOutput, csvOutput, tableOutput           bool
+		copyOutput                                 bool
 		searchPattern, passwords, secrets          string
-		showDeleted, showWAL                       bool
+		showDeleted, showWAL, showHistory          bool
+		carveRows, showOrphans, droppedTables      bool
+		systemColumns                              bool
 		showControl, verifyChecksums               bool
 		parseIndex, showDropped                    bool
 		showSequences, showRelmap, blockRange      string
 		binaryDump, skipOldValues, toastVerbose    bool
+		inspectPage, showMaps                      bool
 		segmentNumber, segmentSize                 int
 		outputEncoding, outputFile                 string
+		schemaFilter, excludeSchema                string
+		tablespaceMap, outputFormat                string
+		timeZone, asOfTime                         string
+		asOfXID                                    uint
+		compressLevel, workers                     int
 	)
 
 	flag.StringVar(&dataDir, "d", "", "PostgreSQL data directory (auto-detected if not set)")
 	flag.StringVar(&singleFile, "f", "", "Single heap file to parse")
 	flag.StringVar(&dbFilter, "db", "", "Filter by database name")
 	flag.StringVar(&tableFilter, "t", "", "Filter tables containing string")
+	flag.StringVar(&schemaFilter, "schema", "", "Only dump tables in this schema (with -f: column types of a heap file, e.g. \"int4,text,timestamptz\")")
+	flag.StringVar(&excludeSchema, "exclude-schema", "", "Skip tables in this schema")
 	flag.BoolVar(&listOnly, "list", false, "List schema only, no data")
 	flag.BoolVar(&listDBs, "list-db", false, "List databases only")
 	flag.BoolVar(&detectPaths, "detect", false, "Show detected PostgreSQL paths")
 	flag.BoolVar(&sqlOutput, "sql", false, "Output as SQL statements")
 	flag.BoolVar(&csvOutput, "csv", false, "Output as CSV")
+	flag.BoolVar(&copyOutput, "copy", false, "Output as SQL with COPY data blocks (fast psql reload)")
 	flag.BoolVar(&tableOutput, "table", false, "Output as formatted table (psql-style)")
+	flag.StringVar(&outputFormat, "format", "", "Output format: json, sql, copy, csv, table, or custom (pg_restore archive, one database)")
+	flag.IntVar(&compressLevel, "compress", 0, "zlib compression level for -format custom (0-9)")
 	flag.StringVar(&searchPattern, "search", "", "Search for pattern in all tables (regex)")
 	flag.StringVar(&passwords, "passwords", "", "Extract password hashes (use 'all' or specify user)")
 	flag.StringVar(&secrets, "secrets", "", "Search for secrets/credentials (use 'auto' for common patterns)")
 	flag.BoolVar(&showDeleted, "deleted", false, "Include deleted (non-vacuumed) rows")
+	flag.BoolVar(&systemColumns, "system-columns", false, "Add ctid, xmin, xmax, cmin, cmax and infomask flags to every row")
+	flag.BoolVar(&showHistory, "history", false, "Show updated rows with every version still on disk and the columns each UPDATE changed")
+	flag.BoolVar(&carveRows, "carve", false, "Recover rows from tuple remnants in the free space of heap pages, after VACUUM")
+	flag.BoolVar(&showOrphans, "orphans", false, "List relation files no pg_class entry references and dump them with the schema they last had")
+	flag.BoolVar(&droppedTables, "dropped-tables", false, "Rebuild dropped tables from dead pg_class/pg_attribute tuples and dump their data files if still on disk")
 	flag.BoolVar(&showWAL, "wal", false, "Show WAL (Write-Ahead Log) summary")
 	flag.BoolVar(&showControl, "control", false, "Show pg_control file information")
 	flag.BoolVar(&verifyChecksums, "checksum", false, "Verify page checksums")
@@ -53,12 +78,19 @@ func main() {
 	flag.StringVar(&showRelmap, "relmap", "", "Show pg_filenode.map ('global', 'all', or db OID)")
 	flag.StringVar(&blockRange, "R", "", "Block range to read (e.g., '0:10', '5:', ':20', '5')")
 	flag.BoolVar(&binaryDump, "b", false, "Binary block dump (hex output)")
+	flag.BoolVar(&inspectPage, "inspect", false, "Show page headers and line pointers like pageinspect's page_header and heap_page_items (use with -f)")
+	flag.BoolVar(&showMaps, "maps", false, "Show each block's visibility map bits and free space map entry (use with -f on a heap file)")
 	flag.BoolVar(&skipOldValues, "o", false, "Skip old/dead tuple values")
 	flag.BoolVar(&toastVerbose, "toast-verbose", false, "Verbose TOAST information")
 	flag.IntVar(&segmentNumber, "n", 0, "Force segment number (for multi-segment files)")
 	flag.IntVar(&segmentSize, "s", 0, "Force segment size in bytes (default: 1GB)")
 	flag.StringVar(&outputEncoding, "encoding", "", "Output encoding (default: UTF-8). Supported: UTF-8, GBK, GB18030, BIG5, SJIS, EUC-JP, EUC-KR, LATIN1-5, WIN1250-1258, KOI8-R, KOI8-U, ISO-8859-5/6/7/8")
+	flag.UintVar(&asOfXID, "as-of-xid", 0, "Dump tables as transaction XID saw them at its start (deleted rows not yet vacuumed come back)")
+	flag.StringVar(&asOfTime, "as-of", "", "Dump tables as of a commit time, e.g. '2024-05-01 13:00:00' in the -tz zone (needs track_commit_timestamp)")
+	flag.StringVar(&timeZone, "tz", "", "Time zone for timestamptz values (default: UTC), e.g. 'Europe/Paris'")
+	flag.StringVar(&tablespaceMap, "tablespace-map", "", "Relocate tablespaces for copied data dirs (e.g. '16400=/evidence/ts1,16401=/mnt/ts2')")
 	flag.StringVar(&outputFile, "output", "", "Write output to file instead of stdout")
+	flag.IntVar(&workers, "j", runtime.NumCPU(), "Tables decoded in parallel (1 = sequential)")
 	flag.BoolVar(&verbose, "v", false, "Verbose output")
 	flag.BoolVar(&debug, "debug", false, "Debug tuple decoding")
 	flag.BoolVar(&showVersion, "version", false, "Show version")
@@ -68,6 +100,45 @@ func main() {
 	pgdump.Debug = debug
 	pgdump.DebugTable = tableFilter
 
+	switch outputFormat {
+	case "", "json", "custom":
+	case "sql":
+		sqlOutput = true
+	case "copy":
+		copyOutput = true
+	case "csv":
+		csvOutput = true
+	case "table":
+		tableOutput = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q (json, sql, copy, csv, table, custom)\n", outputFormat)
+		os.Exit(1)
+	}
+
+	spcMap, err := pgdump.ParseTablespaceMap(tablespaceMap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var loc *time.Location
+	if timeZone != "" {
+		if loc, err = time.LoadLocation(timeZone); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: unknown time zone %q\n", timeZone)
+			os.Exit(1)
+		}
+	}
+	var asOf time.Time
+	if asOfTime != "" {
+		if asOf, err = parseAsOfTime(asOfTime, loc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Ctrl-C stops decoding promptly, keeping the output written so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	if showVersion {
 		fmt.Printf("pgdump-offline %s\n", pgdump.Version)
 		return
@@ -101,8 +172,20 @@ func main() {
 			}
 		}
 		
+		// With -f, -schema lists column types rather than naming a schema
+		if schemaFilter != "" {
+			if _, err := pgdump.ParseColumnTypes(schemaFilter); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: -schema with -f takes the column types of a heap file, e.g. \"int4,text\": %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		if binaryDump {
 			parseBinaryDump(singleFile, blockRange)
+		} else if inspectPage {
+			inspectPages(singleFile, blockRange, tableOutput)
+		} else if showMaps {
+			blockMaps(singleFile, segmentSize, tableOutput)
 		} else if parseIndex {
 			parseIndexFile(singleFile)
 		} else if toastVerbose {
@@ -110,7 +193,7 @@ func main() {
 		} else if blockRange != "" {
 			parseBlockRangeWithSegment(singleFile, blockRange, segOpts)
 		} else {
-			parseSingle(singleFile)
+			parseSingle(singleFile, schemaFilter)
 		}
 		return
 	}
@@ -163,7 +246,7 @@ func main() {
 		if verbose {
 			fmt.Fprintln(os.Stderr, "[*] Verifying page checksums...")
 		}
-		result, err := pgdump.VerifyDataDirChecksums(dataDir)
+		result, err := pgdump.VerifyDataDirChecksumsContext(ctx, dataDir, workers)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error verifying checksums: %v\n", err)
 			os.Exit(1)
@@ -296,10 +379,15 @@ func main() {
 		if verbose {
 			fmt.Fprintln(os.Stderr, "[*] Scanning for secrets with trufflehog detectors...")
 		}
-		findings, err := pgdump.ScanForSecrets(dataDir, &pgdump.Options{
+		findings, err := pgdump.ScanForSecretsContext(ctx, dataDir, &pgdump.Options{
 			DatabaseFilter:   dbFilter,
 			TableFilter:      tableFilter,
+			SchemaFilter:     schemaFilter,
+			ExcludeSchema:    excludeSchema,
 			SkipSystemTables: true,
+			TablespaceMap:    spcMap,
+			Workers:          workers,
+			SystemColumns:    systemColumns,
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -317,9 +405,11 @@ func main() {
 
 	// Search mode
 	if searchPattern != "" {
-		results, err := pgdump.Search(dataDir, &pgdump.SearchOptions{
+		results, err := pgdump.SearchContext(ctx, dataDir, &pgdump.SearchOptions{
 			Pattern:    searchPattern,
-			IncludeRow: true,
+			IncludeRow:    true,
+			Workers:       workers,
+			SystemColumns: systemColumns,
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -331,6 +421,96 @@ func main() {
 		return
 	}
 
+	// Row history
+	if showHistory {
+		history, err := pgdump.ScanRowHistoryContext(ctx, dataDir, &pgdump.Options{
+			DatabaseFilter:   dbFilter,
+			TableFilter:      tableFilter,
+			SchemaFilter:     schemaFilter,
+			ExcludeSchema:    excludeSchema,
+			SkipSystemTables: true,
+			OutputEncoding:   outputEncoding,
+			TablespaceMap:    spcMap,
+			TimeZone:         loc,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(history)
+		return
+	}
+
+	// Free-space carving
+	if carveRows {
+		carved, err := pgdump.ScanCarvedRowsContext(ctx, dataDir, &pgdump.Options{
+			DatabaseFilter:   dbFilter,
+			TableFilter:      tableFilter,
+			SchemaFilter:     schemaFilter,
+			ExcludeSchema:    excludeSchema,
+			SkipSystemTables: true,
+			OutputEncoding:   outputEncoding,
+			TablespaceMap:    spcMap,
+			TimeZone:         loc,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(carved)
+		return
+	}
+
+	// Orphaned relation files
+	if showOrphans {
+		orphans, err := pgdump.ScanOrphansContext(ctx, dataDir, &pgdump.Options{
+			DatabaseFilter:   dbFilter,
+			TableFilter:      tableFilter,
+			SchemaFilter:     schemaFilter,
+			ExcludeSchema:    excludeSchema,
+			ListOnly:         listOnly,
+			SkipSystemTables: true,
+			OutputEncoding:   outputEncoding,
+			TablespaceMap:    spcMap,
+			TimeZone:         loc,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(orphans)
+		return
+	}
+
+	// Dropped tables
+	if droppedTables {
+		result, err := pgdump.ScanDroppedTablesContext(ctx, dataDir, &pgdump.Options{
+			DatabaseFilter:   dbFilter,
+			TableFilter:      tableFilter,
+			SchemaFilter:     schemaFilter,
+			ExcludeSchema:    excludeSchema,
+			ListOnly:         listOnly,
+			SkipSystemTables: true,
+			OutputEncoding:   outputEncoding,
+			TablespaceMap:    spcMap,
+			TimeZone:         loc,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
 	// WAL summary
 	if showWAL {
 		summary, err := pgdump.ScanWALDirectory(dataDir)
@@ -345,26 +525,25 @@ func main() {
 	}
 
 	pgdump.Debug = debug
-	result, err := pgdump.DumpDataDir(dataDir, &pgdump.Options{
+	opts := &pgdump.Options{
 		DatabaseFilter:   dbFilter,
 		TableFilter:      tableFilter,
+		SchemaFilter:     schemaFilter,
+		ExcludeSchema:    excludeSchema,
 		ListOnly:         listOnly,
 		SkipSystemTables: true,
 		OutputEncoding:   outputEncoding,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	if verbose {
-		for _, db := range result.Databases {
-			fmt.Fprintf(os.Stderr, "[*] %s (OID %d): %d tables\n", db.Name, db.OID, len(db.Tables))
-		}
+		TablespaceMap:    spcMap,
+		Workers:          workers,
+		TimeZone:         loc,
+		AsOfXID:          uint32(asOfXID),
+		AsOfTime:         asOf,
+		IncludeDeleted:   showDeleted,
+		SystemColumns:    systemColumns,
 	}
 
 	// Output destination
-	var w io.Writer = os.Stdout
+	var out io.Writer = os.Stdout
 	if outputFile != "" {
 		f, err := os.Create(outputFile)
 		if err != nil {
@@ -372,30 +551,51 @@ func main() {
 			os.Exit(1)
 		}
 		defer f.Close()
-		w = f
+		out = f
 	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
 
-	// Output format
+	// Rows are written as they are decoded. A custom archive is written to
+	// the file itself, so its TOC can be rewritten with the data offsets.
+	var dw pgdump.DumpWriter
 	switch {
+	case outputFormat == "custom":
+		dw = pgdump.NewArchiveWriter(out, &pgdump.ArchiveOptions{
+			Compression: compressLevel,
+			Encoding:    outputEncoding,
+		})
 	case sqlOutput:
-		if err := result.ToSQL(w); err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating SQL: %v\n", err)
-			os.Exit(1)
-		}
+		dw = pgdump.NewSQLWriter(w)
+	case copyOutput:
+		dw = pgdump.NewCopyWriter(w)
 	case csvOutput:
-		if err := result.ToCSV(w); err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating CSV: %v\n", err)
-			os.Exit(1)
-		}
+		dw = pgdump.NewCSVWriter(w)
 	case tableOutput:
-		result.TableFormat(w)
+		dw = pgdump.NewTableWriter(w)
 	default:
-		enc := json.NewEncoder(w)
-		enc.SetIndent("", "  ")
-		enc.Encode(result)
+		dw = pgdump.NewJSONWriter(w)
+	}
+	if verbose {
+		dw = verboseWriter{dw}
+	}
+	if err := pgdump.StreamDataDirContext(ctx, dataDir, opts, dw); err != nil {
+		w.Flush()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
 
+// verboseWriter reports each database on stderr once it is written
+type verboseWriter struct {
+	pgdump.DumpWriter
+}
+
+func (v verboseWriter) EndDatabase(db *pgdump.DatabaseDump) error {
+	fmt.Fprintf(os.Stderr, "[*] %s (OID %d): %d tables\n", db.Name, db.OID, len(db.Tables))
+	return v.DumpWriter.EndDatabase(db)
+}
+
 func parseToastVerbose(path string) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -450,6 +650,47 @@ func parseBlockRangeWithSegment(path, rangeStr string, segOpts *pgdump.SegmentOp
 	enc.Encode(blocks)
 }
 
+func blockMaps(path string, segSize int, tableOutput bool) {
+	maps, err := pgdump.ReadBlockMaps(path, segSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if tableOutput {
+		pgdump.WriteBlockMaps(os.Stdout, maps)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(maps)
+}
+
+func inspectPages(path, rangeStr string, tableOutput bool) {
+	var br *pgdump.BlockRange
+	if rangeStr != "" {
+		var err error
+		if br, err = pgdump.ParseBlockRange(rangeStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing block range: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	pages, err := pgdump.InspectBlockRange(path, br)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if tableOutput {
+		pgdump.WriteInspection(os.Stdout, pages)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(pages)
+}
+
 func parseBinaryDump(path, rangeStr string) {
 	var br *pgdump.BlockRange
 	var err error
@@ -493,7 +734,7 @@ func parseIndexFile(path string) {
 	enc.Encode(info)
 }
 
-func parseSingle(path string) {
+func parseSingle(path, columnTypes string) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -504,25 +745,92 @@ func parseSingle(path string) {
 	case "1262":
 		fmt.Println("pg_database:")
 		for _, db := range pgdump.ParsePGDatabase(data) {
-			fmt.Printf("  %s (OID %d)\n", db.Name, db.OID)
+			fmt.Printf("  %s (OID %d, tablespace %d)\n", db.Name, db.OID, db.Tablespace)
 		}
 	case "1259":
 		fmt.Println("pg_class:")
 		for _, t := range pgdump.ParsePGClass(data) {
-			fmt.Printf("  %s (OID %d, filenode %d, kind %s)\n", t.Name, t.OID, t.Filenode, t.Kind)
+			fmt.Printf("  %s (OID %d, filenode %d, kind %s, namespace %d)\n", t.Name, t.OID, t.Filenode, t.Kind, t.Namespace)
+		}
+	case "1213":
+		fmt.Println("pg_tablespace:")
+		for _, spc := range pgdump.ParsePGTablespace(data) {
+			fmt.Printf("  %s (OID %d)\n", spc.Name, spc.OID)
+		}
+	case "2615":
+		fmt.Println("pg_namespace:")
+		for oid, name := range pgdump.ParsePGNamespace(data) {
+			fmt.Printf("  %s (OID %d)\n", name, oid)
+		}
+	case "1247":
+		fmt.Println("pg_type:")
+		for oid, t := range pgdump.ParsePGType(data) {
+			fmt.Printf("  %s (OID %d, typtype %c, len %d)\n", t.Name, oid, t.Type, t.Len)
+		}
+	case "3501":
+		fmt.Println("pg_enum:")
+		for oid, label := range pgdump.ParsePGEnum(data) {
+			fmt.Printf("  %s (OID %d)\n", label, oid)
 		}
 	case "1249":
 		fmt.Println("pg_attribute:")
 		for relid, cols := range pgdump.ParsePGAttribute(data, 0) {
 			fmt.Printf("  relation %d:\n", relid)
 			for _, c := range cols {
-				fmt.Printf("    %d: %s (%s)\n", c.Num, c.Name, pgdump.TypeName(c.TypID))
+				fmt.Printf("    %d: %s (%s)\n", c.Num, c.Name, pgdump.FormatType(c.TypID, c.TypMod, c.NDims))
 			}
 		}
 	default:
 		tuples := pgdump.ParseFile(data)
 		fmt.Printf("Heap file: %d tuples\n", len(tuples))
+		if len(tuples) > 0 {
+			decodeHeapFile(data, columnTypes)
+		}
+	}
+}
+
+// decodeHeapFile decodes a heap file without catalog, with the column
+// types given as -schema "int4,text,..." or else inferred from its tuples
+func decodeHeapFile(data []byte, columnTypes string) {
+	var schema *pgdump.InferredSchema
+	source := "inferred"
+	if columnTypes != "" {
+		columns, err := pgdump.ParseColumnTypes(columnTypes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		schema, source = pgdump.ScoreSchema(data, columns), "given"
+	} else {
+		schema = pgdump.InferSchema(data)
+	}
+
+	fmt.Printf("Columns (%s, fitting %.0f%% of %d tuples):\n", source, schema.Fit*100, schema.Tuples)
+	for _, c := range schema.Columns {
+		fmt.Printf("  %-8s %-12s confidence %.2f\n", c.Name, c.Type, c.Confidence)
+	}
+	fmt.Println("Rows:")
+	it := pgdump.NewRowIterator(bytes.NewReader(data), schema.DecodeColumns())
+	for it.Next() {
+		line, _ := json.Marshal(it.Row())
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+// parseAsOfTime reads an -as-of time as RFC 3339, or without a zone in loc
+func parseAsOfTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999", "2006-01-02T15:04:05.999999", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("invalid -as-of time %q (e.g. '2024-05-01 13:00:00' or RFC 3339)", s)
 }
 
 func usage() {
@@ -533,12 +841,24 @@ Usage:
   pgread -sql                                Output as SQL statements
   pgread -csv                                Output as CSV
   pgread -sql -db mydb > backup.sql          Export database to SQL file
+  pgread -copy -db mydb | psql newdb         Export with COPY data blocks (fast reload)
+  pgread -db mydb -format custom -output db.dump
+                                             pg_restore archive (-compress 6 for zlib)
   pgread -detect                             Show detected PostgreSQL paths
   pgread -list-db                            List databases
   pgread -db mydb                            Dump specific database
   pgread -db mydb -t password                Filter tables
+  pgread -db mydb -schema audit              Only tables in schema 'audit'
+  pgread -db mydb -exclude-schema audit      Skip tables in schema 'audit'
   pgread -d /path/to/data/                   Use specific data directory
+  pgread -tablespace-map 16400=/mnt/ts1      Read tablespace 16400 from a copy
+  pgread -j 4                                Decode 4 tables at once (default: one per CPU)
+  pgread -tz Europe/Paris                    Show timestamptz in a time zone (default: UTC)
   pgread -f /path/to/1262                    Parse single file
+  pgread -f /path/to/16385                   Heap file: infer column types and decode
+  pgread -f /path/to/16385 -schema "int4,text,timestamptz"
+                                             Decode a heap file with these column types
+                                             (with -f, -schema is a type list, not a schema name)
 
 Security / Forensics:
   pgread -passwords all                      Extract all password hashes
@@ -546,6 +866,13 @@ Security / Forensics:
   pgread -secrets auto                       Search for secrets (700+ patterns via Trufflehog)
   pgread -search "password|secret"           Search with custom regex
   pgread -deleted                            Include deleted (non-vacuumed) rows
+  pgread -system-columns -t users            Rows with ctid, xmin, xmax, cmin, cmax and infomask flags
+  pgread -history -t users                   Row versions left by UPDATEs, with changed columns
+  pgread -carve -t users                     Rows carved from page free space, after VACUUM
+  pgread -orphans                            Relation files left by DROP, TRUNCATE or rewrites
+  pgread -dropped-tables                     Tables removed by DROP TABLE, from dead catalog tuples
+  pgread -as-of-xid 1234                     Tables as transaction 1234 saw them at its start
+  pgread -as-of '2024-05-01 13:00:00'        Tables as of a commit time (track_commit_timestamp)
   pgread -wal                                Show WAL transaction summary
 
 Low-Level / Forensics:
@@ -559,6 +886,9 @@ Low-Level / Forensics:
   pgread -f /path/to/file -R 0:10            Read specific block range
   pgread -f /path/to/file -b                 Binary block dump (hex output)
   pgread -f /path/to/file -b -R 0:5          Binary dump of block range
+  pgread -f /path/to/file -inspect -R 0      Page header and line pointers (pageinspect)
+  pgread -f /path/to/file -inspect -table    Same, as psql prints them
+  pgread -f /path/to/file -maps              Visibility map and free space map, per block
   pgread -f /path/to/toast -toast-verbose    Verbose TOAST table info
   pgread -f /path/to/file -n 2 -R 0:10       Read from segment 2
   pgread -f /path/to/file -s 134217728       Custom segment size (128MB)
@@ -569,6 +899,8 @@ Fixed OIDs:
   1260  pg_authid    (global/1260) - passwords
   1259  pg_class     (base/<oid>/1259)
   1249  pg_attribute (base/<oid>/1249)
+  2615  pg_namespace (base/<oid>/2615) - schemas
+  1213  pg_tablespace (global/1213) - pg_tblspc/<oid>/PG_<ver>_<catver>/<db_oid>
 
 Options:
 `)
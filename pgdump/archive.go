@@ -0,0 +1,505 @@
+package pgdump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Custom-format archive layout, as read by pg_restore (pg_backup_archiver.h)
+const (
+	archiveMagic   = "PGDMP"
+	archiveMajor   = 1
+	archiveMinor   = 14 // written by pg_dump 12-15, read by any later pg_restore
+	archiveRev     = 0
+	archiveCustom  = 1 // archCustom
+	archiveIntSize = 4
+	archiveOffSize = 8
+
+	// Sections
+	sectionPreData  = 2
+	sectionData     = 3
+	sectionPostData = 4
+
+	blockData = 1 // BLK_DATA
+
+	// Data offset states
+	offsetPosNotSet = 1
+	offsetPosSet    = 2
+	offsetNoData    = 3
+
+	copyChunkSize = 64 * 1024
+)
+
+// ArchiveOptions configures custom-format archive output
+type ArchiveOptions struct {
+	Compression int    // zlib level 1-9 for table data, 0 = uncompressed (pg_dump -Z)
+	Encoding    string // client_encoding of the row data (default: UTF8)
+}
+
+// archiveEntry is a TOC entry. TABLE DATA entries have the table whose
+// rows are their data block, and the block itself once it is encoded.
+type archiveEntry struct {
+	id         int
+	desc, tag  string
+	section    int
+	defn, drop string
+	copyStmt   string
+	namespace  string
+	tableAM    string
+	deps       []int
+	table      *TableDump
+	data       []byte
+}
+
+// ToArchive writes the dump as a pg_dump custom-format archive that
+// pg_restore reads (pg_restore -l, -t, -d ...). An archive holds a single
+// database, so the result must have exactly one.
+func (r *DumpResult) ToArchive(w io.Writer) error {
+	return r.WriteArchive(w, nil)
+}
+
+// WriteArchive is ToArchive with options
+func (r *DumpResult) WriteArchive(w io.Writer, opts *ArchiveOptions) error {
+	if len(r.Databases) != 1 {
+		return fmt.Errorf("a custom-format archive holds one database, got %d (filter with -db)", len(r.Databases))
+	}
+	return r.Databases[0].WriteArchive(w, opts)
+}
+
+// WriteArchive writes the database as a pg_dump custom-format archive.
+// Schemas, tables, sequences and defaults are pre-data entries, rows are
+// COPY data blocks, and constraints and indexes are post-data entries.
+func (d *DatabaseDump) WriteArchive(w io.Writer, opts *ArchiveOptions) error {
+	opts, err := archiveOptions(opts)
+	if err != nil {
+		return err
+	}
+	entries := d.archiveEntries(opts.Encoding)
+	for _, e := range entries {
+		if e.table == nil {
+			continue
+		}
+		var block bytes.Buffer
+		if err := writeDataBlock(&block, e.id, e.table, rowSlice(e.table.Rows), opts.Compression); err != nil {
+			return err
+		}
+		e.data = block.Bytes()
+	}
+	return writeArchive(w, d.Name, opts.Compression, entries)
+}
+
+// archiveOptions checks opts and fills in the defaults, without changing opts
+func archiveOptions(opts *ArchiveOptions) (*ArchiveOptions, error) {
+	o := ArchiveOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Compression < 0 || o.Compression > 9 {
+		return nil, fmt.Errorf("invalid compression level %d (0-9)", o.Compression)
+	}
+	if o.Encoding == "" {
+		o.Encoding = "UTF8"
+	}
+	return &o, nil
+}
+
+// archiveEntries returns the TOC entries of the database, in restore order
+func (d *DatabaseDump) archiveEntries(encoding string) []*archiveEntry {
+	var entries []*archiveEntry
+	add := func(e *archiveEntry) *archiveEntry {
+		e.id = len(entries) + 1
+		entries = append(entries, e)
+		return e
+	}
+	add(&archiveEntry{desc: "ENCODING", tag: "ENCODING", section: sectionPreData,
+		defn: fmt.Sprintf("SET client_encoding = %s;\n", quoteLiteral(encoding))})
+	add(&archiveEntry{desc: "STDSTRINGS", tag: "STDSTRINGS", section: sectionPreData,
+		defn: "SET standard_conforming_strings = 'on';\n"})
+
+	schemas := make(map[string]int)
+	for _, t := range d.Tables {
+		if t.Schema == "" || schemas[t.Schema] != 0 {
+			continue
+		}
+		schemas[t.Schema] = add(&archiveEntry{desc: "SCHEMA", tag: t.Schema, section: sectionPreData,
+			defn: fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdent(t.Schema)),
+			drop: fmt.Sprintf("DROP SCHEMA %s;\n", quoteIdent(t.Schema))}).id
+	}
+
+	// Tables and sequences by qualified name, for dependencies
+	relations := make(map[string]int)
+	depsOf := func(schema, table string) []int {
+		if id, ok := relations[qualifiedName(schema, table)]; ok {
+			return []int{id}
+		}
+		if id, ok := schemas[schema]; ok {
+			return []int{id}
+		}
+		return nil
+	}
+
+	for _, t := range d.Tables {
+		relations[t.QualifiedName()] = add(&archiveEntry{desc: "TABLE", tag: t.Name, section: sectionPreData,
+			defn: t.createTableSQL(), drop: fmt.Sprintf("DROP TABLE %s;\n", t.quotedName()),
+			namespace: t.Schema, tableAM: "heap", deps: depsOf(t.Schema, "")}).id
+	}
+
+	post, _ := d.postData()
+	var data, postData []*archiveEntry
+	for _, stmt := range post {
+		e := &archiveEntry{desc: stmt.desc, tag: stmt.tag, defn: stmt.sql + "\n",
+			namespace: stmt.schema, deps: depsOf(stmt.schema, stmt.table)}
+		if stmt.drop != "" {
+			e.drop = stmt.drop + "\n"
+		}
+		switch stmt.desc {
+		case "SEQUENCE":
+			e.section = sectionPreData
+			relations[qualifiedName(stmt.schema, stmt.table)] = add(e).id
+		case "DEFAULT":
+			e.section = sectionPreData
+			add(e)
+		case "SEQUENCE SET":
+			e.section = sectionData
+			data = append(data, e)
+		default:
+			e.section = sectionPostData
+			postData = append(postData, e)
+		}
+	}
+
+	for i := range d.Tables {
+		t := &d.Tables[i]
+		add(&archiveEntry{desc: "TABLE DATA", tag: t.Name, section: sectionData,
+			copyStmt: t.copyStatement() + "\n", namespace: t.Schema,
+			deps: depsOf(t.Schema, t.Name), table: t})
+	}
+	for _, e := range data {
+		add(e)
+	}
+
+	// Foreign keys wait for the keys they may reference
+	var keys []int
+	for _, e := range postData {
+		if e.desc == "FK CONSTRAINT" {
+			e.deps = append(e.deps, keys...)
+		}
+		if add(e).desc == "CONSTRAINT" && !strings.HasSuffix(e.tag, " NOT NULL") {
+			keys = append(keys, e.id)
+		}
+	}
+	return entries
+}
+
+// writeDataBlock writes the rows of t as the data block of TOC entry id:
+// COPY text, compressed at level, in chunks of at most copyChunkSize bytes
+func writeDataBlock(w io.Writer, id int, t *TableDump, rows *RowIterator, level int) error {
+	head := &archiveWriter{}
+	head.writeByte(blockData)
+	head.writeInt(id)
+	if _, err := w.Write(head.buf.Bytes()); err != nil {
+		return err
+	}
+
+	chunks := &chunkWriter{w: w}
+	var payload io.Writer = chunks
+	var zw *zlib.Writer
+	if level > 0 {
+		var err error
+		if zw, err = zlib.NewWriterLevel(chunks, level); err != nil {
+			return err
+		}
+		payload = zw
+	}
+	for rows.Next() {
+		if _, err := io.WriteString(payload, t.copyRow(rows.Row())+"\n"); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	return chunks.Close()
+}
+
+// chunkWriter splits a data block's payload into chunks of at most
+// copyChunkSize bytes, each preceded by its length
+type chunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := copyChunkSize - len(c.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		c.buf = append(c.buf, p[:k]...)
+		p = p[k:]
+		if len(c.buf) == copyChunkSize {
+			if err := c.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *chunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	a := &archiveWriter{}
+	a.writeInt(len(c.buf))
+	a.buf.Write(c.buf)
+	c.buf = c.buf[:0]
+	_, err := c.w.Write(a.buf.Bytes())
+	return err
+}
+
+// Close writes the last chunk and the zero length that ends the block
+func (c *chunkWriter) Close() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	a := &archiveWriter{}
+	a.writeInt(0)
+	_, err := c.w.Write(a.buf.Bytes())
+	return err
+}
+
+// writeArchive writes the header, the TOC and the encoded data blocks. Each
+// TOC entry records where its data block starts, so the TOC is measured first.
+func writeArchive(w io.Writer, dbName string, compression int, entries []*archiveEntry) error {
+	head := &archiveWriter{}
+	head.writeHeader(dbName, compression, time.Now())
+	pos := int64(head.buf.Len() + (&archiveWriter{}).writeToc(entries, nil).buf.Len())
+	offsets := make(map[int]int64)
+	for _, e := range entries {
+		if e.data != nil {
+			offsets[e.id] = pos
+			pos += int64(len(e.data))
+		}
+	}
+
+	head.writeToc(entries, offsets)
+	if _, err := w.Write(head.buf.Bytes()); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.data != nil {
+			if _, err := w.Write(e.data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewArchiveWriter returns a DumpWriter producing the output of
+// WriteArchive, with each table's data block written as its rows are
+// decoded. The TOC comes first, so once the database is written its data
+// offsets are rewritten in place when w can seek, and left unset
+// otherwise, in which case pg_restore finds the blocks by reading on.
+func NewArchiveWriter(w io.Writer, opts *ArchiveOptions) DumpWriter {
+	return &archiveStream{out: w, w: bufio.NewWriter(w), opts: opts}
+}
+
+// archiveStream writes a custom-format archive for a single database
+type archiveStream struct {
+	out       io.Writer
+	w         *bufio.Writer
+	opts      *ArchiveOptions
+	pos       int64 // bytes of the archive written so far
+	tocStart  int64
+	entries   []*archiveEntry
+	ids       map[*TableDump]int // TABLE DATA entry of each table
+	offsets   map[int]int64
+	databases int
+}
+
+func (s *archiveStream) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// BeginDatabase writes the header and the TOC, with no data offsets yet
+func (s *archiveStream) BeginDatabase(db *DatabaseDump) error {
+	if s.databases++; s.databases > 1 {
+		return fmt.Errorf("a custom-format archive holds one database, got more (filter with -db)")
+	}
+	opts, err := archiveOptions(s.opts)
+	if err != nil {
+		return err
+	}
+	s.opts = opts
+	s.entries = db.archiveEntries(opts.Encoding)
+	s.ids = make(map[*TableDump]int)
+	s.offsets = make(map[int]int64)
+	for _, e := range s.entries {
+		if e.table != nil {
+			s.ids[e.table] = e.id
+		}
+	}
+
+	head := &archiveWriter{}
+	head.writeHeader(db.Name, opts.Compression, time.Now())
+	s.tocStart = int64(head.buf.Len())
+	head.writeToc(s.entries, nil)
+	_, err = s.Write(head.buf.Bytes())
+	return err
+}
+
+func (s *archiveStream) WriteTable(_ *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	id, ok := s.ids[t]
+	if !ok {
+		return fmt.Errorf("table %s is not in the archive's TOC", t.QualifiedName())
+	}
+	s.offsets[id] = s.pos
+	return writeDataBlock(s, id, t, rows, s.opts.Compression)
+}
+
+// EndDatabase rewrites the TOC with the data offsets if the output can
+// seek. Offsets have a fixed size, so the TOC keeps its length.
+func (s *archiveStream) EndDatabase(*DatabaseDump) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	seeker, ok := s.out.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil // a pipe: the offsets stay unset
+	}
+	toc := (&archiveWriter{}).writeToc(s.entries, s.offsets)
+	if _, err := seeker.Seek(end-s.pos+s.tocStart, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(toc.buf.Bytes()); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+func (s *archiveStream) Close() error {
+	if s.databases == 0 {
+		return fmt.Errorf("a custom-format archive holds one database, got 0 (filter with -db)")
+	}
+	return s.w.Flush()
+}
+
+// archiveWriter encodes the archive's primitives: a byte, an int as a sign
+// byte and archiveIntSize little-endian bytes, a string as its length and
+// bytes (length -1 for NULL), an offset as a state byte and 8 bytes.
+type archiveWriter struct {
+	buf bytes.Buffer
+}
+
+func (a *archiveWriter) writeByte(b byte) {
+	a.buf.WriteByte(b)
+}
+
+func (a *archiveWriter) writeInt(v int) {
+	sign := byte(0)
+	if v < 0 {
+		sign, v = 1, -v
+	}
+	a.buf.WriteByte(sign)
+	var b [archiveIntSize]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(v))
+	a.buf.Write(b[:])
+}
+
+func (a *archiveWriter) writeStr(s string) {
+	a.writeInt(len(s))
+	a.buf.WriteString(s)
+}
+
+func (a *archiveWriter) writeNull() {
+	a.writeInt(-1)
+}
+
+func (a *archiveWriter) writeOffset(state byte, pos int64) {
+	a.buf.WriteByte(state)
+	var b [archiveOffSize]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(pos))
+	a.buf.Write(b[:])
+}
+
+func (a *archiveWriter) writeHeader(dbName string, compression int, now time.Time) {
+	a.buf.WriteString(archiveMagic)
+	a.writeByte(archiveMajor)
+	a.writeByte(archiveMinor)
+	a.writeByte(archiveRev)
+	a.writeByte(archiveIntSize)
+	a.writeByte(archiveOffSize)
+	a.writeByte(archiveCustom)
+	a.writeInt(compression)
+	// struct tm of the creation time
+	for _, v := range []int{now.Second(), now.Minute(), now.Hour(), now.Day(), int(now.Month()) - 1, now.Year() - 1900} {
+		a.writeInt(v)
+	}
+	a.writeInt(-1) // tm_isdst unknown
+	a.writeStr(dbName)
+	a.writeStr("")       // server version, unknown for a data directory
+	a.writeStr("pgread") // dumper version
+}
+
+// writeToc writes the TOC. Data entries without an offset have it unset.
+func (a *archiveWriter) writeToc(entries []*archiveEntry, offsets map[int]int64) *archiveWriter {
+	a.writeInt(len(entries))
+	for _, e := range entries {
+		a.writeInt(e.id)
+		if e.table != nil {
+			a.writeInt(1)
+		} else {
+			a.writeInt(0)
+		}
+		a.writeStr("0") // catalog ID: tableoid, oid
+		a.writeStr("0")
+		a.writeStr(e.tag)
+		a.writeStr(e.desc)
+		a.writeInt(e.section)
+		a.writeStr(e.defn)
+		a.writeStr(e.drop)
+		a.writeStr(e.copyStmt)
+		a.writeStr(e.namespace)
+		a.writeStr("") // tablespace
+		if e.tableAM != "" {
+			a.writeStr(e.tableAM)
+		} else {
+			a.writeNull()
+		}
+		a.writeStr("")      // owner: none, so pg_restore skips ALTER OWNER
+		a.writeStr("false") // WITH OIDS
+		for _, dep := range e.deps {
+			a.writeStr(fmt.Sprintf("%d", dep))
+		}
+		a.writeNull()
+		if pos, ok := offsets[e.id]; ok {
+			a.writeOffset(offsetPosSet, pos)
+		} else if e.table != nil {
+			a.writeOffset(offsetPosNotSet, 0)
+		} else {
+			a.writeOffset(offsetNoData, 0)
+		}
+	}
+	return a
+}
@@ -0,0 +1,347 @@
+package pgdump
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testArchiveReader decodes what pg_restore reads back from an archive
+type testArchiveReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *testArchiveReader) readByte() byte {
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+func (r *testArchiveReader) readInt() int {
+	sign := r.readByte()
+	v := int(binary.LittleEndian.Uint32(r.data[r.pos:]))
+	r.pos += 4
+	if sign != 0 {
+		return -v
+	}
+	return v
+}
+
+func (r *testArchiveReader) readStr() (string, bool) {
+	n := r.readInt()
+	if n < 0 {
+		return "", false
+	}
+	r.pos += n
+	return string(r.data[r.pos-n : r.pos]), true
+}
+
+type testTocEntry struct {
+	id, section         int
+	desc, tag, copyStmt string
+	defn, namespace     string
+	tableAM             string
+	hasTableAM, hasData bool
+	deps                []int
+	state               byte
+	offset              int
+}
+
+func readTestArchive(t *testing.T, data []byte) (compression int, dbName string, entries []testTocEntry, r *testArchiveReader) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("PGDMP")) {
+		t.Fatalf("bad magic %q", data[:5])
+	}
+	r = &testArchiveReader{data: data, pos: 5}
+	if v := []byte{r.readByte(), r.readByte(), r.readByte()}; !bytes.Equal(v, []byte{1, 14, 0}) {
+		t.Fatalf("version = %v", v)
+	}
+	if intSize, offSize, format := r.readByte(), r.readByte(), r.readByte(); intSize != 4 || offSize != 8 || format != 1 {
+		t.Fatalf("intSize %d offSize %d format %d", intSize, offSize, format)
+	}
+	compression = r.readInt()
+	for i := 0; i < 7; i++ {
+		r.readInt()
+	}
+	dbName, _ = r.readStr()
+	r.readStr()
+	r.readStr()
+
+	n := r.readInt()
+	for i := 0; i < n; i++ {
+		var e testTocEntry
+		e.id = r.readInt()
+		e.hasData = r.readInt() == 1
+		r.readStr()
+		r.readStr()
+		e.tag, _ = r.readStr()
+		e.desc, _ = r.readStr()
+		e.section = r.readInt()
+		e.defn, _ = r.readStr()
+		r.readStr()
+		e.copyStmt, _ = r.readStr()
+		e.namespace, _ = r.readStr()
+		r.readStr()
+		e.tableAM, e.hasTableAM = r.readStr()
+		r.readStr()
+		if oids, _ := r.readStr(); oids != "false" {
+			t.Fatalf("entry %d: with oids = %q", e.id, oids)
+		}
+		for {
+			dep, ok := r.readStr()
+			if !ok {
+				break
+			}
+			id, _ := strconv.Atoi(dep)
+			e.deps = append(e.deps, id)
+		}
+		e.state = r.readByte()
+		e.offset = int(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		if (e.state == 3) == e.hasData {
+			t.Fatalf("entry %d (%s): offset state %d", e.id, e.desc, e.state)
+		}
+		entries = append(entries, e)
+	}
+	return compression, dbName, entries, r
+}
+
+// readTestBlock returns the data of the block at offset, inflated if needed
+func readTestBlock(t *testing.T, r *testArchiveReader, e testTocEntry, compressed bool) string {
+	t.Helper()
+	r.pos = e.offset
+	if typ, id := r.readByte(), r.readInt(); typ != 1 || id != e.id {
+		t.Fatalf("block at %d: type %d, dump ID %d, want 1, %d", e.offset, typ, id, e.id)
+	}
+	var payload []byte
+	for n := r.readInt(); n > 0; n = r.readInt() {
+		payload = append(payload, r.data[r.pos:r.pos+n]...)
+		r.pos += n
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf("zlib: %v", err)
+		}
+		if payload, err = io.ReadAll(zr); err != nil {
+			t.Fatalf("inflate: %v", err)
+		}
+	}
+	return string(payload)
+}
+
+func testArchiveDatabase() DatabaseDump {
+	return DatabaseDump{
+		Name:      "shop",
+		Sequences: []SequenceData{{Name: "orders_id_seq", Schema: "public", LastValue: 42, IsCalled: true}},
+		Tables: []TableDump{
+			{Schema: "public", Name: "customers",
+				Columns:     []ColumnInfo{{Name: "id", Type: "int4", TypID: OidInt4, NotNull: true}, {Name: "note", Type: "text", TypID: OidText}},
+				Rows:        []Row{testRow("id", int32(1), "note", "a\tb\\c\nd"), testRow("id", int32(2))},
+				RowCount:    2,
+				Constraints: []ConstraintDef{{Name: "customers_pkey", Type: "p", Definition: "PRIMARY KEY (id)"}},
+			},
+			{Schema: "public", Name: "orders",
+				Columns: []ColumnInfo{
+					{Name: "id", Type: "int8", TypID: OidInt8, Default: "nextval('public.orders_id_seq'::regclass)"},
+					{Name: "customer_id", Type: "int4", TypID: OidInt4},
+				},
+				Rows:        []Row{testRow("id", int64(10), "customer_id", int32(1))},
+				RowCount:    1,
+				Constraints: []ConstraintDef{{Name: "orders_customer_id_fkey", Type: "f", Definition: "FOREIGN KEY (customer_id) REFERENCES public.customers(id)"}},
+				Indexes:     []IndexDef{{Name: "orders_customer_idx", Definition: "CREATE INDEX orders_customer_idx ON public.orders USING btree (customer_id)"}},
+			},
+		},
+	}
+}
+
+func TestDatabaseWriteArchive(t *testing.T) {
+	for _, level := range []int{0, 6} {
+		db := testArchiveDatabase()
+		var buf bytes.Buffer
+		if err := db.WriteArchive(&buf, &ArchiveOptions{Compression: level}); err != nil {
+			t.Fatalf("WriteArchive failed: %v", err)
+		}
+		compression, dbName, entries, r := readTestArchive(t, buf.Bytes())
+		if compression != level || dbName != "shop" {
+			t.Errorf("compression %d, database %q", compression, dbName)
+		}
+
+		ids := make(map[string]int)
+		section := 0
+		for _, e := range entries {
+			if e.section < section {
+				t.Errorf("%s %s: section %d after %d", e.desc, e.tag, e.section, section)
+			}
+			section = e.section
+			ids[e.desc+" "+e.tag] = e.id
+			if e.hasTableAM != (e.desc == "TABLE") || (e.hasTableAM && e.tableAM != "heap") {
+				t.Errorf("%s %s: tableam %q", e.desc, e.tag, e.tableAM)
+			}
+		}
+		for _, want := range []string{
+			"ENCODING ENCODING", "SCHEMA public", "TABLE customers", "SEQUENCE orders_id_seq", "DEFAULT orders id",
+			"TABLE DATA customers", "SEQUENCE SET orders_id_seq", "CONSTRAINT customers id NOT NULL",
+			"CONSTRAINT customers customers_pkey", "INDEX orders_customer_idx", "FK CONSTRAINT orders orders_customer_id_fkey",
+		} {
+			if ids[want] == 0 {
+				t.Errorf("missing TOC entry %q", want)
+			}
+		}
+
+		for _, e := range entries {
+			switch {
+			case e.desc == "TABLE DATA" && e.tag == "customers":
+				if e.copyStmt != "COPY public.customers (id, note) FROM stdin;\n" || e.namespace != "public" {
+					t.Errorf("copy statement %q, namespace %q", e.copyStmt, e.namespace)
+				}
+				if len(e.deps) != 1 || e.deps[0] != ids["TABLE customers"] {
+					t.Errorf("table data deps = %v", e.deps)
+				}
+				if got, want := readTestBlock(t, r, e, level > 0), "1\ta\\tb\\\\c\\nd\n2\t\\N\n"; got != want {
+					t.Errorf("customers data = %q, want %q", got, want)
+				}
+			case e.desc == "TABLE DATA" && e.tag == "orders":
+				if got := readTestBlock(t, r, e, level > 0); got != "10\t1\n" {
+					t.Errorf("orders data = %q", got)
+				}
+			case e.desc == "FK CONSTRAINT":
+				if !containsInt(e.deps, ids["CONSTRAINT customers customers_pkey"]) {
+					t.Errorf("foreign key does not wait for the primary key: deps %v", e.deps)
+				}
+			case e.desc == "ENCODING":
+				if e.defn != "SET client_encoding = 'UTF8';\n" {
+					t.Errorf("encoding defn = %q", e.defn)
+				}
+			}
+		}
+	}
+}
+
+func containsInt(vals []int, v int) bool {
+	for _, x := range vals {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDumpResultToArchiveSingleDatabase(t *testing.T) {
+	result := DumpResult{Databases: []DatabaseDump{{Name: "a"}, {Name: "b"}}}
+	if err := result.ToArchive(io.Discard); err == nil {
+		t.Error("expected an error for two databases")
+	}
+	result.Databases = result.Databases[:1]
+	var buf bytes.Buffer
+	if err := result.ToArchive(&buf); err != nil {
+		t.Fatalf("ToArchive failed: %v", err)
+	}
+	if _, name, entries, _ := readTestArchive(t, buf.Bytes()); name != "a" || len(entries) != 2 {
+		t.Errorf("database %q, %d entries", name, len(entries))
+	}
+	if err := result.WriteArchive(io.Discard, &ArchiveOptions{Compression: 10}); err == nil {
+		t.Error("expected an error for compression level 10")
+	}
+}
+
+// writeTestArchiveStream streams the database through NewArchiveWriter
+func writeTestArchiveStream(t *testing.T, db *DatabaseDump, w io.Writer, level int) {
+	t.Helper()
+	aw := NewArchiveWriter(w, &ArchiveOptions{Compression: level})
+	if err := db.writeTo(aw); err != nil {
+		t.Fatalf("writing archive: %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestArchiveWriterSeekable(t *testing.T) {
+	db := testArchiveDatabase()
+	long := strings.Repeat("x", 3*copyChunkSize)
+	db.Tables[0].Rows = append(db.Tables[0].Rows, testRow("id", int32(3), "note", long))
+
+	for _, level := range []int{0, 6} {
+		f, err := os.Create(filepath.Join(t.TempDir(), "shop.dump"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestArchiveStream(t, &db, f, level)
+		f.Close()
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, entries, r := readTestArchive(t, data)
+		blocks := 0
+		for _, e := range entries {
+			if !e.hasData {
+				continue
+			}
+			if e.state != 2 {
+				t.Errorf("%s %s: offset state %d, want set", e.desc, e.tag, e.state)
+				continue
+			}
+			blocks++
+			got := readTestBlock(t, r, e, level > 0)
+			if e.tag == "customers" && got != "1\ta\\tb\\\\c\\nd\n2\t\\N\n3\t"+long+"\n" {
+				t.Errorf("customers data: %d bytes", len(got))
+			}
+			if e.tag == "orders" && got != "10\t1\n" {
+				t.Errorf("orders data = %q", got)
+			}
+		}
+		if blocks != 2 {
+			t.Errorf("%d data blocks, want 2", blocks)
+		}
+	}
+}
+
+func TestArchiveWriterUnseekable(t *testing.T) {
+	db := testArchiveDatabase()
+	var buf bytes.Buffer
+	writeTestArchiveStream(t, &db, &buf, 0)
+
+	// Without offsets, the blocks follow the TOC in its order
+	_, _, entries, r := readTestArchive(t, buf.Bytes())
+	var got []string
+	for _, e := range entries {
+		if !e.hasData {
+			continue
+		}
+		if e.state != 1 {
+			t.Errorf("%s %s: offset state %d, want not set", e.desc, e.tag, e.state)
+		}
+		e.offset = r.pos
+		got = append(got, readTestBlock(t, r, e, false))
+	}
+	if want := []string{"1\ta\\tb\\\\c\\nd\n2\t\\N\n", "10\t1\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("data blocks = %q, want %q", got, want)
+	}
+	if r.pos != buf.Len() {
+		t.Errorf("%d trailing bytes", buf.Len()-r.pos)
+	}
+}
+
+func TestArchiveWriterSingleDatabase(t *testing.T) {
+	if err := NewArchiveWriter(io.Discard, nil).Close(); err == nil {
+		t.Error("expected an error for no database")
+	}
+	result := DumpResult{Databases: []DatabaseDump{{Name: "a"}, {Name: "b"}}}
+	if err := result.writeTo(NewArchiveWriter(io.Discard, nil)); err == nil {
+		t.Error("expected an error for two databases")
+	}
+	db := DatabaseDump{Name: "a"}
+	if err := db.writeTo(NewArchiveWriter(io.Discard, &ArchiveOptions{Compression: 10})); err == nil {
+		t.Error("expected an error for compression level 10")
+	}
+}
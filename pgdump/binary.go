@@ -57,12 +57,20 @@ func isTemplateDB(name string) bool {
 }
 
 func FindDatabaseOID(dbData []byte, dbName string) uint32 {
+	if db := FindDatabase(dbData, dbName); db != nil {
+		return db.OID
+	}
+	return 0
+}
+
+// FindDatabase looks up a database by name in pg_database data
+func FindDatabase(dbData []byte, dbName string) *DatabaseInfo {
 	for _, db := range ParsePGDatabase(dbData) {
 		if db.Name == dbName {
-			return db.OID
+			return &db
 		}
 	}
-	return 0
+	return nil
 }
 
 // toInt converts various numeric types to int
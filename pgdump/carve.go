@@ -0,0 +1,386 @@
+package pgdump
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"unicode/utf8"
+)
+
+// CarvedRow is a row recovered from tuple bytes no line pointer leads to
+// anymore. VACUUM marks the line pointers of dead tuples unused and moves
+// the live ones together, but the old bytes stay in the page's free space
+// until new tuples overwrite them.
+type CarvedRow struct {
+	Block  uint32 `json:"block"`
+	Offset int    `json:"offset"` // of the tuple in the page
+	Length int    `json:"length"`
+	Xmin   uint32 `json:"xmin"`
+	Xmax   uint32 `json:"xmax,omitempty"`
+
+	// Confidence is the share of the checks in carveConfidence the tuple
+	// passes, from 0 to 1. Every carved tuple already has a well-formed
+	// header and data laid out like the table's columns.
+	Confidence float64 `json:"confidence"`
+	Row        Row     `json:"row"`
+}
+
+// TableCarve is the rows carved from a table
+type TableCarve struct {
+	Database string      `json:"database"`
+	Table    string      `json:"table"`
+	Rows     []CarvedRow `json:"rows"`
+}
+
+// maxHeapTuplesPerPage bounds line pointer numbers, as MaxHeapTuplesPerPage
+const maxHeapTuplesPerPage = (PageSize - headerSize) / (minHeapTupleSize + itemIDSize)
+
+// carvedTuple is a tuple found in a page's free space, at offset
+type carvedTuple struct {
+	offset int
+	length int
+	tuple  *HeapTupleData
+}
+
+// CarveHeapPage scans heap page number block for tuples of a table with
+// these columns that no line pointer leads to: in the gap between pd_lower
+// and pd_upper, and between the live tuples
+func CarveHeapPage(page []byte, block uint32, columns []Column) []CarvedRow {
+	dec, names := &rowDecoder{}, columnNames(columns)
+	var rows []CarvedRow
+	for _, c := range carvePage(page, columns) {
+		row := dec.decodeTuple(c.tuple, columns, names)
+		rows = append(rows, newCarvedRow(c, block, row, columns, nil))
+	}
+	return rows
+}
+
+// newCarvedRow describes the carved tuple c, decoded as row
+func newCarvedRow(c carvedTuple, block uint32, row Row, columns []Column, clog *CommitLog) CarvedRow {
+	return CarvedRow{
+		Block:      block,
+		Offset:     c.offset,
+		Length:     c.length,
+		Xmin:       c.tuple.Header.Xmin,
+		Xmax:       c.tuple.Header.Xmax,
+		Confidence: carveConfidence(c.tuple, block, row, columns, clog),
+		Row:        row,
+	}
+}
+
+// carvePage finds the tuples in the byte ranges of page that no live line
+// pointer covers
+func carvePage(page []byte, columns []Column) []carvedTuple {
+	if len(page) < PageSize {
+		return nil
+	}
+	h := parseHeader(page)
+	if !validHeader(h) {
+		return nil
+	}
+	end := int(u16(page, 16)) // pd_special
+	if end > PageSize || end < int(h.Upper) {
+		end = PageSize
+	}
+
+	var live [][2]int
+	for _, item := range parseItems(page, h) {
+		if item.Flags == lpNormal && item.Length > 0 && item.Offset+item.Length <= end {
+			live = append(live, [2]int{item.Offset, item.Offset + item.Length})
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i][0] < live[j][0] })
+
+	var found []carvedTuple
+	from := int(h.Lower)
+	for _, r := range append(live, [2]int{end, end}) {
+		found = append(found, carveRange(page, from, r[0], columns)...)
+		if r[1] > from {
+			from = r[1]
+		}
+	}
+	return found
+}
+
+// carveRange finds the tuples between offsets from and to of page. Tuples
+// start MAXALIGNed, so only every eighth byte is tried.
+func carveRange(page []byte, from, to int, columns []Column) []carvedTuple {
+	var found []carvedTuple
+	for off := align(from, 8); off+minHeapTupleSize <= to; {
+		t, n := carveTuple(page[off:to], columns)
+		if t == nil {
+			off += 8
+			continue
+		}
+		found = append(found, carvedTuple{offset: off, length: n, tuple: t})
+		off = align(off+n, 8)
+	}
+	return found
+}
+
+// carveTuple reads a tuple of the table at the start of data, with its
+// length, or nil if the bytes there cannot be one
+func carveTuple(data []byte, columns []Column) (*HeapTupleData, int) {
+	infomask, infomask2 := u16(data, 20), u16(data, 18)
+	natts := int(infomask2 & 0x07FF)
+	if natts == 0 || natts > maxAttNum(columns) || infomask2&0x1800 != 0 {
+		return nil, 0
+	}
+
+	// t_hoff is exactly the header, the null bitmap and a pre-12 OID,
+	// MAXALIGNed and padded with zeroes
+	pad := tupleHeaderSize
+	if infomask&0x0001 != 0 {
+		pad += (natts + 7) / 8
+	}
+	oid := 0
+	if infomask&0x0008 != 0 {
+		oid = 4
+	}
+	hoff := int(data[22])
+	if hoff != align(pad+oid, 8) || hoff > len(data) || !zeroes(data[pad:hoff-oid]) {
+		return nil, 0
+	}
+
+	// xmin is a normal or the frozen XID, ctid a line pointer number
+	off := u16(data, 16)
+	if u32(data, 0) < 2 || off == 0 || off > maxHeapTuplesPerPage {
+		return nil, 0
+	}
+
+	t := ParseHeapTuple(data)
+	n, ok := carveLength(t, columns)
+	if !ok {
+		return nil, 0
+	}
+	t.Data = t.Data[:n]
+	return t, hoff + n
+}
+
+// carveLength walks the values of a carved tuple as decodeTuple reads
+// them and returns the length of its data, or false if a value runs past
+// it, is malformed, or is preceded by padding that is not zeroes
+func carveLength(t *HeapTupleData, columns []Column) (int, bool) {
+	data := t.Data
+	offset := 0
+	for idx, col := range columns {
+		num := col.Num
+		if num == 0 {
+			num = idx + 1
+		}
+		if num > t.Header.Natts || t.IsNull(num) {
+			continue
+		}
+
+		colAlign := alignFromChar(col.Align)
+		if colAlign == 0 {
+			colAlign = typeAlign(col.TypID, col.Len)
+		}
+		if col.Len == -1 && offset < len(data) && (isShortVarlena(data[offset:]) || data[offset] == 0x01) {
+			colAlign = 1
+		}
+		start := align(offset, colAlign)
+		if start >= len(data) || !zeroes(data[offset:start]) {
+			return 0, false
+		}
+		offset = start
+
+		switch {
+		case col.Len > 0:
+			offset += col.Len
+		case col.Len == -1:
+			n := varlenaSize(data[offset:])
+			if n == 0 {
+				return 0, false
+			}
+			offset += n
+		default: // C string
+			n := bytes.IndexByte(data[offset:], 0)
+			if n < 0 {
+				return 0, false
+			}
+			offset += n + 1
+		}
+		if offset > len(data) {
+			return 0, false
+		}
+	}
+	return offset, true
+}
+
+// varlenaSize returns the size of the varlena at the start of data, 0 if
+// its header is malformed or it runs past data
+func varlenaSize(data []byte) int {
+	first := data[0]
+	switch {
+	case first == 0x01: // TOAST pointer, always on disk (VARTAG_ONDISK)
+		if len(data) < toastPointerSize || data[1] != 18 {
+			return 0
+		}
+		return toastPointerSize
+	case first&1 == 1: // 1-byte header
+		n := int(first >> 1)
+		if n > len(data) {
+			return 0
+		}
+		return n
+	}
+	if len(data) < 4 {
+		return 0
+	}
+	header := u32(data, 0)
+	n := int(header >> 2)
+	if n < 4 || n > len(data) {
+		return 0
+	}
+	// Compressed inline: neither pglz nor lz4 shrinks data more than 255
+	// times, which keeps garbage from asking for huge buffers
+	if header&2 != 0 {
+		if n < 8 || int(u32(data, 4)&0x3FFFFFFF) > 255*(n-8) {
+			return 0
+		}
+	}
+	return n
+}
+
+// maxAttNum is the highest attribute number of columns, the most a tuple
+// of the table can hold: dropped columns keep their numbers
+func maxAttNum(columns []Column) int {
+	n := 0
+	for idx, col := range columns {
+		num := col.Num
+		if num == 0 {
+			num = idx + 1
+		}
+		if num > n {
+			n = num
+		}
+	}
+	return n
+}
+
+func zeroes(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// carveConfidence scores a carved tuple, well-formed but maybe garbage
+// that happens to look like a tuple, by the share of these it passes:
+//   - it holds every column, so it was written after the last ADD COLUMN
+//   - its ctid points to its own page, as deleted and HOT-updated rows do
+//   - the transaction that inserted it committed
+//   - xmax, if set, comes after xmin
+//   - its text has no control characters or invalid UTF-8 left after
+//     conversion
+func carveConfidence(t *HeapTupleData, block uint32, row Row, columns []Column, clog *CommitLog) float64 {
+	h := t.Header
+	checks := []bool{
+		h.Natts == maxAttNum(columns),
+		h.Ctid.Block == block,
+		t.XminStatus(clog) == TxCommitted,
+		h.Xmax == 0 || h.Infomask&heapXmaxIsMulti != 0 || !xidPrecedes(h.Xmax, t.orderXmin()),
+		cleanText(row),
+	}
+	passed := 0
+	for _, ok := range checks {
+		if ok {
+			passed++
+		}
+	}
+	return float64(passed) / float64(len(checks))
+}
+
+// cleanText reports whether the strings of a row are valid UTF-8 without
+// control characters other than tabs and line breaks
+func cleanText(row Row) bool {
+	for _, v := range row.Values {
+		if s, ok := v.(string); ok && !cleanString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func cleanString(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// carvedRows reads the iterator's pages again for the tuples left in
+// their free space, decoded and converted like its live rows. Of a
+// relation file with a free space map, only the blocks the map leaves to
+// carve are.
+func (it *RowIterator) carvedRows() ([]CarvedRow, error) {
+	if !it.streaming() {
+		return nil, nil
+	}
+	var fsm *FreeSpaceMap
+	if rel, ok := it.src.(*RelationFile); ok {
+		fsm = readFreeSpaceMap(rel.path, int(rel.segSize))
+	}
+	it.Reset()
+	var carved []CarvedRow
+	for page := it.readPage(); page != nil; page = it.readPage() {
+		off := int(it.off - PageSize)
+		block := uint32(off / PageSize)
+		if !fsm.Carve(block) {
+			continue
+		}
+		for _, c := range carvePage(page, it.columns) {
+			row := it.entryRow(TupleEntry{Tuple: c.tuple, PageOffset: off})
+			carved = append(carved, newCarvedRow(c, block, row, it.columns, it.dec.clog))
+		}
+	}
+	return carved, it.err
+}
+
+// ScanCarvedRows carves the pages of the tables opts selects, returning
+// the tables some rows were recovered from
+func ScanCarvedRows(dataDir string, opts *Options) ([]TableCarve, error) {
+	return ScanCarvedRowsContext(context.Background(), dataDir, opts)
+}
+
+// ScanCarvedRowsContext is ScanCarvedRows stopping early with ctx's error
+// once ctx is done
+func ScanCarvedRowsContext(ctx context.Context, dataDir string, opts *Options) ([]TableCarve, error) {
+	o := *withDefaults(opts)
+	o.Workers, o.ListOnly = 0, false
+	w := &carveWriter{}
+	if err := StreamDataDirContext(ctx, dataDir, &o, w); err != nil {
+		return nil, err
+	}
+	return w.tables, nil
+}
+
+// carveWriter collects the carved rows of a streamed dump
+type carveWriter struct {
+	tables []TableCarve
+}
+
+func (c *carveWriter) BeginDatabase(*DatabaseDump) error { return nil }
+
+func (c *carveWriter) WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	carved, err := rows.carvedRows()
+	if err != nil {
+		return err
+	}
+	if len(carved) > 0 {
+		c.tables = append(c.tables, TableCarve{Database: db.Name, Table: t.QualifiedName(), Rows: carved})
+	}
+	return nil
+}
+
+func (c *carveWriter) EndDatabase(*DatabaseDump) error { return nil }
+
+func (c *carveWriter) Close() error { return nil }
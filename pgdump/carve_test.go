@@ -0,0 +1,86 @@
+package pgdump
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCarveHeapPage(t *testing.T) {
+	committed := func(tup []byte) []byte {
+		putU16(tup, 20, u16(tup, 20)|0x0100)
+		return tup
+	}
+	page := testHeapPage(
+		committed(testVersion(100, 0, ItemPointer{Offset: 1}, 0, 1, 10)),
+		committed(testVersion(100, 101, ItemPointer{Offset: 2}, 0, 2, 20)),
+		committed(testVersion(100, 0, ItemPointer{Offset: 3}, 0, 3, 30)),
+	)
+	removed := int(u16(page, headerSize+4) & 0x7FFF)
+	putU32(page, headerSize+4, 0) // VACUUM freed line pointer 2
+
+	// Free space: an old tuple moved away from, with its ctid on another
+	// page, and the same bytes with t_hoff broken
+	copy(page[64:], testVersion(90, 0, ItemPointer{Block: 7, Offset: 4}, 0, 4, 40))
+	broken := testVersion(90, 0, ItemPointer{Offset: 5}, 0, 5, 50)
+	broken[22] = 28
+	copy(page[128:], broken)
+
+	want := []CarvedRow{
+		{Offset: 64, Length: 32, Xmin: 90, Confidence: 0.6, Row: testRow("id", int32(4), "v", int32(40))},
+		{Offset: removed, Length: 32, Xmin: 100, Xmax: 101, Confidence: 1, Row: testRow("id", int32(2), "v", int32(20))},
+	}
+	if got := CarveHeapPage(page, 0, testHistoryColumns); !reflect.DeepEqual(got, want) {
+		t.Errorf("CarveHeapPage =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Through the iterator, on the page's block in the relation
+	it := newRowIterator(bytes.NewReader(append(make([]byte, PageSize), page...)), testHistoryColumns, &rowDecoder{}, nil, nil)
+	carved, err := it.carvedRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carved) != 2 || carved[1].Block != 1 || carved[1].Confidence != 0.8 || !reflect.DeepEqual(carved[1].Row, want[1].Row) {
+		t.Errorf("carvedRows = %+v", carved)
+	}
+
+	// Of a relation file, only the blocks its FSM records free space for
+	dir := t.TempDir()
+	fsm := make([]byte, 3*PageSize)
+	fsm[2*PageSize+fsmPageDataOffset+fsmNonLeafNodes+1] = 64
+	testWriteFile(t, dir, "16385", append(append([]byte{}, page...), page...))
+	testWriteFile(t, dir, "16385_fsm", fsm)
+	rel, err := OpenRelation(filepath.Join(dir, "16385"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rel.Close()
+	carved, err = newRowIterator(rel, testHistoryColumns, &rowDecoder{}, nil, nil).carvedRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carved) != 2 || carved[0].Block != 1 || carved[1].Block != 1 {
+		t.Errorf("carvedRows with an FSM = %+v", carved)
+	}
+
+	// Tuples with more attributes than the table has are not carved, and
+	// text with stray control characters lowers the confidence
+	if got := CarveHeapPage(page, 0, testHistoryColumns[:1]); len(got) != 0 {
+		t.Errorf("CarveHeapPage with one column = %+v", got)
+	}
+	if cleanText(testRow("s", "a\x00b")) || !cleanText(testRow("s", "a\tb\n")) {
+		t.Error("cleanText")
+	}
+
+	// xmax comes after xmin modulo 2^32
+	row := testRow("id", int32(1), "v", int32(10))
+	wrapped := ParseHeapTuple(committed(testVersion(4294967000, 510, ItemPointer{Offset: 1}, 0, 1, 10)))
+	backwards := ParseHeapTuple(committed(testVersion(510, 4294967000, ItemPointer{Offset: 1}, 0, 1, 10)))
+	if got := carveConfidence(wrapped, 0, row, testHistoryColumns, nil); got != 1 {
+		t.Errorf("confidence across wraparound = %v, want 1", got)
+	}
+	if got := carveConfidence(backwards, 0, row, testHistoryColumns, nil); got != 0.8 {
+		t.Errorf("confidence with xmax before xmin = %v, want 0.8", got)
+	}
+}
@@ -1,6 +1,9 @@
 package pgdump
 
-import "sort"
+import (
+	"sort"
+	"strings"
+)
 
 // System catalog OIDs (fixed in all PostgreSQL versions)
 const (
@@ -8,6 +11,7 @@ const (
 	PGAuthID    = 1260 // pg_authid - users/passwords (global)
 	PGClass     = 1259 // pg_class - tables/indexes
 	PGAttribute = 1249 // pg_attribute - table columns
+	PGNamespace = 2615 // pg_namespace - schemas
 )
 
 // Column defines a table column for decoding
@@ -17,13 +21,18 @@ type Column struct {
 	Len   int
 	Num   int
 	Align byte // 'c'=1, 's'=2, 'i'=4, 'd'=8
+
+	// Missing is returned for an attribute past the tuple's natts, i.e. a
+	// column added with a default after the row was written
+	Missing interface{}
 }
 
 // DatabaseInfo represents a database entry
 type DatabaseInfo struct {
-	OID      uint32
-	Name     string
-	Encoding int
+	OID        uint32
+	Name       string
+	Encoding   int
+	Tablespace uint32 // dattablespace (0 if it could not be decoded)
 }
 
 // TableInfo represents a table entry
@@ -31,6 +40,15 @@ type TableInfo struct {
 	OID, Filenode uint32
 	Name, Kind    string
 	ToastRelID    uint32
+	Tablespace    uint32 // reltablespace, 0 = database default
+	Namespace     uint32 // relnamespace (pg_namespace OID)
+	Schema        string // resolved namespace name, empty if unknown
+	AccessMethod  uint32 // relam, the pg_am entry of an index
+}
+
+// QualifiedName returns schema.name, or just the name if the schema is unknown
+func (t TableInfo) QualifiedName() string {
+	return qualifiedName(t.Schema, t.Name)
 }
 
 // AttrInfo represents a column attribute
@@ -40,15 +58,58 @@ type AttrInfo struct {
 	Num   int
 	Len   int
 	Align byte // 'c'=1, 's'=2, 'i'=4, 'd'=8
+
+	TypMod int // atttypmod, -1 if the type has no modifier
+	NDims  int // attndims, declared array dimensions
+
+	NotNull   bool // attnotnull
+	Generated byte // attgenerated: 's' for a stored generated column, 0 otherwise
+
+	HasMissing bool        // atthasmissing: rows older than the column use Missing
+	Missing    interface{} // attmissingval, the fast default (nil = NULL)
+}
+
+// attrColumns converts pg_attribute entries to a decoding schema
+func attrColumns(attrs []AttrInfo) []Column {
+	cols := make([]Column, len(attrs))
+	for i, a := range attrs {
+		cols[i] = Column{Name: a.Name, TypID: a.TypID, Len: a.Len, Num: a.Num, Align: a.Align, Missing: a.Missing}
+	}
+	return cols
 }
 
 // Predefined schemas for system catalogs
 var (
-	schemaPGDatabase = []Column{
+	// PostgreSQL 12-14 pg_database, up to dattablespace
+	schemaPGDatabaseV14 = []Column{
 		{Name: "oid", TypID: OidOid, Len: 4},
 		{Name: "datname", TypID: OidName, Len: 64},
 		{Name: "datdba", TypID: OidOid, Len: 4},
 		{Name: "encoding", TypID: OidInt4, Len: 4},
+		{Name: "datcollate", TypID: OidName, Len: 64},
+		{Name: "datctype", TypID: OidName, Len: 64},
+		{Name: "datistemplate", TypID: OidBool, Len: 1},
+		{Name: "datallowconn", TypID: OidBool, Len: 1},
+		{Name: "datconnlimit", TypID: OidInt4, Len: 4},
+		{Name: "datlastsysoid", TypID: OidOid, Len: 4},
+		{Name: "datfrozenxid", TypID: OidXid, Len: 4},
+		{Name: "datminmxid", TypID: OidXid, Len: 4},
+		{Name: "dattablespace", TypID: OidOid, Len: 4},
+	}
+
+	// PostgreSQL 15+ pg_database, up to dattablespace (collations became text)
+	schemaPGDatabaseV15 = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "datname", TypID: OidName, Len: 64},
+		{Name: "datdba", TypID: OidOid, Len: 4},
+		{Name: "encoding", TypID: OidInt4, Len: 4},
+		{Name: "datlocprovider", TypID: OidChar, Len: 1},
+		{Name: "datistemplate", TypID: OidBool, Len: 1},
+		{Name: "datallowconn", TypID: OidBool, Len: 1},
+		{Name: "datconnlimit", TypID: OidInt4, Len: 4},
+		{Name: "datfrozenxid", TypID: OidXid, Len: 4},
+		{Name: "datminmxid", TypID: OidXid, Len: 4},
+		{Name: "dattablespace", TypID: OidOid, Len: 4},
 	}
 
 	schemaPGClass = []Column{
@@ -71,22 +132,118 @@ var (
 		{Name: "relkind", TypID: OidChar, Len: 1},
 	}
 
-	// PostgreSQL 12-15 pg_attribute structure
-	schemaPGAttrV15 = []Column{
+	schemaPGNamespace = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "nspname", TypID: OidName, Len: 64},
+		{Name: "nspowner", TypID: OidOid, Len: 4},
+	}
+
+	// PostgreSQL 12-13 pg_attribute structure
+	schemaPGAttrV12 = append([]Column{
+		{Name: "attrelid", TypID: OidOid, Len: 4},
+		{Name: "attname", TypID: OidName, Len: 64},
+		{Name: "atttypid", TypID: OidOid, Len: 4},
+		{Name: "attstattarget", TypID: OidInt4, Len: 4},
+		{Name: "attlen", TypID: OidInt2, Len: 2},
+		{Name: "attnum", TypID: OidInt2, Len: 2},
+		{Name: "attndims", TypID: OidInt4, Len: 4},
+		{Name: "attcacheoff", TypID: OidInt4, Len: 4},
+		{Name: "atttypmod", TypID: OidInt4, Len: 4},
+		{Name: "attbyval", TypID: OidBool, Len: 1},
+		{Name: "attstorage", TypID: OidChar, Len: 1},
+		{Name: "attalign", TypID: OidChar, Len: 1},
+		{Name: "attnotnull", TypID: OidBool, Len: 1},
+		{Name: "atthasdef", TypID: OidBool, Len: 1},
+		{Name: "atthasmissing", TypID: OidBool, Len: 1},
+		{Name: "attidentity", TypID: OidChar, Len: 1},
+		{Name: "attgenerated", TypID: OidChar, Len: 1},
+		{Name: "attisdropped", TypID: OidBool, Len: 1},
+		{Name: "attislocal", TypID: OidBool, Len: 1},
+		{Name: "attinhcount", TypID: OidInt4, Len: 4},
+		{Name: "attcollation", TypID: OidOid, Len: 4},
+	}, schemaPGAttrVarlena...)
+
+	// PostgreSQL 14-15 pg_attribute structure (attcompression added)
+	schemaPGAttrV14 = append([]Column{
 		{Name: "attrelid", TypID: OidOid, Len: 4},
 		{Name: "attname", TypID: OidName, Len: 64},
 		{Name: "atttypid", TypID: OidOid, Len: 4},
 		{Name: "attstattarget", TypID: OidInt4, Len: 4},
 		{Name: "attlen", TypID: OidInt2, Len: 2},
 		{Name: "attnum", TypID: OidInt2, Len: 2},
+		{Name: "attndims", TypID: OidInt4, Len: 4},
+		{Name: "attcacheoff", TypID: OidInt4, Len: 4},
+		{Name: "atttypmod", TypID: OidInt4, Len: 4},
+		{Name: "attbyval", TypID: OidBool, Len: 1},
+		{Name: "attalign", TypID: OidChar, Len: 1},
+		{Name: "attstorage", TypID: OidChar, Len: 1},
+		{Name: "attcompression", TypID: OidChar, Len: 1},
+		{Name: "attnotnull", TypID: OidBool, Len: 1},
+		{Name: "atthasdef", TypID: OidBool, Len: 1},
+		{Name: "atthasmissing", TypID: OidBool, Len: 1},
+		{Name: "attidentity", TypID: OidChar, Len: 1},
+		{Name: "attgenerated", TypID: OidChar, Len: 1},
+		{Name: "attisdropped", TypID: OidBool, Len: 1},
+		{Name: "attislocal", TypID: OidBool, Len: 1},
+		{Name: "attinhcount", TypID: OidInt4, Len: 4},
+		{Name: "attcollation", TypID: OidOid, Len: 4},
+	}, schemaPGAttrVarlena...)
+
+	// PostgreSQL 16 pg_attribute structure (attstattarget, attndims and
+	// attinhcount shrunk to int2)
+	schemaPGAttrV16 = append([]Column{
+		{Name: "attrelid", TypID: OidOid, Len: 4},
+		{Name: "attname", TypID: OidName, Len: 64},
+		{Name: "atttypid", TypID: OidOid, Len: 4},
+		{Name: "attlen", TypID: OidInt2, Len: 2},
+		{Name: "attnum", TypID: OidInt2, Len: 2},
+		{Name: "attcacheoff", TypID: OidInt4, Len: 4},
 		{Name: "atttypmod", TypID: OidInt4, Len: 4},
 		{Name: "attndims", TypID: OidInt2, Len: 2},
 		{Name: "attbyval", TypID: OidBool, Len: 1},
 		{Name: "attalign", TypID: OidChar, Len: 1},
-	}
+		{Name: "attstorage", TypID: OidChar, Len: 1},
+		{Name: "attcompression", TypID: OidChar, Len: 1},
+		{Name: "attnotnull", TypID: OidBool, Len: 1},
+		{Name: "atthasdef", TypID: OidBool, Len: 1},
+		{Name: "atthasmissing", TypID: OidBool, Len: 1},
+		{Name: "attidentity", TypID: OidChar, Len: 1},
+		{Name: "attgenerated", TypID: OidChar, Len: 1},
+		{Name: "attisdropped", TypID: OidBool, Len: 1},
+		{Name: "attislocal", TypID: OidBool, Len: 1},
+		{Name: "attinhcount", TypID: OidInt2, Len: 2},
+		{Name: "attstattarget", TypID: OidInt2, Len: 2},
+		{Name: "attcollation", TypID: OidOid, Len: 4},
+	}, schemaPGAttrVarlena...)
+
+	// PostgreSQL 17 pg_attribute structure (attstattarget became nullable)
+	schemaPGAttrV17 = append([]Column{
+		{Name: "attrelid", TypID: OidOid, Len: 4},
+		{Name: "attname", TypID: OidName, Len: 64},
+		{Name: "atttypid", TypID: OidOid, Len: 4},
+		{Name: "attlen", TypID: OidInt2, Len: 2},
+		{Name: "attnum", TypID: OidInt2, Len: 2},
+		{Name: "attcacheoff", TypID: OidInt4, Len: 4},
+		{Name: "atttypmod", TypID: OidInt4, Len: 4},
+		{Name: "attndims", TypID: OidInt2, Len: 2},
+		{Name: "attbyval", TypID: OidBool, Len: 1},
+		{Name: "attalign", TypID: OidChar, Len: 1},
+		{Name: "attstorage", TypID: OidChar, Len: 1},
+		{Name: "attcompression", TypID: OidChar, Len: 1},
+		{Name: "attnotnull", TypID: OidBool, Len: 1},
+		{Name: "atthasdef", TypID: OidBool, Len: 1},
+		{Name: "atthasmissing", TypID: OidBool, Len: 1},
+		{Name: "attidentity", TypID: OidChar, Len: 1},
+		{Name: "attgenerated", TypID: OidChar, Len: 1},
+		{Name: "attisdropped", TypID: OidBool, Len: 1},
+		{Name: "attislocal", TypID: OidBool, Len: 1},
+		{Name: "attinhcount", TypID: OidInt2, Len: 2},
+		{Name: "attcollation", TypID: OidOid, Len: 4},
+		{Name: "attstattarget", TypID: OidInt2, Len: 2},
+	}, schemaPGAttrVarlena...)
 
-	// PostgreSQL 16+ pg_attribute structure (attstattarget removed)
-	schemaPGAttrV16 = []Column{
+	// PostgreSQL 18+ pg_attribute structure (attcacheoff removed)
+	schemaPGAttrV18 = append([]Column{
 		{Name: "attrelid", TypID: OidOid, Len: 4},
 		{Name: "attname", TypID: OidName, Len: 64},
 		{Name: "atttypid", TypID: OidOid, Len: 4},
@@ -96,95 +253,233 @@ var (
 		{Name: "attndims", TypID: OidInt2, Len: 2},
 		{Name: "attbyval", TypID: OidBool, Len: 1},
 		{Name: "attalign", TypID: OidChar, Len: 1},
+		{Name: "attstorage", TypID: OidChar, Len: 1},
+		{Name: "attcompression", TypID: OidChar, Len: 1},
+		{Name: "attnotnull", TypID: OidBool, Len: 1},
+		{Name: "atthasdef", TypID: OidBool, Len: 1},
+		{Name: "atthasmissing", TypID: OidBool, Len: 1},
+		{Name: "attidentity", TypID: OidChar, Len: 1},
+		{Name: "attgenerated", TypID: OidChar, Len: 1},
+		{Name: "attisdropped", TypID: OidBool, Len: 1},
+		{Name: "attislocal", TypID: OidBool, Len: 1},
+		{Name: "attinhcount", TypID: OidInt2, Len: 2},
+		{Name: "attcollation", TypID: OidOid, Len: 4},
+		{Name: "attstattarget", TypID: OidInt2, Len: 2},
+	}, schemaPGAttrVarlena...)
+
+	// Nullable pg_attribute columns, present in every version
+	schemaPGAttrVarlena = []Column{
+		{Name: "attacl", TypID: 1034, Len: -1}, // aclitem[]
+		{Name: "attoptions", TypID: 1009, Len: -1},
+		{Name: "attfdwoptions", TypID: 1009, Len: -1},
+		{Name: "attmissingval", TypID: OidAnyArray, Len: -1, Align: 'd'},
 	}
 )
 
 // ParsePGDatabase extracts database list from pg_database heap file
 func ParsePGDatabase(data []byte) []DatabaseInfo {
 	var result []DatabaseInfo
-	for _, row := range ReadRows(data, schemaPGDatabase, true) {
+	for _, e := range ReadTuples(data, true) {
+		row := DecodeTuple(e.Tuple, pgDatabaseSchema(e.Tuple.Data))
 		if oid, name := getOID(row, "oid"), getString(row, "datname"); oid > 0 && name != "" {
-			result = append(result, DatabaseInfo{OID: oid, Name: name, Encoding: toInt(row["encoding"])})
+			result = append(result, DatabaseInfo{
+				OID:        oid,
+				Name:       name,
+				Encoding:   toInt(row["encoding"]),
+				Tablespace: getOID(row, "dattablespace"),
+			})
 		}
 	}
 	return result
 }
 
+// pgDatabaseSchema picks the pg_database layout of a tuple. From PG15 the
+// byte after encoding is datlocprovider ('c', 'i' or 'b') followed by two
+// bools; before that it starts the datcollate name.
+func pgDatabaseSchema(data []byte) []Column {
+	if len(data) > 78 && strings.IndexByte("cib", data[76]) >= 0 && data[77] <= 1 && data[78] <= 1 {
+		return schemaPGDatabaseV15
+	}
+	return schemaPGDatabaseV14
+}
+
 // ParsePGClass extracts table info from pg_class heap file
 func ParsePGClass(data []byte) map[uint32]TableInfo {
 	tables := make(map[uint32]TableInfo)
 	for _, row := range ReadRows(data, schemaPGClass, true) {
-		if fn := getOID(row, "relfilenode"); fn > 0 {
-			tables[fn] = TableInfo{
-				OID:        getOID(row, "oid"),
-				Name:       getString(row, "relname"),
-				Filenode:   fn,
-				Kind:       getString(row, "relkind"),
-				ToastRelID: getOID(row, "reltoastrelid"),
-			}
+		if info := classInfo(row); info.Filenode > 0 {
+			tables[info.Filenode] = info
 		}
 	}
 	return tables
 }
 
+// classInfo converts a decoded pg_class row. Mapped catalogs have no
+// relfilenode, so their Filenode is 0.
+func classInfo(row map[string]interface{}) TableInfo {
+	return TableInfo{
+		OID:        getOID(row, "oid"),
+		Name:       getString(row, "relname"),
+		Filenode:   getOID(row, "relfilenode"),
+		Kind:       getString(row, "relkind"),
+		ToastRelID: getOID(row, "reltoastrelid"),
+		Tablespace: getOID(row, "reltablespace"),
+		Namespace:  getOID(row, "relnamespace"),
+
+		AccessMethod: getOID(row, "relam"),
+	}
+}
+
+// sortTables orders tables by schema and name, so dumps come out the same
+// from one run to the next
+func sortTables(tables []TableInfo) {
+	sort.Slice(tables, func(i, j int) bool {
+		a, b := tables[i], tables[j]
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.OID < b.OID
+	})
+}
+
+// ParsePGNamespace extracts schema names from pg_namespace heap file, keyed by OID
+func ParsePGNamespace(data []byte) map[uint32]string {
+	namespaces := make(map[uint32]string)
+	for _, row := range ReadRows(data, schemaPGNamespace, true) {
+		if oid, name := getOID(row, "oid"), getString(row, "nspname"); oid > 0 && name != "" {
+			namespaces[oid] = name
+		}
+	}
+	return namespaces
+}
+
+// resolveSchemas fills TableInfo.Schema from a pg_namespace OID-to-name map
+func resolveSchemas(tables map[uint32]TableInfo, namespaces map[uint32]string) {
+	for fn, t := range tables {
+		t.Schema = namespaces[t.Namespace]
+		tables[fn] = t
+	}
+}
+
+// isSystemSchema reports whether a schema holds PostgreSQL's own catalogs
+func isSystemSchema(name string) bool {
+	return name == "pg_catalog" || name == "information_schema" || strings.HasPrefix(name, "pg_toast") || strings.HasPrefix(name, "pg_temp")
+}
+
+// catalogFilenode returns the filenode of a non-mapped catalog as recorded
+// in pg_class, falling back to its OID (the filenode it was created with).
+func catalogFilenode(oidToFilenode map[uint32]uint32, oid uint32) uint32 {
+	if fn, ok := oidToFilenode[oid]; ok {
+		return fn
+	}
+	return oid
+}
+
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
 // ParsePGAttribute extracts column info from pg_attribute heap file
 func ParsePGAttribute(data []byte, pgVersion int) map[uint32][]AttrInfo {
 	schema := detectAttrSchema(data, pgVersion)
 	result := make(map[uint32][]AttrInfo)
 
 	for _, row := range ReadRows(data, schema, true) {
-		relid, num := getOID(row, "attrelid"), toInt(row["attnum"])
-		if relid == 0 || num <= 0 {
+		relid, info := attrInfo(row)
+		if relid == 0 || info.Num <= 0 {
 			continue
 		}
-		
-		// Get alignment character ('c', 's', 'i', 'd')
-		var alignByte byte = 'i' // default to int alignment
-		if align := getString(row, "attalign"); len(align) > 0 {
-			alignByte = align[0]
-		}
-		
-		result[relid] = append(result[relid], AttrInfo{
-			Name:  getString(row, "attname"),
-			TypID: int(getOID(row, "atttypid")),
-			Num:   num,
-			Len:   toInt(row["attlen"]),
-			Align: alignByte,
-		})
+		result[relid] = append(result[relid], info)
 	}
 
 	// Sort by attnum
 	for relid := range result {
-		sort.Slice(result[relid], func(i, j int) bool {
-			return result[relid][i].Num < result[relid][j].Num
-		})
+		sortAttrs(result[relid])
 	}
 	return result
 }
 
+// attrInfo converts a decoded pg_attribute row, returning its attrelid
+func attrInfo(row map[string]interface{}) (uint32, AttrInfo) {
+	// Get alignment character ('c', 's', 'i', 'd')
+	var alignByte byte = 'i' // default to int alignment
+	if align := getString(row, "attalign"); len(align) > 0 {
+		alignByte = align[0]
+	}
+
+	info := AttrInfo{
+		Name:  getString(row, "attname"),
+		TypID: int(getOID(row, "atttypid")),
+		Num:   toInt(row["attnum"]),
+		Len:   toInt(row["attlen"]),
+		Align: alignByte,
+
+		TypMod: toInt(row["atttypmod"]),
+		NDims:  toInt(row["attndims"]),
+
+		NotNull:   getBool(row, "attnotnull"),
+		Generated: getChar(row, "attgenerated"),
+	}
+	if hasMissing, _ := row["atthasmissing"].(bool); hasMissing {
+		info.HasMissing = true
+		if vals, ok := row["attmissingval"].([]interface{}); ok && len(vals) > 0 {
+			info.Missing = vals[0]
+		}
+	}
+	return getOID(row, "attrelid"), info
+}
+
+func sortAttrs(attrs []AttrInfo) {
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Num < attrs[j].Num
+	})
+}
+
+// detectAttrSchema picks the pg_attribute layout from the version, or from
+// the first column of pg_class (oid, int4-aligned) if the version is unknown
 func detectAttrSchema(data []byte, version int) []Column {
-	if version >= 16 {
+	switch {
+	case version >= 18:
+		return schemaPGAttrV18
+	case version == 17:
+		return schemaPGAttrV17
+	case version == 16:
 		return schemaPGAttrV16
-	}
-	if version >= 12 {
-		return schemaPGAttrV15
+	case version >= 14:
+		return schemaPGAttrV14
+	case version >= 12:
+		return schemaPGAttrV12
 	}
 
-	// Auto-detect by trying V16 schema
-	rows := ReadRows(data, schemaPGAttrV16, true)
-	if len(rows) >= 5 {
-		match := true
-		for i := 0; i < 5; i++ {
-			if toInt(rows[i]["attnum"]) != i+1 {
-				match = false
-				break
+	for _, e := range ReadTuples(data, true) {
+		d := e.Tuple.Data
+		if len(d) < 104 || u32(d, 0) != PGClass {
+			continue
+		}
+		// PG12-15: attstattarget (int4) precedes attlen and attnum
+		if u16(d, 76) == 4 && u16(d, 78) == 1 {
+			if d[94] == 'i' {
+				return schemaPGAttrV12
 			}
+			return schemaPGAttrV14
 		}
-		if match {
-			return schemaPGAttrV16
+		if u16(d, 72) == 4 && u16(d, 74) == 1 {
+			switch {
+			case d[83] == 'i':
+				return schemaPGAttrV18
+			case u16(d, 100) == 0xFFFF: // attstattarget -1
+				return schemaPGAttrV16
+			}
+			return schemaPGAttrV17
 		}
 	}
-	return schemaPGAttrV15
+	return schemaPGAttrV14
 }
 
 func getOID(row map[string]interface{}, key string) uint32 {
@@ -200,3 +495,16 @@ func getString(row map[string]interface{}, key string) string {
 	}
 	return ""
 }
+
+func getBool(row map[string]interface{}, key string) bool {
+	v, _ := row[key].(bool)
+	return v
+}
+
+// getChar returns a "char" column, 0 if it is NULL or empty
+func getChar(row map[string]interface{}, key string) byte {
+	if s := getString(row, key); s != "" {
+		return s[0]
+	}
+	return 0
+}
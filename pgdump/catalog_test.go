@@ -0,0 +1,271 @@
+package pgdump
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testHeapTuple wraps user data in a 24-byte tuple header (no nulls, xmax invalid)
+func testHeapTuple(natts int, data []byte) []byte {
+	tup := make([]byte, 24+len(data))
+	putU16(tup, 18, uint16(natts))
+	putU16(tup, 20, 0x0800) // HEAP_XMAX_INVALID
+	tup[22] = 24
+	copy(tup[24:], data)
+	return tup
+}
+
+// testHeapPage lays tuples out on a single 8K heap page
+func testHeapPage(tuples ...[]byte) []byte {
+	page := make([]byte, PageSize)
+	upper := PageSize
+	for i, tup := range tuples {
+		upper = (upper - len(tup)) &^ 7
+		copy(page[upper:], tup)
+		putU32(page, headerSize+i*itemIDSize, uint32(upper)|1<<15|uint32(len(tup))<<17)
+	}
+	putU16(page, 12, uint16(headerSize+len(tuples)*itemIDSize))
+	putU16(page, 14, uint16(upper))
+	putU16(page, 16, PageSize)
+	putU16(page, 18, PageSize|4)
+	return page
+}
+
+// testWriteFile writes data to the slash-separated path rel under dir,
+// creating the directories on the way
+func testWriteFile(t *testing.T, dir, rel string, data []byte) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDeadTuple marks tup as inserted by xmin and deleted by xmax, both
+// committed
+func testDeadTuple(tup []byte, xmin, xmax uint32) []byte {
+	putU32(tup, 0, xmin)
+	putU32(tup, 4, xmax)
+	putU16(tup, 20, 0x0100|0x0400) // XMIN_COMMITTED | XMAX_COMMITTED
+	return tup
+}
+
+// testAbortedTuple marks tup as inserted by xmin, which aborted
+func testAbortedTuple(tup []byte, xmin uint32) []byte {
+	putU32(tup, 0, xmin)
+	putU16(tup, 20, 0x0200|0x0800) // XMIN_INVALID | XMAX_INVALID
+	return tup
+}
+
+// testCatalogDataDir lays out a data directory holding database app
+// (16384), whose pg_class and pg_attribute pages hold classes and attrs
+func testCatalogDataDir(t *testing.T, classes, attrs [][]byte) string {
+	dir := t.TempDir()
+	testWriteFile(t, dir, "global/1262", testHeapPage(testDatabaseRow(16384, "app", DefaultTablespace)))
+	testWriteFile(t, dir, "base/16384/pg_filenode.map", testRelMap(PGClass, PGClass, PGAttribute, PGAttribute))
+	testWriteFile(t, dir, "base/16384/1259", testHeapPage(classes...))
+	// pg_class's own oid column lets ParsePGAttribute detect the layout
+	attrs = append([][]byte{testAttrRow(PGClass, "oid", OidOid, 4, 1, nil)}, attrs...)
+	testWriteFile(t, dir, "base/16384/1249", testHeapPage(attrs...))
+	return dir
+}
+
+func testName(s string) []byte {
+	b := make([]byte, 64)
+	copy(b, s)
+	return b
+}
+
+func testNamespaceRow(oid uint32, name string) []byte {
+	row := make([]byte, 72)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, 10)
+	return testHeapTuple(3, row)
+}
+
+func testClassRow(oid uint32, name string, nsp, filenode uint32, kind byte) []byte {
+	return testClassRowIn(0, oid, name, nsp, filenode, kind)
+}
+
+// testClassRowIn builds a pg_class tuple with an explicit reltablespace
+func testClassRowIn(spc, oid uint32, name string, nsp, filenode uint32, kind byte) []byte {
+	row := make([]byte, 116)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, nsp)
+	putU32(row, 88, filenode)
+	putU32(row, 92, spc)
+	row[114] = 'p'
+	row[115] = kind
+	return testHeapTuple(17, row)
+}
+
+func TestParsePGNamespace(t *testing.T) {
+	data := testHeapPage(
+		testNamespaceRow(11, "pg_catalog"),
+		testNamespaceRow(2200, "public"),
+		testNamespaceRow(16390, "audit"),
+	)
+
+	nsp := ParsePGNamespace(data)
+	if len(nsp) != 3 {
+		t.Fatalf("expected 3 namespaces, got %d: %v", len(nsp), nsp)
+	}
+	if nsp[2200] != "public" || nsp[16390] != "audit" {
+		t.Errorf("unexpected namespaces: %v", nsp)
+	}
+}
+
+func TestParsePGClassNamespace(t *testing.T) {
+	data := testHeapPage(testClassRow(16384, "users", 16390, 16384, 'r'))
+
+	tables := ParsePGClass(data)
+	info, ok := tables[16384]
+	if !ok {
+		t.Fatalf("table not parsed: %v", tables)
+	}
+	if info.Namespace != 16390 {
+		t.Errorf("Namespace = %d, want 16390", info.Namespace)
+	}
+
+	resolveSchemas(tables, map[uint32]string{16390: "audit"})
+	if got := tables[16384].QualifiedName(); got != "audit.users" {
+		t.Errorf("QualifiedName = %q, want audit.users", got)
+	}
+}
+
+func TestCatalogFilenode(t *testing.T) {
+	if fn := catalogFilenode(map[uint32]uint32{PGNamespace: 16500}, PGNamespace); fn != 16500 {
+		t.Errorf("expected rewritten filenode 16500, got %d", fn)
+	}
+	if fn := catalogFilenode(nil, PGNamespace); fn != PGNamespace {
+		t.Errorf("expected fallback to OID, got %d", fn)
+	}
+}
+
+func TestDumpSchemaFilters(t *testing.T) {
+	classData := testHeapPage(
+		testClassRow(PGNamespace, "pg_namespace", 11, PGNamespace, 'r'),
+		testClassRow(16384, "users", 2200, 16384, 'r'),
+		testClassRow(16385, "users", 16390, 16385, 'r'),
+	)
+	nspData := testHeapPage(
+		testNamespaceRow(11, "pg_catalog"),
+		testNamespaceRow(2200, "public"),
+		testNamespaceRow(16390, "audit"),
+	)
+	reader := func(fn uint32) ([]byte, error) {
+		if fn == PGNamespace {
+			return nspData, nil
+		}
+		return nil, nil
+	}
+
+	names := func(opts *Options) []string {
+		dump, _ := DumpDatabaseFromFiles(classData, nil, reader, opts)
+		var out []string
+		for _, tbl := range dump.Tables {
+			out = append(out, tbl.QualifiedName())
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	tests := []struct {
+		opts *Options
+		want []string
+	}{
+		{&Options{SkipSystemTables: true}, []string{"audit.users", "public.users"}},
+		{&Options{SkipSystemTables: true, SchemaFilter: "audit"}, []string{"audit.users"}},
+		{&Options{SkipSystemTables: true, ExcludeSchema: "audit"}, []string{"public.users"}},
+	}
+	for _, tt := range tests {
+		got := names(tt.opts)
+		if len(got) != len(tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.opts, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%+v: got %v, want %v", tt.opts, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// testAttrRow builds a pg_attribute tuple in the PG16 layout. A non-nil
+// missing is stored as attmissingval (a short varlena array) with the other
+// nullable columns NULL.
+func testAttrRow(relid uint32, name string, typid uint32, attlen, num int16, missing []byte) []byte {
+	row := make([]byte, 108, 108+len(missing))
+	putU32(row, 0, relid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, typid)
+	putU16(row, 72, uint16(attlen))
+	putU16(row, 74, uint16(num))
+	putU32(row, 76, 0xFFFFFFFF) // attcacheoff
+	putU32(row, 80, 0xFFFFFFFF) // atttypmod
+	row[86] = 1
+	row[87] = 'i'
+	row[88] = 'p'
+	putU16(row, 100, 0xFFFF) // attstattarget
+	if missing == nil {
+		return testHeapTuple(22, row)
+	}
+	row[92] = 1 // atthasmissing
+	row = append(row, missing...)
+
+	// 26 attributes: the 22 fixed ones, NULL attacl/attoptions/attfdwoptions, attmissingval
+	tup := make([]byte, 32+len(row))
+	putU16(tup, 18, 26)
+	putU16(tup, 20, 0x0800|0x0001) // HEAP_XMAX_INVALID | HEAP_HASNULL
+	tup[22] = 32
+	copy(tup[23:], []byte{0xFF, 0xFF, 0x3F, 0x02})
+	copy(tup[32:], row)
+	return tup
+}
+
+func TestFastDefaultColumn(t *testing.T) {
+	// '{5}'::int4[] as a short varlena
+	missing := make([]byte, 25)
+	missing[0] = 25<<1 | 1
+	putU32(missing, 1, 1)       // ndim
+	putU32(missing, 9, OidInt4) // elemtype
+	putU32(missing, 13, 1)      // dims
+	putU32(missing, 17, 1)      // lbound
+	putU32(missing, 21, 5)
+
+	attrData := testHeapPage(
+		testAttrRow(PGClass, "oid", OidOid, 4, 1, nil),
+		testAttrRow(16384, "id", OidInt4, 4, 1, nil),
+		testAttrRow(16384, "status", OidInt4, 4, 2, missing),
+		testAttrRow(16384, "note", OidText, -1, 3, nil),
+	)
+
+	attrs := ParsePGAttribute(attrData, 0)[16384]
+	if len(attrs) != 3 {
+		t.Fatalf("expected 3 attributes, got %+v", attrs)
+	}
+	if !attrs[1].HasMissing || attrs[1].Missing != int32(5) {
+		t.Errorf("status: HasMissing=%v Missing=%v, want true 5", attrs[1].HasMissing, attrs[1].Missing)
+	}
+	if attrs[2].HasMissing {
+		t.Error("note should not have a missing value")
+	}
+
+	// A row written before status and note were added
+	rows := ReadRows(testHeapPage(testHeapTuple(1, []byte{7, 0, 0, 0})), attrColumns(attrs), true)
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if rows[0]["id"] != int32(7) || rows[0]["status"] != int32(5) || rows[0]["note"] != nil {
+		t.Errorf("unexpected row: %v", rows[0])
+	}
+}
@@ -1,6 +1,7 @@
 package pgdump
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"os"
@@ -105,6 +106,12 @@ func VerifyFileChecksums(data []byte, segmentNumber uint32) *FileChecksumResult
 
 // VerifyDataDirChecksums verifies checksums for entire data directory
 func VerifyDataDirChecksums(dataDir string) (*DataDirChecksumResult, error) {
+	return VerifyDataDirChecksumsContext(context.Background(), dataDir, 1)
+}
+
+// VerifyDataDirChecksumsContext is VerifyDataDirChecksums verifying up to
+// workers files at once, and stopping early with ctx's error once ctx is done
+func VerifyDataDirChecksumsContext(ctx context.Context, dataDir string, workers int) (*DataDirChecksumResult, error) {
 	result := &DataDirChecksumResult{
 		DataDir: dataDir,
 	}
@@ -122,6 +129,7 @@ func VerifyDataDirChecksums(dataDir string) (*DataDirChecksumResult, error) {
 		return nil, fmt.Errorf("cannot read base directory: %w", err)
 	}
 	
+	var paths []string
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -143,43 +151,52 @@ func VerifyDataDirChecksums(dataDir string) (*DataDirChecksumResult, error) {
 				continue
 			}
 			
-			// Check if it's a numeric filenode
+			// Relation files of every fork: main, _fsm, _vm and _init,
+			// and their extra segments
 			name := f.Name()
-			if _, err := strconv.ParseUint(name, 10, 32); err != nil {
-				// Check for segment files (e.g., "12345.1")
-				if len(name) > 2 && name[len(name)-2] == '.' {
-					base := name[:len(name)-2]
-					if _, err := strconv.ParseUint(base, 10, 32); err != nil {
-						continue
-					}
-				} else {
-					continue
-				}
-			}
-			
-			filePath := filepath.Join(dbPath, f.Name())
-			data, err := os.ReadFile(filePath)
-			if err != nil || len(data) < PageSize {
+			if !relationFileRegex.MatchString(name) {
 				continue
 			}
 			
-			// Determine segment number from filename
-			segNum := uint32(0)
-			if idx := len(name) - 1; idx > 0 && name[idx-1] == '.' {
-				segNum = uint32(name[idx] - '0')
-			}
-			
-			fileResult := VerifyFileChecksums(data, segNum)
-			fileResult.Path = filePath
-			
-			result.TotalFiles++
-			result.TotalBlocks += fileResult.TotalBlocks
-			result.ValidBlocks += fileResult.ValidBlocks
-			result.InvalidBlocks += fileResult.InvalidBlocks
-			
-			if len(fileResult.Errors) > 0 {
-				result.Files = append(result.Files, *fileResult)
-			}
+			paths = append(paths, filepath.Join(dbPath, name))
+		}
+	}
+	
+	// Files are verified concurrently, then added up in directory order
+	fileResults := make([]*FileChecksumResult, len(paths))
+	err = parallel(ctx, len(paths), workers, func(i int) {
+		data, err := os.ReadFile(paths[i])
+		if err != nil || len(data) < PageSize {
+			return
+		}
+		
+		// Determine segment number from filename; each fork numbers its
+		// blocks from 0
+		segNum := uint32(0)
+		if m := relationFileRegex.FindStringSubmatch(filepath.Base(paths[i])); m != nil && m[3] != "" {
+			n, _ := strconv.ParseUint(m[3], 10, 32)
+			segNum = uint32(n)
+		}
+		
+		fileResult := VerifyFileChecksums(data, segNum)
+		fileResult.Path = paths[i]
+		fileResults[i] = fileResult
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, fileResult := range fileResults {
+		if fileResult == nil {
+			continue
+		}
+		result.TotalFiles++
+		result.TotalBlocks += fileResult.TotalBlocks
+		result.ValidBlocks += fileResult.ValidBlocks
+		result.InvalidBlocks += fileResult.InvalidBlocks
+		
+		if len(fileResult.Errors) > 0 {
+			result.Files = append(result.Files, *fileResult)
 		}
 	}
 	
@@ -0,0 +1,187 @@
+package pgdump
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TxStatus is the outcome of a transaction as recorded in pg_xact
+type TxStatus int
+
+const (
+	TxUnknown    TxStatus = iota // no hint bits and no commit log to tell
+	TxInProgress                 // running, or cut short by a crash
+	TxCommitted
+	TxAborted
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxInProgress:
+		return "in-progress"
+	case TxCommitted:
+		return "committed"
+	case TxAborted:
+		return "aborted"
+	}
+	return "unknown"
+}
+
+// MarshalText writes the status as its name in JSON
+func (s TxStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// pg_xact keeps 2 status bits per transaction, pg_subtrans the 4-byte
+// parent of each subtransaction, in segments of 32 pages (slru.h)
+const (
+	clogXactsPerPage     = PageSize * 4
+	subtransXactsPerPage = PageSize / 4
+	slruPagesPerSegment  = 32
+
+	// pg_commit_ts entries are a commit timestamp and a replication origin
+	commitTSEntrySize    = 10
+	commitTSXactsPerPage = PageSize / commitTSEntrySize
+
+	clogInProgress   = 0x00
+	clogCommitted    = 0x01
+	clogAborted      = 0x02
+	clogSubCommitted = 0x03
+
+	firstNormalXid   = 3 // 1 and 2 are the bootstrap and frozen XIDs
+	maxSubtransDepth = 64
+)
+
+// CommitLog looks up transaction status in pg_xact (pg_clog before
+// PostgreSQL 10), following subtransactions to their parent through
+// pg_subtrans. Segments are read on first use and cached, so it works as
+// well through a RemoteReader as on a local data directory.
+type CommitLog struct {
+	reader RemoteReader
+
+	mu       sync.Mutex
+	segments map[string][]byte // nil for missing segments
+}
+
+// NewCommitLog returns a commit log reading segments through reader
+func NewCommitLog(reader RemoteReader) *CommitLog {
+	return &CommitLog{reader: reader, segments: make(map[string][]byte)}
+}
+
+// Status returns the status of transaction xid. Subtransactions take the
+// status of their top-level transaction. A nil CommitLog, or a segment
+// that cannot be read (truncated by VACUUM, or not copied), gives
+// TxUnknown.
+func (c *CommitLog) Status(xid uint32) TxStatus {
+	if c == nil || xid == 0 {
+		return TxUnknown
+	}
+	for depth := 0; depth < maxSubtransDepth; depth++ {
+		if xid < firstNormalXid {
+			return TxCommitted
+		}
+		bits, ok := c.xactBits(xid)
+		if !ok {
+			return TxUnknown
+		}
+		switch bits {
+		case clogInProgress:
+			return TxInProgress
+		case clogCommitted:
+			return TxCommitted
+		case clogAborted:
+			return TxAborted
+		}
+
+		// Sub-committed: the outcome is the parent's. A parent always
+		// precedes its child, which also stops loops in damaged files.
+		parent := c.parent(xid)
+		if parent == 0 || int32(xid-parent) <= 0 {
+			return TxUnknown
+		}
+		xid = parent
+	}
+	return TxUnknown
+}
+
+// xidPrecedes reports whether transaction a started before b, comparing
+// modulo 2^32 as TransactionIdPrecedes does. The bootstrap and frozen XIDs
+// precede every normal one.
+func xidPrecedes(a, b uint32) bool {
+	if a < firstNormalXid || b < firstNormalXid {
+		return a < b
+	}
+	return int32(a-b) < 0
+}
+
+// xactBits returns the two pg_xact status bits of xid
+func (c *CommitLog) xactBits(xid uint32) (byte, bool) {
+	perSegment := uint32(clogXactsPerPage * slruPagesPerSegment)
+	seg := c.segment("pg_xact", "pg_clog", xid/perSegment)
+	idx := xid % perSegment
+	if int(idx/4) >= len(seg) {
+		return 0, false
+	}
+	return seg[idx/4] >> (idx % 4 * 2) & 0x03, true
+}
+
+// parent returns the parent of subtransaction xid, 0 if unknown
+func (c *CommitLog) parent(xid uint32) uint32 {
+	perSegment := uint32(subtransXactsPerPage * slruPagesPerSegment)
+	seg := c.segment("pg_subtrans", "", xid/perSegment)
+	off := int(xid%perSegment) * 4
+	if off+4 > len(seg) {
+		return 0
+	}
+	return u32(seg, off)
+}
+
+// CommitTime returns the commit timestamp of xid from pg_commit_ts, which
+// is only kept with track_commit_timestamp on
+func (c *CommitLog) CommitTime(xid uint32) (time.Time, bool) {
+	if c == nil || xid < firstNormalXid {
+		return time.Time{}, false
+	}
+	page := xid / commitTSXactsPerPage
+	seg := c.segment("pg_commit_ts", "", page/slruPagesPerSegment)
+	off := int(page%slruPagesPerSegment)*PageSize + int(xid%commitTSXactsPerPage)*commitTSEntrySize
+	if off+8 > len(seg) {
+		return time.Time{}, false
+	}
+	us := int64(u64(seg, off))
+	if us == 0 {
+		return time.Time{}, false
+	}
+	return pgEpoch.Add(time.Duration(us) * time.Microsecond), true
+}
+
+// hasCommitTimestamps reports whether a data directory has pg_commit_ts
+// segments, i.e. track_commit_timestamp was on at some point
+func hasCommitTimestamps(dataDir string) bool {
+	entries, _ := os.ReadDir(filepath.Join(dataDir, "pg_commit_ts"))
+	return len(entries) > 0
+}
+
+// segment reads an SLRU segment, trying the pre-10 directory name too
+func (c *CommitLog) segment(dir, oldDir string, num uint32) []byte {
+	name := fmt.Sprintf("%04X", num)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := dir + "/" + name
+	if data, ok := c.segments[path]; ok {
+		return data
+	}
+	data, err := c.reader(path)
+	if err != nil && oldDir != "" {
+		data, err = c.reader(oldDir + "/" + name)
+	}
+	if err != nil {
+		data = nil
+	}
+	c.segments[path] = data
+	return data
+}
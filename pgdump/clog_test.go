@@ -0,0 +1,201 @@
+package pgdump
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCommitLog serves pg_xact/0000, pg_subtrans/0000 and pg_commit_ts/0000
+// built from status bits, subtransaction parents and commit times
+func testCommitLog(dir string, status map[uint32]byte, parents map[uint32]uint32, commits map[uint32]time.Time) *CommitLog {
+	xact := make([]byte, PageSize)
+	for xid, s := range status {
+		xact[xid/4] |= s << (xid % 4 * 2)
+	}
+	subtrans := make([]byte, PageSize)
+	for xid, parent := range parents {
+		putU32(subtrans, int(xid)*4, parent)
+	}
+	commitTS := make([]byte, PageSize)
+	for xid, ts := range commits {
+		putU64(commitTS, int(xid)*commitTSEntrySize, uint64(ts.Sub(pgEpoch).Microseconds()))
+	}
+	files := map[string][]byte{dir + "/0000": xact, "pg_subtrans/0000": subtrans, "pg_commit_ts/0000": commitTS}
+	return NewCommitLog(func(path string) ([]byte, error) {
+		if data, ok := files[path]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	})
+}
+
+var testXactStatus = map[uint32]byte{
+	100: clogCommitted, 101: clogAborted, 102: clogInProgress,
+	103: clogSubCommitted, 104: clogSubCommitted, 105: clogSubCommitted,
+}
+
+func TestCommitLogStatus(t *testing.T) {
+	for _, dir := range []string{"pg_xact", "pg_clog"} {
+		clog := testCommitLog(dir, testXactStatus, map[uint32]uint32{103: 100, 104: 102}, nil)
+		tests := []struct {
+			xid  uint32
+			want TxStatus
+		}{
+			{0, TxUnknown},
+			{2, TxCommitted}, // frozen
+			{100, TxCommitted},
+			{101, TxAborted},
+			{102, TxInProgress},
+			{103, TxCommitted},  // parent committed
+			{104, TxInProgress}, // parent still running
+			{105, TxUnknown},    // parent lost with pg_subtrans
+			{5 << 20, TxUnknown},
+		}
+		for _, tt := range tests {
+			if got := clog.Status(tt.xid); got != tt.want {
+				t.Errorf("%s: Status(%d) = %v, want %v", dir, tt.xid, got, tt.want)
+			}
+		}
+	}
+	if got := (*CommitLog)(nil).Status(100); got != TxUnknown {
+		t.Errorf("nil CommitLog: Status = %v", got)
+	}
+}
+
+// testTupleXids builds a tuple header with the given xmin, xmax and infomask
+func testTupleXids(xmin, xmax uint32, infomask uint16, data []byte) []byte {
+	tup := testHeapTuple(1, data)
+	putU32(tup, 0, xmin)
+	putU32(tup, 4, xmax)
+	putU16(tup, 20, infomask)
+	return tup
+}
+
+func TestXidPrecedes(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{100, 200, true},
+		{200, 100, false},
+		{100, 100, false},
+		{4294967000, 510, true}, // across wraparound
+		{510, 4294967000, false},
+		{2, 4294967000, true}, // frozen
+		{4294967000, 2, false},
+	}
+	for _, tt := range tests {
+		if got := xidPrecedes(tt.a, tt.b); got != tt.want {
+			t.Errorf("xidPrecedes(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// A frozen tuple keeps its xmin, from before wraparound
+	frozen := ParseHeapTuple(testTupleXids(4000000000, 0, 0x0300|0x0800, nil))
+	recent := ParseHeapTuple(testTupleXids(100, 0, 0x0100|0x0800, nil))
+	if !frozen.xminPrecedes(recent) || recent.xminPrecedes(frozen) {
+		t.Error("frozen tuple does not come first")
+	}
+}
+
+func TestVisibilityWithCommitLog(t *testing.T) {
+	clog := testCommitLog("pg_xact", testXactStatus, nil, nil)
+	tests := []struct {
+		name          string
+		xmin, xmax    uint32
+		infomask      uint16
+		hints, commit bool // visible from hint bits alone, and with clog
+	}{
+		{"committed insert", 100, 0, 0x0800, true, true},
+		{"aborted insert", 101, 0, 0x0800, true, false},
+		{"insert in progress", 102, 0, 0x0800, true, false},
+		{"committed delete", 100, 100, 0, false, false},
+		{"aborted delete", 100, 101, 0, false, true},
+		{"delete in progress", 100, 102, 0, false, true},
+		{"row lock", 100, 100, heapXmaxLockOnly, true, true},
+		{"frozen", 101, 0, 0x0300 | 0x0800, true, true},
+	}
+	for _, tt := range tests {
+		tuple := ParseHeapTuple(testTupleXids(tt.xmin, tt.xmax, tt.infomask, nil))
+		if got := tuple.IsVisible(); got != tt.hints {
+			t.Errorf("%s: IsVisible = %v, want %v", tt.name, got, tt.hints)
+		}
+		if got := tuple.IsVisibleWithCommitLog(clog); got != tt.commit {
+			t.Errorf("%s: IsVisibleWithCommitLog = %v, want %v", tt.name, got, tt.commit)
+		}
+	}
+
+	tuple := ParseHeapTuple(testTupleXids(100, 101, 0, nil))
+	if got := tuple.XmaxStatus(clog); got != TxAborted {
+		t.Errorf("XmaxStatus = %v, want aborted", got)
+	}
+	if text, _ := tuple.XminStatus(nil).MarshalText(); string(text) != "unknown" {
+		t.Errorf("XminStatus without clog = %s", text)
+	}
+}
+
+func TestRowIteratorCommitLog(t *testing.T) {
+	b := func(v uint32) []byte {
+		data := make([]byte, 4)
+		putU32(data, 0, v)
+		return data
+	}
+	page := testHeapPage(
+		testTupleXids(100, 0, 0x0800, b(1)),
+		testTupleXids(101, 0, 0x0800, b(2)), // rolled back
+		testTupleXids(100, 101, 0, b(3)),    // delete rolled back
+		testTupleXids(100, 100, 0, b(4)),    // deleted
+	)
+	it := newRowIterator(bytes.NewReader(page), testInt4Columns, &rowDecoder{clog: testCommitLog("pg_xact", testXactStatus, nil, nil)}, nil, nil)
+	var ids []interface{}
+	for _, row := range it.all() {
+		ids = append(ids, row.Values[0])
+	}
+	if want := []interface{}{int32(1), int32(3)}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+	if n, _ := it.Count(); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+}
+
+func TestVisibleAsOf(t *testing.T) {
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := map[uint32]byte{100: clogCommitted, 110: clogCommitted, 120: clogCommitted, 130: clogAborted}
+	clog := testCommitLog("pg_xact", status, nil, map[uint32]time.Time{
+		100: noon.Add(-time.Hour), 110: noon.Add(time.Hour), 120: noon.Add(2 * time.Hour),
+	})
+	if ts, ok := clog.CommitTime(110); !ok || !ts.Equal(noon.Add(time.Hour)) {
+		t.Errorf("CommitTime(110) = %v, %v", ts, ok)
+	}
+	if _, ok := clog.CommitTime(130); ok {
+		t.Error("CommitTime of an aborted transaction")
+	}
+
+	tests := []struct {
+		name       string
+		xmin, xmax uint32
+		infomask   uint16
+		xid, time  bool // visible as of XID 110, and as of noon
+	}{
+		{"old row", 100, 0, 0x0800, true, true},
+		{"inserted at the snapshot", 110, 0, 0x0800, false, false},
+		{"inserted later", 120, 0, 0x0800, false, false},
+		{"deleted at the snapshot", 100, 110, 0x0400, true, true},
+		{"deleted before", 100, 100, 0x0400, false, false},
+		{"delete aborted", 100, 130, 0, true, true},
+		{"frozen", 4000000000, 0, 0x0300 | 0x0800, true, true},
+	}
+	for _, tt := range tests {
+		tuple := ParseHeapTuple(testTupleXids(tt.xmin, tt.xmax, tt.infomask, nil))
+		if got := tuple.IsVisibleAsOf(clog, Snapshot{XID: 110}); got != tt.xid {
+			t.Errorf("%s: as of XID = %v, want %v", tt.name, got, tt.xid)
+		}
+		if got := tuple.IsVisibleAsOf(clog, Snapshot{Time: noon}); got != tt.time {
+			t.Errorf("%s: as of time = %v, want %v", tt.name, got, tt.time)
+		}
+	}
+}
@@ -0,0 +1,833 @@
+package pgdump
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Catalogs describing defaults, constraints and indexes
+const (
+	PGProc       = 1255 // pg_proc - functions (mapped)
+	PGAm         = 2601 // pg_am - access methods
+	PGAttrDef    = 2604 // pg_attrdef - column defaults
+	PGConstraint = 2606 // pg_constraint - table constraints
+	PGIndex      = 2610 // pg_index - indexes
+	PGOperator   = 2617 // pg_operator - operators
+)
+
+// ConstraintInfo represents a pg_constraint entry
+type ConstraintInfo struct {
+	OID        uint32
+	Name       string
+	Type       byte // contype: c=check, f=foreign key, p=primary key, u=unique, x=exclusion
+	Deferrable bool
+	Deferred   bool
+	Validated  bool
+	NoInherit  bool
+	RelID      uint32 // conrelid, 0 for domain constraints
+	IndexID    uint32 // conindid, the index enforcing p/u/x
+	RefRelID   uint32 // confrelid, the table a foreign key references
+
+	UpdateAction byte // confupdtype: a=no action, r=restrict, c=cascade, n=set null, d=set default
+	DeleteAction byte // confdeltype
+	MatchType    byte // confmatchtype: f=full, p=partial, s=simple
+
+	Keys       []int    // conkey, constrained attnums
+	RefKeys    []int    // confkey, referenced attnums
+	DelSetCols []int    // confdelsetcols, ON DELETE SET NULL/DEFAULT (cols) (PG15+)
+	ExclOps    []uint32 // conexclop, one operator per exclusion key
+	Expr       string   // conbin, the CHECK expression as a pg_node_tree
+}
+
+// PGIndexInfo represents a pg_index entry (IndexInfo describes the index file itself)
+type PGIndexInfo struct {
+	IndexRelID       uint32
+	RelID            uint32
+	NKeyAtts         int // key columns; the rest are INCLUDE columns
+	Unique           bool
+	Primary          bool
+	NullsNotDistinct bool // PG15+
+	Valid            bool
+	Keys             []int  // indkey, 0 for an expression column
+	Options          []int  // indoption per key column
+	Exprs            string // indexprs, pg_node_tree list of expression columns
+	Pred             string // indpred, partial index predicate
+}
+
+// indoption bits
+const (
+	indOptionDesc       = 1
+	indOptionNullsFirst = 2
+)
+
+// AttrDefInfo represents a pg_attrdef entry
+type AttrDefInfo struct {
+	RelID uint32
+	Num   int
+	Expr  string // adbin (pg_node_tree)
+}
+
+// builtinAccessMethods covers pg_am when it cannot be read
+var builtinAccessMethods = map[uint32]string{
+	403: "btree", 405: "hash", 783: "gist", 2742: "gin", 4000: "spgist", 3580: "brin",
+}
+
+var (
+	schemaPGAttrDef = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "adrelid", TypID: OidOid, Len: 4},
+		{Name: "adnum", TypID: OidInt2, Len: 2},
+		{Name: "adbin", TypID: OidText, Len: -1},
+	}
+
+	// pg_proc, pg_operator and pg_am all start with oid and a name
+	schemaPGProc     = []Column{{Name: "oid", TypID: OidOid, Len: 4}, {Name: "proname", TypID: OidName, Len: 64}}
+	schemaPGOperator = []Column{{Name: "oid", TypID: OidOid, Len: 4}, {Name: "oprname", TypID: OidName, Len: 64}}
+	schemaPGAm       = []Column{{Name: "oid", TypID: OidOid, Len: 4}, {Name: "amname", TypID: OidName, Len: 64}}
+
+	// pg_constraint variable-length tail (int2vector/oidvector-like arrays
+	// decode as int2[] and oid[])
+	schemaPGConstraintVarlenaV12 = []Column{
+		{Name: "conkey", TypID: 1005, Len: -1},
+		{Name: "confkey", TypID: 1005, Len: -1},
+		{Name: "conpfeqop", TypID: 1028, Len: -1},
+		{Name: "conppeqop", TypID: 1028, Len: -1},
+		{Name: "conffeqop", TypID: 1028, Len: -1},
+		{Name: "conexclop", TypID: 1028, Len: -1},
+		{Name: "conbin", TypID: OidText, Len: -1},
+	}
+
+	// PostgreSQL 15+ adds confdelsetcols
+	schemaPGConstraintVarlenaV15 = []Column{
+		{Name: "conkey", TypID: 1005, Len: -1},
+		{Name: "confkey", TypID: 1005, Len: -1},
+		{Name: "conpfeqop", TypID: 1028, Len: -1},
+		{Name: "conppeqop", TypID: 1028, Len: -1},
+		{Name: "conffeqop", TypID: 1028, Len: -1},
+		{Name: "confdelsetcols", TypID: 1005, Len: -1},
+		{Name: "conexclop", TypID: 1028, Len: -1},
+		{Name: "conbin", TypID: OidText, Len: -1},
+	}
+
+	// PostgreSQL 12-14 pg_constraint
+	schemaPGConstraintV12 = append([]Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "conname", TypID: OidName, Len: 64},
+		{Name: "connamespace", TypID: OidOid, Len: 4},
+		{Name: "contype", TypID: OidChar, Len: 1},
+		{Name: "condeferrable", TypID: OidBool, Len: 1},
+		{Name: "condeferred", TypID: OidBool, Len: 1},
+		{Name: "convalidated", TypID: OidBool, Len: 1},
+		{Name: "conrelid", TypID: OidOid, Len: 4},
+		{Name: "contypid", TypID: OidOid, Len: 4},
+		{Name: "conindid", TypID: OidOid, Len: 4},
+		{Name: "conparentid", TypID: OidOid, Len: 4},
+		{Name: "confrelid", TypID: OidOid, Len: 4},
+		{Name: "confupdtype", TypID: OidChar, Len: 1},
+		{Name: "confdeltype", TypID: OidChar, Len: 1},
+		{Name: "confmatchtype", TypID: OidChar, Len: 1},
+		{Name: "conislocal", TypID: OidBool, Len: 1},
+		{Name: "coninhcount", TypID: OidInt4, Len: 4},
+		{Name: "connoinherit", TypID: OidBool, Len: 1},
+	}, schemaPGConstraintVarlenaV12...)
+
+	// PostgreSQL 15 pg_constraint
+	schemaPGConstraintV15 = append(append([]Column{}, schemaPGConstraintV12[:18]...), schemaPGConstraintVarlenaV15...)
+
+	// PostgreSQL 16-17 pg_constraint (coninhcount became int2)
+	schemaPGConstraintV16 = append([]Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "conname", TypID: OidName, Len: 64},
+		{Name: "connamespace", TypID: OidOid, Len: 4},
+		{Name: "contype", TypID: OidChar, Len: 1},
+		{Name: "condeferrable", TypID: OidBool, Len: 1},
+		{Name: "condeferred", TypID: OidBool, Len: 1},
+		{Name: "convalidated", TypID: OidBool, Len: 1},
+		{Name: "conrelid", TypID: OidOid, Len: 4},
+		{Name: "contypid", TypID: OidOid, Len: 4},
+		{Name: "conindid", TypID: OidOid, Len: 4},
+		{Name: "conparentid", TypID: OidOid, Len: 4},
+		{Name: "confrelid", TypID: OidOid, Len: 4},
+		{Name: "confupdtype", TypID: OidChar, Len: 1},
+		{Name: "confdeltype", TypID: OidChar, Len: 1},
+		{Name: "confmatchtype", TypID: OidChar, Len: 1},
+		{Name: "conislocal", TypID: OidBool, Len: 1},
+		{Name: "coninhcount", TypID: OidInt2, Len: 2},
+		{Name: "connoinherit", TypID: OidBool, Len: 1},
+	}, schemaPGConstraintVarlenaV15...)
+
+	// PostgreSQL 18+ pg_constraint (conenforced and conperiod added)
+	schemaPGConstraintV18 = append([]Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "conname", TypID: OidName, Len: 64},
+		{Name: "connamespace", TypID: OidOid, Len: 4},
+		{Name: "contype", TypID: OidChar, Len: 1},
+		{Name: "condeferrable", TypID: OidBool, Len: 1},
+		{Name: "condeferred", TypID: OidBool, Len: 1},
+		{Name: "conenforced", TypID: OidBool, Len: 1},
+		{Name: "convalidated", TypID: OidBool, Len: 1},
+		{Name: "conrelid", TypID: OidOid, Len: 4},
+		{Name: "contypid", TypID: OidOid, Len: 4},
+		{Name: "conindid", TypID: OidOid, Len: 4},
+		{Name: "conparentid", TypID: OidOid, Len: 4},
+		{Name: "confrelid", TypID: OidOid, Len: 4},
+		{Name: "confupdtype", TypID: OidChar, Len: 1},
+		{Name: "confdeltype", TypID: OidChar, Len: 1},
+		{Name: "confmatchtype", TypID: OidChar, Len: 1},
+		{Name: "conislocal", TypID: OidBool, Len: 1},
+		{Name: "coninhcount", TypID: OidInt2, Len: 2},
+		{Name: "connoinherit", TypID: OidBool, Len: 1},
+		{Name: "conperiod", TypID: OidBool, Len: 1},
+	}, schemaPGConstraintVarlenaV15...)
+
+	// pg_index variable-length tail. int2vector and oidvector are plain
+	// storage, so they keep 4-byte headers and their alignment.
+	schemaPGIndexVarlena = []Column{
+		{Name: "indkey", TypID: 1005, Len: -1, Align: 'i'},
+		{Name: "indcollation", TypID: 1028, Len: -1, Align: 'i'},
+		{Name: "indclass", TypID: 1028, Len: -1, Align: 'i'},
+		{Name: "indoption", TypID: 1005, Len: -1, Align: 'i'},
+		{Name: "indexprs", TypID: OidText, Len: -1},
+		{Name: "indpred", TypID: OidText, Len: -1},
+	}
+
+	// PostgreSQL 12-14 pg_index
+	schemaPGIndexV12 = append([]Column{
+		{Name: "indexrelid", TypID: OidOid, Len: 4},
+		{Name: "indrelid", TypID: OidOid, Len: 4},
+		{Name: "indnatts", TypID: OidInt2, Len: 2},
+		{Name: "indnkeyatts", TypID: OidInt2, Len: 2},
+		{Name: "indisunique", TypID: OidBool, Len: 1},
+		{Name: "indisprimary", TypID: OidBool, Len: 1},
+		{Name: "indisexclusion", TypID: OidBool, Len: 1},
+		{Name: "indimmediate", TypID: OidBool, Len: 1},
+		{Name: "indisclustered", TypID: OidBool, Len: 1},
+		{Name: "indisvalid", TypID: OidBool, Len: 1},
+		{Name: "indcheckxmin", TypID: OidBool, Len: 1},
+		{Name: "indisready", TypID: OidBool, Len: 1},
+		{Name: "indislive", TypID: OidBool, Len: 1},
+		{Name: "indisreplident", TypID: OidBool, Len: 1},
+	}, schemaPGIndexVarlena...)
+
+	// PostgreSQL 15+ pg_index (indnullsnotdistinct added)
+	schemaPGIndexV15 = append([]Column{
+		{Name: "indexrelid", TypID: OidOid, Len: 4},
+		{Name: "indrelid", TypID: OidOid, Len: 4},
+		{Name: "indnatts", TypID: OidInt2, Len: 2},
+		{Name: "indnkeyatts", TypID: OidInt2, Len: 2},
+		{Name: "indisunique", TypID: OidBool, Len: 1},
+		{Name: "indnullsnotdistinct", TypID: OidBool, Len: 1},
+		{Name: "indisprimary", TypID: OidBool, Len: 1},
+		{Name: "indisexclusion", TypID: OidBool, Len: 1},
+		{Name: "indimmediate", TypID: OidBool, Len: 1},
+		{Name: "indisclustered", TypID: OidBool, Len: 1},
+		{Name: "indisvalid", TypID: OidBool, Len: 1},
+		{Name: "indcheckxmin", TypID: OidBool, Len: 1},
+		{Name: "indisready", TypID: OidBool, Len: 1},
+		{Name: "indislive", TypID: OidBool, Len: 1},
+		{Name: "indisreplident", TypID: OidBool, Len: 1},
+	}, schemaPGIndexVarlena...)
+)
+
+// ParsePGConstraint extracts constraints from pg_constraint heap file
+func ParsePGConstraint(data []byte, pgVersion int) []ConstraintInfo {
+	var result []ConstraintInfo
+	for _, row := range ReadRows(data, detectConstraintSchema(data, pgVersion), true) {
+		oid := getOID(row, "oid")
+		if oid == 0 {
+			continue
+		}
+		validated, ok := row["convalidated"].(bool)
+		result = append(result, ConstraintInfo{
+			OID:          oid,
+			Name:         getString(row, "conname"),
+			Type:         getChar(row, "contype"),
+			Deferrable:   getBool(row, "condeferrable"),
+			Deferred:     getBool(row, "condeferred"),
+			Validated:    validated || !ok,
+			NoInherit:    getBool(row, "connoinherit"),
+			RelID:        getOID(row, "conrelid"),
+			IndexID:      getOID(row, "conindid"),
+			RefRelID:     getOID(row, "confrelid"),
+			UpdateAction: getChar(row, "confupdtype"),
+			DeleteAction: getChar(row, "confdeltype"),
+			MatchType:    getChar(row, "confmatchtype"),
+			Keys:         intList(row["conkey"]),
+			RefKeys:      intList(row["confkey"]),
+			DelSetCols:   intList(row["confdelsetcols"]),
+			ExclOps:      oidList(row["conexclop"]),
+			Expr:         getString(row, "conbin"),
+		})
+	}
+	return result
+}
+
+// detectConstraintSchema picks the pg_constraint layout from the version,
+// or from the attribute count of its tuples: 25 up to PG14, 26 in PG15-17
+// and 28 from PG18. PG16 shrank coninhcount to int2, which moves the
+// varlena columns to offset 103 where PG15 still has coninhcount's zero
+// high byte.
+func detectConstraintSchema(data []byte, version int) []Column {
+	switch {
+	case version >= 18:
+		return schemaPGConstraintV18
+	case version >= 16:
+		return schemaPGConstraintV16
+	case version == 15:
+		return schemaPGConstraintV15
+	case version >= 12:
+		return schemaPGConstraintV12
+	}
+
+	var schema []Column
+	for _, e := range ReadTuples(data, true) {
+		if e.Tuple.Header == nil {
+			continue
+		}
+		switch e.Tuple.Header.Natts {
+		case 25:
+			return schemaPGConstraintV12
+		case 28:
+			return schemaPGConstraintV18
+		case 26:
+			if d := e.Tuple.Data; len(d) > 103 && d[103] != 0 {
+				return schemaPGConstraintV16
+			}
+			schema = schemaPGConstraintV15
+		}
+	}
+	if schema == nil {
+		return schemaPGConstraintV16
+	}
+	return schema
+}
+
+// ParsePGIndex extracts indexes from pg_index heap file
+func ParsePGIndex(data []byte, pgVersion int) []PGIndexInfo {
+	var result []PGIndexInfo
+	for _, row := range ReadRows(data, detectIndexSchema(data, pgVersion), true) {
+		indexrelid := getOID(row, "indexrelid")
+		if indexrelid == 0 {
+			continue
+		}
+		result = append(result, PGIndexInfo{
+			IndexRelID:       indexrelid,
+			RelID:            getOID(row, "indrelid"),
+			NKeyAtts:         toInt(row["indnkeyatts"]),
+			Unique:           getBool(row, "indisunique"),
+			Primary:          getBool(row, "indisprimary"),
+			NullsNotDistinct: getBool(row, "indnullsnotdistinct"),
+			Valid:            getBool(row, "indisvalid"),
+			Keys:             intList(row["indkey"]),
+			Options:          intList(row["indoption"]),
+			Exprs:            getString(row, "indexprs"),
+			Pred:             getString(row, "indpred"),
+		})
+	}
+	return result
+}
+
+// detectIndexSchema picks the pg_index layout from the version, or from
+// the attribute count of its tuples (21 from PG15)
+func detectIndexSchema(data []byte, version int) []Column {
+	switch {
+	case version >= 15:
+		return schemaPGIndexV15
+	case version >= 12:
+		return schemaPGIndexV12
+	}
+	for _, e := range ReadTuples(data, true) {
+		if e.Tuple.Header != nil && e.Tuple.Header.Natts == 20 {
+			return schemaPGIndexV12
+		}
+	}
+	return schemaPGIndexV15
+}
+
+// ParsePGAttrDef extracts column defaults from pg_attrdef heap file
+func ParsePGAttrDef(data []byte) []AttrDefInfo {
+	var result []AttrDefInfo
+	for _, row := range ReadRows(data, schemaPGAttrDef, true) {
+		if relid, num := getOID(row, "adrelid"), toInt(row["adnum"]); relid > 0 && num > 0 {
+			result = append(result, AttrDefInfo{RelID: relid, Num: num, Expr: getString(row, "adbin")})
+		}
+	}
+	return result
+}
+
+// ParsePGProc extracts function names from pg_proc heap file, keyed by OID
+func ParsePGProc(data []byte) map[uint32]string {
+	return parseOIDNames(data, schemaPGProc)
+}
+
+// ParsePGOperator extracts operator names from pg_operator heap file, keyed by OID
+func ParsePGOperator(data []byte) map[uint32]string {
+	return parseOIDNames(data, schemaPGOperator)
+}
+
+// ParsePGAm extracts access method names from pg_am heap file, keyed by OID
+func ParsePGAm(data []byte) map[uint32]string {
+	return parseOIDNames(data, schemaPGAm)
+}
+
+func parseOIDNames(data []byte, schema []Column) map[uint32]string {
+	names := make(map[uint32]string)
+	for _, row := range ReadRows(data, schema, true) {
+		if oid, name := getOID(row, "oid"), getString(row, schema[1].Name); oid > 0 && name != "" {
+			names[oid] = name
+		}
+	}
+	return names
+}
+
+func intList(v interface{}) []int {
+	items, _ := v.([]interface{})
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]int, len(items))
+	for i, item := range items {
+		out[i] = toInt(item)
+	}
+	return out
+}
+
+func oidList(v interface{}) []uint32 {
+	items, _ := v.([]interface{})
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]uint32, len(items))
+	for i, item := range items {
+		out[i] = uint32(toInt(item))
+	}
+	return out
+}
+
+// relationSchema describes the defaults, constraints and indexes of the
+// tables of one database, rendered as pg_get_expr, pg_get_constraintdef and
+// pg_get_indexdef would. Index operator classes and collations are assumed
+// to be the defaults.
+type relationSchema struct {
+	relations     map[uint32]TableInfo // pg_class by OID
+	attrs         map[uint32][]AttrInfo
+	defaults      map[uint32][]AttrDefInfo
+	constraints   map[uint32][]ConstraintInfo
+	indexes       map[uint32][]PGIndexInfo
+	accessMethods map[uint32]string
+	expr          exprContext
+
+	// sequences referenced by the defaults described so far
+	sequences map[uint32]bool
+}
+
+// newRelationSchema builds a relationSchema from pg_class, pg_attribute and
+// the catalogs in schemaCatalogs, keyed by catalog OID. Missing catalogs
+// only leave out what they describe.
+func newRelationSchema(tables map[uint32]TableInfo, attrs map[uint32][]AttrInfo, types *TypeCatalog, catalogs map[uint32][]byte, pgVersion int) *relationSchema {
+	s := &relationSchema{
+		relations:     make(map[uint32]TableInfo),
+		attrs:         attrs,
+		defaults:      make(map[uint32][]AttrDefInfo),
+		constraints:   make(map[uint32][]ConstraintInfo),
+		indexes:       make(map[uint32][]PGIndexInfo),
+		accessMethods: make(map[uint32]string),
+		sequences:     make(map[uint32]bool),
+		expr: exprContext{
+			relations: make(map[uint32]string),
+			procs:     ParsePGProc(catalogs[PGProc]),
+			operators: ParsePGOperator(catalogs[PGOperator]),
+			types:     types,
+		},
+	}
+	for _, t := range tables {
+		s.relations[t.OID] = t
+		s.expr.relations[t.OID] = quotedRelationName(t.Schema, t.Name)
+	}
+	for oid, name := range builtinAccessMethods {
+		s.accessMethods[oid] = name
+	}
+	for oid, name := range ParsePGAm(catalogs[PGAm]) {
+		s.accessMethods[oid] = name
+	}
+	for _, d := range ParsePGAttrDef(catalogs[PGAttrDef]) {
+		s.defaults[d.RelID] = append(s.defaults[d.RelID], d)
+	}
+	for _, c := range ParsePGConstraint(catalogs[PGConstraint], pgVersion) {
+		if c.RelID != 0 {
+			s.constraints[c.RelID] = append(s.constraints[c.RelID], c)
+		}
+	}
+	for _, idx := range ParsePGIndex(catalogs[PGIndex], pgVersion) {
+		s.indexes[idx.RelID] = append(s.indexes[idx.RelID], idx)
+	}
+	for relid := range s.constraints {
+		sort.Slice(s.constraints[relid], func(i, j int) bool {
+			return s.constraints[relid][i].Name < s.constraints[relid][j].Name
+		})
+	}
+	for relid := range s.indexes {
+		sort.Slice(s.indexes[relid], func(i, j int) bool {
+			return s.relations[s.indexes[relid][i].IndexRelID].Name < s.relations[s.indexes[relid][j].IndexRelID].Name
+		})
+	}
+	return s
+}
+
+// schemaCatalogs are the non-mapped catalogs newRelationSchema reads, besides
+// the mapped pg_proc
+var schemaCatalogs = []uint32{PGAm, PGAttrDef, PGConstraint, PGIndex, PGOperator}
+
+// describe fills in the defaults, constraints and indexes of a dumped table.
+// Anything that cannot be rendered is listed in t.Skipped.
+func (s *relationSchema) describe(t *TableDump) {
+	if s == nil {
+		return
+	}
+	ctx := s.exprFor(t.OID)
+	byName := make(map[string]*ColumnInfo)
+	for i := range t.Columns {
+		byName[t.Columns[i].Name] = &t.Columns[i]
+	}
+
+	for _, d := range s.defaults[t.OID] {
+		var attr AttrInfo
+		for _, a := range s.attrs[t.OID] {
+			if a.Num == d.Num {
+				attr = a
+			}
+		}
+		col, ok := byName[attr.Name]
+		if !ok {
+			continue
+		}
+		if attr.Generated != 0 {
+			t.Skipped = append(t.Skipped, fmt.Sprintf("generated column %s cannot be added after the data", col.Name))
+			continue
+		}
+		expr, err := ctx.DeparseExpr(d.Expr)
+		if err != nil {
+			t.Skipped = append(t.Skipped, fmt.Sprintf("default of column %s: %v", col.Name, err))
+			continue
+		}
+		col.Default = expr
+	}
+	for oid := range ctx.regclasses {
+		s.sequences[oid] = true
+	}
+
+	backing := make(map[uint32]bool)
+	for _, c := range s.constraints[t.OID] {
+		def, err := s.constraintDef(c, ctx)
+		switch {
+		case err != nil:
+			t.Skipped = append(t.Skipped, fmt.Sprintf("constraint %s: %v", c.Name, err))
+		case def != "":
+			t.Constraints = append(t.Constraints, ConstraintDef{Name: c.Name, Type: string(c.Type), Definition: def})
+		}
+		// a foreign key's conindid is the referenced key's index, not its own
+		if strings.IndexByte("pux", c.Type) >= 0 {
+			backing[c.IndexID] = true
+		}
+	}
+
+	for _, idx := range s.indexes[t.OID] {
+		if backing[idx.IndexRelID] || !idx.Valid {
+			continue
+		}
+		name := s.relations[idx.IndexRelID].Name
+		def, err := s.indexDef(idx, ctx)
+		if err != nil {
+			t.Skipped = append(t.Skipped, fmt.Sprintf("index %s: %v", name, err))
+			continue
+		}
+		t.Indexes = append(t.Indexes, IndexDef{Name: name, Definition: def})
+	}
+}
+
+// exprFor returns an expression context resolving the columns of relid
+func (s *relationSchema) exprFor(relid uint32) *exprContext {
+	ctx := s.expr
+	ctx.columns = make(map[int]string)
+	ctx.regclasses = make(map[uint32]bool)
+	for _, a := range s.attrs[relid] {
+		ctx.columns[a.Num] = a.Name
+	}
+	return &ctx
+}
+
+// columnNames resolves attnums of relid to quoted column names
+func (s *relationSchema) columnNames(relid uint32, nums []int) ([]string, error) {
+	names := make([]string, len(nums))
+	for i, num := range nums {
+		found := false
+		for _, a := range s.attrs[relid] {
+			if a.Num == num {
+				names[i], found = quoteIdent(a.Name), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %d of relation %d", num, relid)
+		}
+	}
+	return names, nil
+}
+
+// constraintDef renders a constraint as pg_get_constraintdef does. Trigger
+// and PG18 not-null constraints render as "" (NOT NULL comes from attnotnull).
+func (s *relationSchema) constraintDef(c ConstraintInfo, ctx *exprContext) (string, error) {
+	var def string
+	switch c.Type {
+	case 'p', 'u':
+		cols, err := s.columnNames(c.RelID, c.Keys)
+		if err != nil {
+			return "", err
+		}
+		def = "PRIMARY KEY"
+		if c.Type == 'u' {
+			def = "UNIQUE"
+		}
+		idx, _ := s.index(c.RelID, c.IndexID)
+		if idx.NullsNotDistinct {
+			def += " NULLS NOT DISTINCT"
+		}
+		def += " (" + strings.Join(cols, ", ") + ")"
+		if idx.NKeyAtts > 0 && idx.NKeyAtts < len(idx.Keys) {
+			include, err := s.columnNames(c.RelID, idx.Keys[idx.NKeyAtts:])
+			if err != nil {
+				return "", err
+			}
+			def += " INCLUDE (" + strings.Join(include, ", ") + ")"
+		}
+
+	case 'f':
+		cols, err := s.columnNames(c.RelID, c.Keys)
+		if err != nil {
+			return "", err
+		}
+		refCols, err := s.columnNames(c.RefRelID, c.RefKeys)
+		if err != nil {
+			return "", err
+		}
+		ref, ok := s.expr.relations[c.RefRelID]
+		if !ok {
+			return "", fmt.Errorf("unknown referenced table %d", c.RefRelID)
+		}
+		def = fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", strings.Join(cols, ", "), ref, strings.Join(refCols, ", "))
+		switch c.MatchType {
+		case 'f':
+			def += " MATCH FULL"
+		case 'p':
+			def += " MATCH PARTIAL"
+		}
+		if action := fkAction(c.UpdateAction); action != "" {
+			def += " ON UPDATE " + action
+		}
+		if action := fkAction(c.DeleteAction); action != "" {
+			def += " ON DELETE " + action
+			if len(c.DelSetCols) > 0 {
+				setCols, err := s.columnNames(c.RelID, c.DelSetCols)
+				if err != nil {
+					return "", err
+				}
+				def += " (" + strings.Join(setCols, ", ") + ")"
+			}
+		}
+
+	case 'c':
+		expr, err := ctx.DeparseExpr(c.Expr)
+		if err != nil {
+			return "", err
+		}
+		def = "CHECK (" + expr + ")"
+		if c.NoInherit {
+			def += " NO INHERIT"
+		}
+
+	case 'x':
+		idx, ok := s.index(c.RelID, c.IndexID)
+		if !ok {
+			return "", fmt.Errorf("exclusion index %d not found", c.IndexID)
+		}
+		keys, _, err := s.indexColumns(idx, ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(c.ExclOps) != len(keys) {
+			return "", fmt.Errorf("%d exclusion operators for %d keys", len(c.ExclOps), len(keys))
+		}
+		for i, opno := range c.ExclOps {
+			op, ok := s.expr.operators[opno]
+			if !ok {
+				return "", fmt.Errorf("unknown operator %d", opno)
+			}
+			keys[i] += " WITH " + op
+		}
+		def = fmt.Sprintf("EXCLUDE USING %s (%s)", s.accessMethod(c.IndexID), strings.Join(keys, ", "))
+		if idx.Pred != "" {
+			pred, err := ctx.DeparseExpr(idx.Pred)
+			if err != nil {
+				return "", err
+			}
+			def += " WHERE (" + pred + ")"
+		}
+
+	default:
+		return "", nil
+	}
+
+	if c.Deferrable {
+		def += " DEFERRABLE"
+		if c.Deferred {
+			def += " INITIALLY DEFERRED"
+		}
+	}
+	if !c.Validated {
+		def += " NOT VALID"
+	}
+	return def, nil
+}
+
+func fkAction(a byte) string {
+	switch a {
+	case 'r':
+		return "RESTRICT"
+	case 'c':
+		return "CASCADE"
+	case 'n':
+		return "SET NULL"
+	case 'd':
+		return "SET DEFAULT"
+	}
+	return ""
+}
+
+func (s *relationSchema) index(relid, indexrelid uint32) (PGIndexInfo, bool) {
+	for _, idx := range s.indexes[relid] {
+		if idx.IndexRelID == indexrelid {
+			return idx, true
+		}
+	}
+	return PGIndexInfo{}, false
+}
+
+func (s *relationSchema) accessMethod(indexrelid uint32) string {
+	if am, ok := s.accessMethods[s.relations[indexrelid].AccessMethod]; ok {
+		return am
+	}
+	return "btree"
+}
+
+// indexColumns renders the key columns (with DESC / NULLS options) and the
+// INCLUDE columns of an index
+func (s *relationSchema) indexColumns(idx PGIndexInfo, ctx *exprContext) (keys, include []string, err error) {
+	var exprs []string
+	if idx.Exprs != "" {
+		if exprs, err = ctx.deparseList(idx.Exprs); err != nil {
+			return nil, nil, err
+		}
+	}
+	nkeys := idx.NKeyAtts
+	if nkeys <= 0 || nkeys > len(idx.Keys) {
+		nkeys = len(idx.Keys)
+	}
+	for i, num := range idx.Keys {
+		var col string
+		if num == 0 {
+			if len(exprs) == 0 {
+				return nil, nil, fmt.Errorf("missing index expression")
+			}
+			col, exprs = exprs[0], exprs[1:]
+		} else {
+			names, err := s.columnNames(idx.RelID, []int{num})
+			if err != nil {
+				return nil, nil, err
+			}
+			col = names[0]
+		}
+		if i >= nkeys {
+			include = append(include, col)
+			continue
+		}
+		if i < len(idx.Options) {
+			desc, nullsFirst := idx.Options[i]&indOptionDesc != 0, idx.Options[i]&indOptionNullsFirst != 0
+			switch {
+			case desc && !nullsFirst:
+				col += " DESC NULLS LAST"
+			case desc:
+				col += " DESC"
+			case nullsFirst:
+				col += " NULLS FIRST"
+			}
+		}
+		keys = append(keys, col)
+	}
+	return keys, include, nil
+}
+
+// indexDef renders a CREATE INDEX statement as pg_get_indexdef does
+func (s *relationSchema) indexDef(idx PGIndexInfo, ctx *exprContext) (string, error) {
+	keys, include, err := s.indexColumns(idx, ctx)
+	if err != nil {
+		return "", err
+	}
+	table, ok := s.expr.relations[idx.RelID]
+	if !ok {
+		return "", fmt.Errorf("unknown table %d", idx.RelID)
+	}
+	def := "CREATE INDEX "
+	if idx.Unique {
+		def = "CREATE UNIQUE INDEX "
+	}
+	def += fmt.Sprintf("%s ON %s USING %s (%s)", quoteIdent(s.relations[idx.IndexRelID].Name), table,
+		s.accessMethod(idx.IndexRelID), strings.Join(keys, ", "))
+	if len(include) > 0 {
+		def += " INCLUDE (" + strings.Join(include, ", ") + ")"
+	}
+	if idx.NullsNotDistinct {
+		def += " NULLS NOT DISTINCT"
+	}
+	if idx.Pred != "" {
+		pred, err := ctx.DeparseExpr(idx.Pred)
+		if err != nil {
+			return "", err
+		}
+		def += " WHERE " + pred
+	}
+	return def, nil
+}
+
+// sequenceDumps returns the sequences referenced by described defaults,
+// with their state read through read when it is available
+func (s *relationSchema) sequenceDumps(read func(TableInfo) []byte) []SequenceData {
+	if s == nil {
+		return nil
+	}
+	var seqs []SequenceData
+	for oid := range s.sequences {
+		rel, ok := s.relations[oid]
+		if !ok || rel.Kind != "S" {
+			continue
+		}
+		seq := SequenceData{}
+		if read != nil {
+			if parsed, err := ParseSequenceFile(read(rel)); err == nil {
+				seq = *parsed
+			}
+		}
+		seq.Name, seq.Schema, seq.OID, seq.Filenode = rel.Name, rel.Schema, rel.OID, rel.Filenode
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i].OID < seqs[j].OID })
+	return seqs
+}
+
+// quotedRelationName returns a relation name quoted and qualified by its schema
+func quotedRelationName(schema, name string) string {
+	if schema == "" {
+		return quoteIdent(name)
+	}
+	return quoteIdent(schema) + "." + quoteIdent(name)
+}
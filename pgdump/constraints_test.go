@@ -0,0 +1,223 @@
+package pgdump
+
+import "testing"
+
+// testCatalogTuple builds a catalog tuple from its fixed-width part and its
+// variable-length columns (nil = NULL). The first plain columns keep 4-byte
+// aligned headers, as int2vector and oidvector do; the rest are packed into
+// 1-byte headers when short enough.
+func testCatalogTuple(natts int, fixed []byte, plain int, varlena ...[]byte) []byte {
+	nfixed := natts - len(varlena)
+	bitmap := make([]byte, (natts+7)/8)
+	for i := 0; i < natts; i++ {
+		if i < nfixed || varlena[i-nfixed] != nil {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	data := append([]byte{}, fixed...)
+	for i, v := range varlena {
+		switch {
+		case v == nil:
+		case i >= plain && len(v) < 127:
+			data = append(data, byte((len(v)+1)<<1|1))
+			data = append(data, v...)
+		default:
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+			hdr := make([]byte, 4)
+			putU32(hdr, 0, uint32(len(v)+4)<<2)
+			data = append(append(data, hdr...), v...)
+		}
+	}
+
+	hoff := (23 + len(bitmap) + 7) &^ 7
+	tup := make([]byte, hoff+len(data))
+	putU16(tup, 18, uint16(natts))
+	putU16(tup, 20, 0x0800|0x0001) // HEAP_XMAX_INVALID | HEAP_HASNULL
+	tup[22] = byte(hoff)
+	copy(tup[23:], bitmap)
+	copy(tup[hoff:], data)
+	return tup
+}
+
+// testInt2Array is the payload of a one-dimensional int2[] or int2vector
+func testInt2Array(vals ...int16) []byte {
+	arr := make([]byte, 20+2*len(vals))
+	putU32(arr, 0, 1)
+	putU32(arr, 8, OidInt2)
+	putU32(arr, 12, uint32(len(vals)))
+	putU32(arr, 16, 1)
+	for i, v := range vals {
+		putU16(arr, 20+2*i, uint16(v))
+	}
+	return arr
+}
+
+// testConstraintRow builds a pg_constraint tuple in the PG16 layout
+func testConstraintRow(oid uint32, name string, contype byte, relid, indid, frelid uint32, keys, fkeys []int16, conbin string) []byte {
+	row := make([]byte, 103)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, 2200)
+	row[72] = contype
+	row[75] = 1 // convalidated
+	putU32(row, 76, relid)
+	putU32(row, 84, indid)
+	putU32(row, 92, frelid)
+	row[96], row[97], row[98] = 'a', 'a', 's'
+	row[99] = 1 // conislocal
+
+	var conkey, confkey, bin []byte
+	if keys != nil {
+		conkey = testInt2Array(keys...)
+	}
+	if fkeys != nil {
+		confkey = testInt2Array(fkeys...)
+		row[97] = 'c' // ON DELETE CASCADE
+	}
+	if conbin != "" {
+		bin = []byte(conbin)
+	}
+	return testCatalogTuple(26, row, 0, conkey, confkey, nil, nil, nil, nil, nil, bin)
+}
+
+// testIndexRow builds a pg_index tuple in the PG15+ layout
+func testIndexRow(indexrelid, relid uint32, unique, primary bool, keys []int16, exprs string) []byte {
+	row := make([]byte, 23)
+	putU32(row, 0, indexrelid)
+	putU32(row, 4, relid)
+	putU16(row, 8, uint16(len(keys)))
+	putU16(row, 10, uint16(len(keys)))
+	if unique {
+		row[12] = 1
+	}
+	if primary {
+		row[14] = 1
+	}
+	row[18], row[20], row[21] = 1, 1, 1 // indisvalid, indisready, indislive
+
+	var indexprs []byte
+	if exprs != "" {
+		indexprs = []byte(exprs)
+	}
+	options := testInt2Array(make([]int16, len(keys))...)
+	return testCatalogTuple(21, row, 4, testInt2Array(keys...), nil, nil, options, indexprs, nil)
+}
+
+func testAttrDefRow(oid, relid uint32, num int16, adbin string) []byte {
+	row := make([]byte, 10)
+	putU32(row, 0, oid)
+	putU32(row, 4, relid)
+	putU16(row, 8, uint16(num))
+	return testCatalogTuple(4, row, 0, []byte(adbin))
+}
+
+func testRelationSchema() *relationSchema {
+	tables := map[uint32]TableInfo{
+		16400: {OID: 16400, Filenode: 16400, Name: "customers", Kind: "r", Schema: "public"},
+		16401: {OID: 16401, Filenode: 16401, Name: "customers_pkey", Kind: "i", Schema: "public", AccessMethod: 403},
+		16402: {OID: 16402, Filenode: 16402, Name: "customers_email_idx", Kind: "i", Schema: "public", AccessMethod: 403},
+		16410: {OID: 16410, Filenode: 16410, Name: "orders", Kind: "r", Schema: "public"},
+		16411: {OID: 16411, Filenode: 16411, Name: "orders_pkey", Kind: "i", Schema: "public", AccessMethod: 403},
+		16420: {OID: 16420, Filenode: 16420, Name: "orders_id_seq", Kind: "S", Schema: "public"},
+	}
+	attrs := map[uint32][]AttrInfo{
+		16400: {
+			{Name: "id", TypID: OidInt4, Num: 1, Len: 4, NotNull: true},
+			{Name: "email", TypID: OidText, Num: 2, Len: -1},
+		},
+		16410: {
+			{Name: "id", TypID: OidInt8, Num: 1, Len: 8, NotNull: true},
+			{Name: "customer_id", TypID: OidInt4, Num: 2, Len: 4},
+			{Name: "total", TypID: OidInt4, Num: 3, Len: 4},
+		},
+	}
+
+	nextval := `{FUNCEXPR :funcid 480 :funcresulttype 20 :funcretset false :funcvariadic false :funcformat 0 :funccollid 0 :inputcollid 0 :args ({CONST :consttype 2205 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 64 :constvalue 4 [ 36 64 0 0 0 0 0 0 ]}) :location 56}`
+	check := `{OPEXPR :opno 521 :opfuncid 147 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args ({VAR :varno 1 :varattno 3 :vartype 23 :vartypmod -1 :varcollid 0 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 3 :location 42} {CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 50 :constvalue 4 [ 0 0 0 0 0 0 0 0 ]}) :location 48}`
+	lower := `({FUNCEXPR :funcid 870 :funcresulttype 25 :funcretset false :funcvariadic false :funcformat 0 :funccollid 100 :inputcollid 100 :args ({VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 52}) :location 46})`
+
+	catalogs := map[uint32][]byte{
+		PGProc:     testHeapPage(testNamespaceRow(480, "nextval"), testNamespaceRow(870, "lower")),
+		PGOperator: testHeapPage(testNamespaceRow(521, ">")),
+		PGAttrDef:  testHeapPage(testAttrDefRow(16430, 16410, 1, nextval)),
+		PGConstraint: testHeapPage(
+			testConstraintRow(16440, "customers_pkey", 'p', 16400, 16401, 0, []int16{1}, nil, ""),
+			testConstraintRow(16441, "orders_pkey", 'p', 16410, 16411, 0, []int16{1}, nil, ""),
+			testConstraintRow(16442, "orders_customer_id_fkey", 'f', 16410, 16401, 16400, []int16{2}, []int16{1}, ""),
+			testConstraintRow(16443, "orders_total_check", 'c', 16410, 0, 0, []int16{3}, nil, check),
+		),
+		PGIndex: testHeapPage(
+			testIndexRow(16401, 16400, true, true, []int16{1}, ""),
+			testIndexRow(16402, 16400, false, false, []int16{0}, lower),
+			testIndexRow(16411, 16410, true, true, []int16{1}, ""),
+		),
+	}
+	return newRelationSchema(tables, attrs, nil, catalogs, 0)
+}
+
+func TestParsePGConstraintLayouts(t *testing.T) {
+	data := testHeapPage(testConstraintRow(16442, "orders_customer_id_fkey", 'f', 16410, 16401, 16400, []int16{2}, []int16{1}, ""))
+	if schema := detectConstraintSchema(data, 0); len(schema) != len(schemaPGConstraintV16) || schema[16].Len != 2 {
+		t.Fatal("PG16 pg_constraint layout not detected")
+	}
+	cons := ParsePGConstraint(data, 0)
+	if len(cons) != 1 {
+		t.Fatalf("expected 1 constraint, got %d", len(cons))
+	}
+	c := cons[0]
+	if c.Type != 'f' || c.RelID != 16410 || c.RefRelID != 16400 || c.DeleteAction != 'c' || !c.Validated {
+		t.Errorf("unexpected constraint: %+v", c)
+	}
+	if len(c.Keys) != 1 || c.Keys[0] != 2 || len(c.RefKeys) != 1 || c.RefKeys[0] != 1 {
+		t.Errorf("keys = %v -> %v, want [2] -> [1]", c.Keys, c.RefKeys)
+	}
+
+	idx := ParsePGIndex(testHeapPage(testIndexRow(16401, 16400, true, true, []int16{1, 2}, "")), 0)
+	if len(idx) != 1 || !idx[0].Primary || !idx[0].Valid || len(idx[0].Keys) != 2 || idx[0].Keys[1] != 2 {
+		t.Errorf("unexpected index: %+v", idx)
+	}
+}
+
+func TestRelationSchemaDescribe(t *testing.T) {
+	s := testRelationSchema()
+
+	orders := TableDump{OID: 16410, Schema: "public", Name: "orders", Columns: []ColumnInfo{
+		{Name: "id", TypID: OidInt8}, {Name: "customer_id", TypID: OidInt4}, {Name: "total", TypID: OidInt4},
+	}}
+	s.describe(&orders)
+	if got := orders.Columns[0].Default; got != "nextval('public.orders_id_seq'::regclass)" {
+		t.Errorf("id default = %q", got)
+	}
+	want := map[string]string{
+		"orders_customer_id_fkey": "FOREIGN KEY (customer_id) REFERENCES public.customers(id) ON DELETE CASCADE",
+		"orders_pkey":             "PRIMARY KEY (id)",
+		"orders_total_check":      "CHECK ((total > 0))",
+	}
+	if len(orders.Constraints) != len(want) {
+		t.Errorf("constraints = %+v", orders.Constraints)
+	}
+	for _, c := range orders.Constraints {
+		if c.Definition != want[c.Name] {
+			t.Errorf("%s = %q, want %q", c.Name, c.Definition, want[c.Name])
+		}
+	}
+	if len(orders.Indexes) != 0 || len(orders.Skipped) != 0 {
+		t.Errorf("orders: indexes %v, skipped %v", orders.Indexes, orders.Skipped)
+	}
+
+	customers := TableDump{OID: 16400, Schema: "public", Name: "customers", Columns: []ColumnInfo{
+		{Name: "id", TypID: OidInt4}, {Name: "email", TypID: OidText},
+	}}
+	s.describe(&customers)
+	if len(customers.Indexes) != 1 || customers.Indexes[0].Definition != "CREATE INDEX customers_email_idx ON public.customers USING btree (lower(email))" {
+		t.Errorf("customers indexes = %+v", customers.Indexes)
+	}
+
+	seqs := s.sequenceDumps(nil)
+	if len(seqs) != 1 || seqs[0].Name != "orders_id_seq" || seqs[0].Schema != "public" {
+		t.Errorf("sequences = %+v", seqs)
+	}
+}
@@ -396,3 +396,12 @@ func ReadControlFile(dataDir string) (*ControlFile, error) {
 	}
 	return ParseControlFile(data)
 }
+
+// SegmentSize returns the relation segment size in bytes (BlocksPerSeg * BlockSize),
+// or DefaultSegmentSize if the storage parameters look implausible.
+func (cf *ControlFile) SegmentSize() int {
+	if cf == nil || cf.BlocksPerSeg == 0 || cf.BlockSize < 1024 || cf.BlockSize > 32768 {
+		return DefaultSegmentSize
+	}
+	return int(cf.BlocksPerSeg) * int(cf.BlockSize)
+}
@@ -165,6 +165,24 @@ func TestControlFileTooSmall(t *testing.T) {
 	}
 }
 
+func TestControlFileSegmentSize(t *testing.T) {
+	tests := []struct {
+		cf   *ControlFile
+		want int
+	}{
+		{nil, DefaultSegmentSize},
+		{&ControlFile{BlockSize: 8192, BlocksPerSeg: 131072}, DefaultSegmentSize},
+		{&ControlFile{BlockSize: 8192, BlocksPerSeg: 16}, 16 * 8192},
+		{&ControlFile{BlockSize: 8192}, DefaultSegmentSize},
+		{&ControlFile{BlockSize: 3, BlocksPerSeg: 16}, DefaultSegmentSize},
+	}
+	for _, tt := range tests {
+		if got := tt.cf.SegmentSize(); got != tt.want {
+			t.Errorf("SegmentSize(%+v) = %d, want %d", tt.cf, got, tt.want)
+		}
+	}
+}
+
 // Helper functions
 func putU32(data []byte, offset int, val uint32) {
 	data[offset] = byte(val)
@@ -0,0 +1,202 @@
+package pgdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ToCopy writes the dump result as a psql script that loads the rows with
+// COPY ... FROM stdin instead of INSERT, which is much faster to restore.
+func (r *DumpResult) ToCopy(w io.Writer) error {
+	return r.writeTo(NewCopyWriter(w))
+}
+
+// NewCopyWriter returns a DumpWriter producing the output of ToCopy
+func NewCopyWriter(w io.Writer) DumpWriter {
+	return &scriptWriter{w: w, table: (*TableDump).writeCopy, header: true}
+}
+
+// ToCopy writes a single database dump like ToSQL, with COPY data blocks
+func (d *DatabaseDump) ToCopy(w io.Writer) error {
+	return d.writeTo(&scriptWriter{w: w, table: (*TableDump).writeCopy})
+}
+
+// ToCopy writes a single table as CREATE TABLE and a COPY data block in
+// text format, terminated by \.
+func (t *TableDump) ToCopy(w io.Writer) error {
+	return t.writeCopy(w, rowSlice(t.Rows))
+}
+
+func (t *TableDump) writeCopy(w io.Writer, rows *RowIterator) error {
+	t.writeHeader(w, rows)
+	fmt.Fprintln(w, t.createTableSQL())
+	if len(t.Columns) == 0 {
+		return nil
+	}
+
+	n := 0
+	for rows.Next() {
+		if n == 0 {
+			fmt.Fprintln(w, t.copyStatement())
+		}
+		if _, err := fmt.Fprintln(w, t.copyRow(rows.Row())); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n > 0 {
+		if _, err := fmt.Fprintln(w, `\.`); err != nil {
+			return err
+		}
+	}
+	if err := t.writeFooter(w, rows, n); err != nil {
+		return err
+	}
+	return t.writeDeletedSQL(w)
+}
+
+// copyStatement returns the COPY ... FROM stdin header for the table
+func (t *TableDump) copyStatement() string {
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = quoteIdent(col.sqlName())
+	}
+	return fmt.Sprintf("COPY %s (%s) FROM stdin;", t.quotedName(), strings.Join(cols, ", "))
+}
+
+// copyRow formats a row as one line of text COPY data, without the newline
+func (t *TableDump) copyRow(row Row) string {
+	fields := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		val, ok := row.at(i, col.Name)
+		if !ok || val == nil {
+			fields[i] = `\N`
+		} else {
+			fields[i] = copyEscape(copyText(val, col.TypID))
+		}
+	}
+	return strings.Join(fields, "\t")
+}
+
+// copyText renders a value the way the type's output function does, which is
+// what COPY FROM parses back
+func copyText(val interface{}, typID int) string {
+	if typID == OidJSON || typID == OidJSONB {
+		return jsonText(val)
+	}
+
+	switch v := val.(type) {
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case int, int16, int32, int64, uint32:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return floatText(float64(v), 32)
+	case float64:
+		return floatText(v, 64)
+	case string:
+		return v
+	case []interface{}:
+		return arrayText(v, arrayElemTypes[typID])
+	case Record:
+		return v.String()
+	case map[string]interface{}:
+		return jsonText(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// floatText spells infinities and NaN as float8in expects them
+func floatText(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits)
+}
+
+func jsonText(v interface{}) string {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// arrayText formats an array literal, {a,"b c",NULL}
+func arrayText(elems []interface{}, elemType int) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, elem := range elems {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		switch e := elem.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case []interface{}:
+			sb.WriteString(arrayText(e, elemType))
+		default:
+			sb.WriteString(arrayElemQuote(copyText(e, elemType)))
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// arrayElemQuote double-quotes an array element when array_in would
+// otherwise misread it
+func arrayElemQuote(s string) string {
+	if s != "" && !strings.EqualFold(s, "NULL") && !strings.ContainsAny(s, "{}\",\\ \t\n\r\v\f") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// copyEscape applies text COPY escaping: backslashes and the control
+// characters that would end a field or a line
+func copyEscape(s string) string {
+	if !strings.ContainsAny(s, "\\\b\f\n\r\t\v") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\v':
+			sb.WriteString(`\v`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package pgdump
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTableToCopy(t *testing.T) {
+	table := TableDump{
+		Schema: "public",
+		Name:   "files",
+		Columns: []ColumnInfo{
+			{Name: "id", Type: "int4", TypID: OidInt4},
+			{Name: "body", Type: "bytea", TypID: OidBytea},
+			{Name: "tags", Type: "text[]", TypID: 1009},
+			{Name: "meta", Type: "jsonb", TypID: OidJSONB},
+		},
+		Rows: []Row{
+			testRow("id", int32(1), "body", "\\x00ff", "tags", []interface{}{"a", "b c"}, "meta", map[string]interface{}{"k": "v\tw"}),
+			testRow("id", int32(2), "body", nil),
+		},
+		RowCount: 2,
+	}
+
+	var buf bytes.Buffer
+	if err := table.ToCopy(&buf); err != nil {
+		t.Fatalf("ToCopy failed: %v", err)
+	}
+	want := `COPY public.files (id, body, tags, meta) FROM stdin;
+1	\\x00ff	{a,"b c"}	{"k":"v\\tw"}
+2	\N	\N	\N
+\.
+`
+	out := buf.String()
+	if !strings.HasPrefix(out, "-- Table: public.files (2 rows)\nCREATE TABLE IF NOT EXISTS public.files (") {
+		t.Errorf("missing CREATE TABLE in:\n%s", out)
+	}
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", out, want)
+	}
+
+	buf.Reset()
+	empty := TableDump{Name: "empty", Columns: table.Columns}
+	if err := empty.ToCopy(&buf); err != nil {
+		t.Fatalf("ToCopy failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "COPY") {
+		t.Errorf("COPY block for an empty table:\n%s", buf.String())
+	}
+}
+
+func TestDumpResultToCopy(t *testing.T) {
+	result := DumpResult{Databases: []DatabaseDump{testArchiveDatabase()}}
+	var buf bytes.Buffer
+	if err := result.ToCopy(&buf); err != nil {
+		t.Fatalf("ToCopy failed: %v", err)
+	}
+	out := buf.String()
+
+	ordered := []string{
+		"-- Database: shop",
+		"CREATE SCHEMA IF NOT EXISTS public;",
+		"COPY public.customers (id, note) FROM stdin;\n1\ta\\tb\\\\c\\nd\n2\t\\N\n\\.\n",
+		"COPY public.orders (id, customer_id) FROM stdin;\n10\t1\n\\.\n",
+		"ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_customer_id_fkey",
+	}
+	last := -1
+	for _, want := range ordered {
+		i := strings.Index(out, want)
+		if i < 0 {
+			t.Errorf("missing %q in:\n%s", want, out)
+			continue
+		}
+		if i < last {
+			t.Errorf("%q is out of order", want)
+		}
+		last = i
+	}
+	if strings.Contains(out, "INSERT INTO") {
+		t.Error("COPY script contains INSERT statements")
+	}
+}
+
+func TestCopyText(t *testing.T) {
+	tests := []struct {
+		val   interface{}
+		typID int
+		want  string
+	}{
+		{true, OidBool, "t"},
+		{int16(-3), OidInt2, "-3"},
+		{float64(1.5), OidFloat8, "1.5"},
+		{float32(0.1), OidFloat4, "0.1"},
+		{"\\xdead", OidBytea, `\\xdead`},
+		{"line1\nline2", OidText, `line1\nline2`},
+		{[]interface{}{int32(1), nil, int32(3)}, 1007, "{1,NULL,3}"},
+		{[]interface{}{"a b", "", "null", `q"x`}, 1009, `{"a b","","null","q\\"x"}`},
+		{map[string]interface{}{"k": "<v>"}, OidJSONB, `{"k":"<v>"}`},
+		{[]interface{}{float64(1), "x"}, OidJSONB, `[1,"x"]`},
+		{"plain", OidJSON, `"plain"`},
+	}
+	for _, tt := range tests {
+		if got := copyEscape(copyText(tt.val, tt.typID)); got != tt.want {
+			t.Errorf("copy text of %#v (%d) = %q, want %q", tt.val, tt.typID, got, tt.want)
+		}
+	}
+	if got := copyEscape(copyText(math.Inf(-1), OidFloat8)); got != "-Infinity" {
+		t.Errorf("-Inf = %q", got)
+	}
+	if !strings.Contains((&TableDump{Name: "t", Columns: []ColumnInfo{{Name: "select"}}}).copyStatement(), `("select")`) {
+		t.Error("reserved column name not quoted in COPY")
+	}
+}
@@ -10,61 +10,100 @@ import (
 // ToCSV writes the dump result as CSV to the writer
 // Each table becomes a separate CSV section with a header
 func (r *DumpResult) ToCSV(w io.Writer) error {
-	for _, db := range r.Databases {
-		if err := db.ToCSV(w); err != nil {
-			return err
-		}
+	return r.writeTo(NewCSVWriter(w))
+}
+
+// NewCSVWriter returns a DumpWriter producing the output of ToCSV
+func NewCSVWriter(w io.Writer) DumpWriter {
+	return &csvWriter{w: w}
+}
+
+// csvWriter writes one CSV section per table
+type csvWriter struct {
+	w io.Writer
+}
+
+func (c *csvWriter) BeginDatabase(*DatabaseDump) error { return nil }
+
+func (c *csvWriter) WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	fmt.Fprintf(c.w, "# Database: %s, Table: %s\n", db.Name, t.QualifiedName())
+	if err := t.writeCSV(c.w, rows); err != nil {
+		return err
 	}
-	return nil
+	_, err := fmt.Fprintln(c.w) // Empty line between tables
+	return err
 }
 
+func (c *csvWriter) EndDatabase(*DatabaseDump) error { return nil }
+
+func (c *csvWriter) Close() error { return nil }
+
 // ToCSV writes a single database dump as CSV
 func (d *DatabaseDump) ToCSV(w io.Writer) error {
-	for _, table := range d.Tables {
-		fmt.Fprintf(w, "# Database: %s, Table: %s\n", d.Name, table.Name)
-		if err := table.ToCSV(w); err != nil {
-			return err
-		}
-		fmt.Fprintln(w) // Empty line between tables
-	}
-	return nil
+	return d.writeTo(&csvWriter{w: w})
 }
 
 // ToCSV writes a single table as CSV
 func (t *TableDump) ToCSV(w io.Writer) error {
-	cw := csv.NewWriter(w)
-	defer cw.Flush()
+	return t.writeCSV(w, rowSlice(t.Rows))
+}
 
+func (t *TableDump) writeCSV(w io.Writer, rows *RowIterator) error {
 	// Write header
 	if len(t.Columns) == 0 {
 		return nil
 	}
 
+	// Deleted rows follow the live ones, marked in an extra _deleted column
+	marked := len(t.DeletedRows) > 0
+
+	cw := csv.NewWriter(w)
 	header := make([]string, len(t.Columns))
 	for i, col := range t.Columns {
 		header[i] = col.Name
 	}
+	if marked {
+		header = append(header, "_deleted")
+	}
 	if err := cw.Write(header); err != nil {
 		return err
 	}
 
 	// Write rows
-	for _, row := range t.Rows {
-		record := make([]string, len(t.Columns))
-		for i, col := range t.Columns {
-			val, ok := row[col.Name]
-			if !ok || val == nil {
-				record[i] = ""
-			} else {
-				record[i] = formatCSVValue(val)
-			}
+	for rows.Next() {
+		record := t.csvRecord(rows.Row())
+		if marked {
+			record = append(record, "false")
 		}
 		if err := cw.Write(record); err != nil {
 			return err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, d := range t.DeletedRows {
+		if err := cw.Write(append(t.csvRecord(d.Data), "true")); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRecord formats a row as CSV fields, NULL as an empty field
+func (t *TableDump) csvRecord(row Row) []string {
+	record := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		val, ok := row.at(i, col.Name)
+		if !ok || val == nil {
+			record[i] = ""
+		} else {
+			record[i] = formatCSVValue(val)
+		}
+	}
+	return record
 }
 
 // formatCSVValue formats a Go value as a CSV string
@@ -97,6 +136,10 @@ func formatCSVValue(val interface{}) string {
 		b, _ := json.Marshal(v)
 		return string(b)
 
+	case Record:
+		// Composite - record literal, as COPY ... CSV reads it back
+		return v.String()
+
 	case map[string]interface{}:
 		// JSON/JSONB - JSON encode
 		b, _ := json.Marshal(v)
@@ -0,0 +1,156 @@
+package pgdump
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Date/time values are printed as PostgreSQL does with DateStyle ISO and
+// IntervalStyle postgres, so they load back unchanged
+
+// Reserved values for -infinity and infinity (datatype/timestamp.h)
+const (
+	dateNoBegin = math.MinInt32
+	dateNoEnd   = math.MaxInt32
+	dtNoBegin   = math.MinInt64
+	dtNoEnd     = math.MaxInt64
+)
+
+// formatDate prints days since 2000-01-01 as date_out does
+func formatDate(days int32) string {
+	switch days {
+	case dateNoBegin:
+		return "-infinity"
+	case dateNoEnd:
+		return "infinity"
+	}
+	t := pgEpoch.AddDate(0, 0, int(days))
+	return isoDate(t) + bcSuffix(t)
+}
+
+// formatTimestamp prints microseconds since 2000-01-01 00:00 UTC. With a
+// location the value is a timestamptz, shown in that zone with its offset.
+func formatTimestamp(us int64, loc *time.Location) string {
+	switch us {
+	case dtNoBegin:
+		return "-infinity"
+	case dtNoEnd:
+		return "infinity"
+	}
+	// time.Duration overflows past 292 years, so go through seconds
+	secs, frac := us/1e6, us%1e6
+	if frac < 0 {
+		secs, frac = secs-1, frac+1e6
+	}
+	t := time.Unix(pgEpoch.Unix()+secs, 0).UTC()
+
+	zone := ""
+	if loc != nil {
+		t = t.In(loc)
+		_, offset := t.Zone()
+		zone = formatOffset(offset)
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d%s%s%s", isoDate(t), t.Hour(), t.Minute(), t.Second(), fraction(frac), zone, bcSuffix(t))
+}
+
+// formatTime prints microseconds since midnight as HH:MM:SS[.ffffff]
+func formatTime(us int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s", us/3600e6, us/60e6%60, us/1e6%60, fraction(us%1e6))
+}
+
+// formatTimeTZ prints a timetz. The zone is stored in seconds west of
+// UTC, the opposite sign of the offset shown.
+func formatTimeTZ(us int64, zone int32) string {
+	return formatTime(us) + formatOffset(-int(zone))
+}
+
+// formatInterval prints an interval as interval_out does with
+// IntervalStyle postgres: "1 year 2 mons -3 days +04:05:06.5"
+func formatInterval(us int64, days, months int32) string {
+	switch {
+	case months == math.MaxInt32 && days == math.MaxInt32 && us == math.MaxInt64:
+		return "infinity"
+	case months == math.MinInt32 && days == math.MinInt32 && us == math.MinInt64:
+		return "-infinity"
+	}
+
+	var sb strings.Builder
+	isZero, isBefore := true, false
+	part := func(v int64, unit string) {
+		if v == 0 {
+			return
+		}
+		if !isZero {
+			sb.WriteByte(' ')
+		}
+		if isBefore && v > 0 {
+			sb.WriteByte('+')
+		}
+		fmt.Fprintf(&sb, "%d %s", v, unit)
+		if v != 1 {
+			sb.WriteByte('s')
+		}
+		isZero, isBefore = false, v < 0
+	}
+	part(int64(months/12), "year")
+	part(int64(months%12), "mon")
+	part(int64(days), "day")
+
+	if isZero || us != 0 {
+		if !isZero {
+			sb.WriteByte(' ')
+		}
+		switch {
+		case us < 0:
+			sb.WriteByte('-')
+			us = -us
+		case isBefore:
+			sb.WriteByte('+')
+		}
+		sb.WriteString(formatTime(us))
+	}
+	return sb.String()
+}
+
+// isoDate prints the date part, years BC counted from 1 as PostgreSQL does
+func isoDate(t time.Time) string {
+	year := t.Year()
+	if year <= 0 {
+		year = 1 - year
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, t.Month(), t.Day())
+}
+
+func bcSuffix(t time.Time) string {
+	if t.Year() <= 0 {
+		return " BC"
+	}
+	return ""
+}
+
+// fraction prints microseconds as a fraction of a second, without
+// trailing zeros
+func fraction(us int64) string {
+	if us == 0 {
+		return ""
+	}
+	return strings.TrimRight(fmt.Sprintf(".%06d", us), "0")
+}
+
+// formatOffset prints a UTC offset in seconds as +HH[:MM[:SS]]
+func formatOffset(secs int) string {
+	sign := byte('+')
+	if secs < 0 {
+		sign, secs = '-', -secs
+	}
+	s := fmt.Sprintf("%c%02d", sign, secs/3600)
+	if m, sec := secs/60%60, secs%60; m != 0 || sec != 0 {
+		s += fmt.Sprintf(":%02d", m)
+		if sec != 0 {
+			s += fmt.Sprintf(":%02d", sec)
+		}
+	}
+	return s
+}
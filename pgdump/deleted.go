@@ -2,55 +2,83 @@ package pgdump
 
 // DeletedRow represents a deleted but not vacuumed row
 type DeletedRow struct {
-	PageOffset int                    `json:"page_offset"`
-	ItemOffset int                    `json:"item_offset"`
-	Data       map[string]interface{} `json:"data,omitempty"`
-	RawSize    int                    `json:"raw_size"`
+	PageOffset int         `json:"page_offset"`
+	ItemOffset int         `json:"item_offset"`
+	Ctid       ItemPointer `json:"ctid"`
+	Xmin       uint32      `json:"xmin"`
+	Xmax       uint32      `json:"xmax"`              // the transaction that deleted it
+	Updated    bool        `json:"updated,omitempty"` // an UPDATE replaced it rather than a DELETE
+	Data       Row         `json:"data"`
+	RawSize    int         `json:"raw_size"`
 }
 
 // ReadDeletedRows scans for deleted tuples that haven't been vacuumed yet
 // These are tuples where xmax is committed (meaning DELETE was committed)
 func ReadDeletedRows(data []byte, columns []Column) []DeletedRow {
 	var deleted []DeletedRow
-
+	dec := &rowDecoder{}
 	for _, entry := range ReadTuples(data, false) { // Get ALL tuples including dead
-		tuple := entry.Tuple
-		if tuple == nil {
+		if !dec.deleted(entry.Tuple) {
 			continue
 		}
+		// Try to decode the data if we have schema
+		var row Row
+		if len(columns) > 0 {
+			row = dec.decodeTuple(entry.Tuple, columns, nil)
+		}
+		deleted = append(deleted, newDeletedRow(entry, row))
+	}
+	return deleted
+}
 
-		// Check if this tuple is deleted (xmax committed, not xmax invalid)
-		if tuple.Header.XmaxCommitted && !tuple.Header.XmaxInvalid {
-			row := DeletedRow{
-				PageOffset: entry.PageOffset,
-				RawSize:    len(tuple.Data),
-			}
+// newDeletedRow describes the dead tuple of entry, decoded as row
+func newDeletedRow(entry TupleEntry, row Row) DeletedRow {
+	h := entry.Tuple.Header
+	ctid := ItemPointer{Block: uint32(entry.PageOffset / PageSize), Offset: entry.Item}
+	return DeletedRow{
+		PageOffset: entry.PageOffset,
+		ItemOffset: int(entry.Item),
+		Ctid:       ctid,
+		Xmin:       h.Xmin,
+		Xmax:       h.Xmax,
+		Updated:    h.Ctid != ctid,
+		Data:       row,
+		RawSize:    len(entry.Tuple.Data),
+	}
+}
 
-			// Try to decode the data if we have schema
-			if len(columns) > 0 {
-				row.Data = DecodeTuple(tuple, columns)
-			}
+// isDeleted reports whether a committed DELETE or UPDATE removed the tuple
+// of a committed insert. Until VACUUM, the tuple stays on its page.
+func isDeleted(t *HeapTupleData, clog *CommitLog) bool {
+	switch t.XminStatus(clog) {
+	case TxAborted, TxInProgress:
+		return false
+	}
+	return t.XmaxStatus(clog) == TxCommitted
+}
 
-			deleted = append(deleted, row)
+// deletedRows reads the iterator's pages for the rows deleted but not
+// vacuumed, decoded and converted like its live rows. Rows an as-of
+// snapshot still sees are live rows, not deleted ones.
+func (it *RowIterator) deletedRows() ([]DeletedRow, error) {
+	if !it.streaming() {
+		return nil, nil
+	}
+	var deleted []DeletedRow
+	for page := it.readPage(); page != nil; page = it.readPage() {
+		for _, e := range pageTuples(page, int(it.off-PageSize), it.dec.deleted) {
+			deleted = append(deleted, newDeletedRow(e, it.entryRow(e)))
 		}
 	}
-
-	return deleted
+	return deleted, it.err
 }
 
-// ScanAllDeletedRows scans entire data directory for deleted rows
+// ScanAllDeletedRows dumps a data directory like DumpDataDir, with the
+// deleted rows of each table in TableDump.DeletedRows
 func ScanAllDeletedRows(dataDir string, opts *Options) (*DumpResult, error) {
-	opts = withDefaults(opts)
-	
-	// Use regular dump but include deleted rows
-	result, err := DumpDataDir(dataDir, opts)
-	if err != nil {
-		return nil, err
-	}
-
-	// Mark this as including deleted rows
-	// The actual deleted row detection happens in ReadRows when we pass visibleOnly=false
-	return result, nil
+	o := *withDefaults(opts)
+	o.IncludeDeleted = true
+	return DumpDataDir(dataDir, &o)
 }
 
 // ReadRowsWithDeleted returns both visible and deleted rows separately
@@ -68,7 +96,7 @@ func ReadRowsWithDeleted(data []byte, columns []Column) (visible []map[string]in
 
 		if tuple.IsVisible() {
 			visible = append(visible, row)
-		} else if tuple.Header.XmaxCommitted && !tuple.Header.XmaxInvalid {
+		} else if isDeleted(tuple, nil) {
 			// Deleted but not vacuumed
 			deleted = append(deleted, row)
 		}
@@ -0,0 +1,95 @@
+package pgdump
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDeletedRows(t *testing.T) {
+	at := func(off uint16) ItemPointer { return ItemPointer{Block: 1, Offset: off} }
+	locked := testVersion(100, 101, at(6), 0, 5, 50)
+	putU16(locked, 20, heapXmaxLockOnly)
+	page := testHeapPage(
+		testVersion(100, 0, at(1), 0, 1, 10),
+		testVersion(100, 101, at(2), 0, 2, 20), // deleted, no hint bits
+		testVersion(100, 102, at(4), 0, 3, 30), // updated
+		testVersion(102, 0, at(4), 0, 3, 31),   // its new version
+		testVersion(103, 104, at(5), 0, 4, 40), // inserted by an aborted transaction
+		locked,
+	)
+	clog := testCommitLog("pg_xact", map[uint32]byte{100: clogCommitted, 101: clogCommitted, 102: clogCommitted, 103: clogAborted, 104: clogCommitted}, nil, nil)
+	it := newRowIterator(bytes.NewReader(append(make([]byte, PageSize), page...)), testHistoryColumns, &rowDecoder{clog: clog}, nil, nil)
+
+	deleted, err := it.deletedRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DeletedRow{
+		{PageOffset: PageSize, ItemOffset: 2, Ctid: ItemPointer{1, 2}, Xmin: 100, Xmax: 101, Data: testRow("id", int32(2), "v", int32(20)), RawSize: 8},
+		{PageOffset: PageSize, ItemOffset: 3, Ctid: ItemPointer{1, 3}, Xmin: 100, Xmax: 102, Updated: true, Data: testRow("id", int32(3), "v", int32(30)), RawSize: 8},
+	}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deletedRows =\n%+v\nwant\n%+v", deleted, want)
+	}
+
+	// Without pg_xact, only the XMAX_COMMITTED hint bit tells
+	if got := ReadDeletedRows(page, testHistoryColumns); len(got) != 0 {
+		t.Errorf("ReadDeletedRows without hint bits = %+v", got)
+	}
+	putU16(page, int(u16(page, headerSize+4)&0x7FFF)+20, 0x0400)
+	if got := ReadDeletedRows(page, testHistoryColumns); len(got) != 1 || got[0].ItemOffset != 2 {
+		t.Errorf("ReadDeletedRows = %+v, want the row at item 2", got)
+	}
+}
+
+func TestDeletedRowsOutput(t *testing.T) {
+	table := TableDump{
+		Name: "notes",
+		Columns: []ColumnInfo{
+			{Name: "id", Type: "int4", TypID: OidInt4},
+			{Name: "body", Type: "text", TypID: OidText},
+		},
+		Rows:     []Row{testRow("id", int32(1), "body", "kept")},
+		RowCount: 1,
+		DeletedRows: []DeletedRow{
+			{Ctid: ItemPointer{0, 2}, Xmin: 100, Xmax: 105, Data: testRow("id", int32(2), "body", "two\nlines")},
+		},
+	}
+
+	var sql bytes.Buffer
+	if err := table.ToSQL(&sql); err != nil {
+		t.Fatal(err)
+	}
+	want := "-- Deleted rows of notes, not vacuumed yet (1 rows)\n" +
+		"-- INSERT INTO notes (id, body) VALUES (2, 'two\n-- lines'); -- ctid (0,2), xmin 100, xmax 105\n"
+	if !strings.HasSuffix(sql.String(), want) {
+		t.Errorf("ToSQL =\n%s\nwant suffix\n%s", sql.String(), want)
+	}
+
+	var copyOut bytes.Buffer
+	if err := table.ToCopy(&copyOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(copyOut.String(), "\\.\n"+want) {
+		t.Errorf("ToCopy =\n%s", copyOut.String())
+	}
+
+	var csvOut bytes.Buffer
+	if err := table.ToCSV(&csvOut); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,body,_deleted\n1,kept,false\n2,\"two\nlines\",true\n"; csvOut.String() != want {
+		t.Errorf("ToCSV =\n%s\nwant\n%s", csvOut.String(), want)
+	}
+
+	var grid bytes.Buffer
+	result := &DumpResult{Databases: []DatabaseDump{{Name: "db", Tables: []TableDump{table}}}}
+	result.TableFormat(&grid)
+	for _, want := range []string{"(1 rows, 1 deleted)", " id int4 | body text ", `two\nlines  -- deleted: ctid (0,2), xmin 100, xmax 105`} {
+		if !strings.Contains(grid.String(), want) {
+			t.Errorf("TableFormat missing %q:\n%s", want, grid.String())
+		}
+	}
+}
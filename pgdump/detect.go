@@ -161,14 +161,9 @@ func getWindowsPaths() []string {
 }
 
 func isValidDataDir(path string) bool {
-	// Must have global/1262 (pg_database)
-	pgDatabase := filepath.Join(path, "global", "1262")
-	info, err := os.Stat(pgDatabase)
-	if err != nil {
-		return false
-	}
-	// Should be a file with some content
-	return info.Mode().IsRegular() && info.Size() > 0
+	// Must have a readable, non-empty pg_database (global/1262 unless remapped)
+	data, err := ReadGlobalCatalog(path, PGDatabase)
+	return err == nil && len(data) > 0
 }
 
 func expandPath(path string) string {
@@ -185,8 +180,7 @@ func expandPath(path string) string {
 
 // ListDatabases returns databases found in data directory (quick scan)
 func ListDatabases(dataDir string) []DatabaseInfo {
-	pgDatabase := filepath.Join(dataDir, "global", "1262")
-	data, err := os.ReadFile(pgDatabase)
+	data, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil
 	}
@@ -2,11 +2,8 @@ package pgdump
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
-	"strconv"
 )
 
 // DroppedColumnInfo contains information about a dropped column
@@ -88,26 +85,24 @@ func FindDroppedColumns(dataDir, dbName string) (*DroppedColumnsResult, error) {
 	}
 	
 	// First, find the database OID
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read pg_database: %w", err)
 	}
 	
-	dbOID := FindDatabaseOID(dbData, dbName)
-	if dbOID == 0 {
+	db := FindDatabase(dbData, dbName)
+	if db == nil {
 		return nil, fmt.Errorf("database %q not found", dbName)
 	}
 
-	basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(dbOID), 10))
-
 	// Read pg_attribute
-	attrData, err := os.ReadFile(filepath.Join(basePath, "1249"))
+	attrData, err := ReadDatabaseCatalog(dataDir, *db, PGAttribute)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read pg_attribute: %w", err)
 	}
 	
 	// Read pg_class for table names
-	classData, err := os.ReadFile(filepath.Join(basePath, "1259"))
+	classData, err := ReadDatabaseCatalog(dataDir, *db, PGClass)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read pg_class: %w", err)
 	}
@@ -198,20 +193,18 @@ func parseDroppedColumns(data []byte, tableNames map[uint32]string) []DroppedCol
 // RecoverDroppedColumnData attempts to recover data from a dropped column
 func RecoverDroppedColumnData(dataDir, dbName, tableName string, attNum int) (*DroppedColumnData, error) {
 	// Find database OID
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
 	
-	dbOID := FindDatabaseOID(dbData, dbName)
-	if dbOID == 0 {
+	db := FindDatabase(dbData, dbName)
+	if db == nil {
 		return nil, fmt.Errorf("database %q not found", dbName)
 	}
 
-	basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(dbOID), 10))
-
 	// Find table filenode
-	classData, err := os.ReadFile(filepath.Join(basePath, "1259"))
+	classData, err := ReadDatabaseCatalog(dataDir, *db, PGClass)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +223,7 @@ func RecoverDroppedColumnData(dataDir, dbName, tableName string, attNum int) (*D
 	}
 	
 	// Get all attributes including dropped ones
-	attrData, err := os.ReadFile(filepath.Join(basePath, "1249"))
+	attrData, err := ReadDatabaseCatalog(dataDir, *db, PGAttribute)
 	if err != nil {
 		return nil, err
 	}
@@ -255,7 +248,9 @@ func RecoverDroppedColumnData(dataDir, dbName, tableName string, attNum int) (*D
 	}
 	
 	// Read table data
-	tableData, err := os.ReadFile(filepath.Join(basePath, strconv.FormatUint(uint64(tableInfo.Filenode), 10)))
+	local := LocalReader(dataDir)
+	tablePath := loadLocalTablespaces(dataDir, nil).RelationPath(*db, tableInfo.Tablespace, tableInfo.Filenode)
+	tableData, err := ReadRelation(local, tablePath, relationSegmentSize(local))
 	if err != nil {
 		return nil, fmt.Errorf("cannot read table data: %w", err)
 	}
@@ -367,7 +362,7 @@ func ScanDroppedColumns(dataDir string) ([]DroppedColumnsResult, error) {
 	var results []DroppedColumnsResult
 	
 	// Read database list
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
@@ -392,19 +387,17 @@ func ScanDroppedColumns(dataDir string) ([]DroppedColumnsResult, error) {
 
 // GetDroppedColumnSchema returns a schema that includes dropped columns for a table
 func GetDroppedColumnSchema(dataDir, dbName, tableName string) ([]Column, error) {
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
 	
-	dbOID := FindDatabaseOID(dbData, dbName)
-	if dbOID == 0 {
+	db := FindDatabase(dbData, dbName)
+	if db == nil {
 		return nil, fmt.Errorf("database %q not found", dbName)
 	}
 
-	basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(dbOID), 10))
-
-	classData, err := os.ReadFile(filepath.Join(basePath, "1259"))
+	classData, err := ReadDatabaseCatalog(dataDir, *db, PGClass)
 	if err != nil {
 		return nil, err
 	}
@@ -421,7 +414,7 @@ func GetDroppedColumnSchema(dataDir, dbName, tableName string) ([]Column, error)
 		return nil, fmt.Errorf("table %q not found", tableName)
 	}
 	
-	attrData, err := os.ReadFile(filepath.Join(basePath, "1249"))
+	attrData, err := ReadDatabaseCatalog(dataDir, *db, PGAttribute)
 	if err != nil {
 		return nil, err
 	}
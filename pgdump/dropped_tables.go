@@ -0,0 +1,97 @@
+package pgdump
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ScanDroppedTables finds the tables of the databases opts selects that a
+// committed DROP TABLE removed, from the dead pg_class and pg_attribute
+// tuples VACUUM has not reclaimed yet. Each comes back as a TableDump with
+// Dropped set, its name, filenode and columns as they were before the
+// drop, and the rows of its data file if the file is still on disk.
+func ScanDroppedTables(dataDir string, opts *Options) (*DumpResult, error) {
+	return ScanDroppedTablesContext(context.Background(), dataDir, opts)
+}
+
+// ScanDroppedTablesContext is ScanDroppedTables stopping early with ctx's
+// error once ctx is done
+func ScanDroppedTablesContext(ctx context.Context, dataDir string, opts *Options) (*DumpResult, error) {
+	opts = withDefaults(opts)
+
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
+	if err != nil {
+		return nil, err
+	}
+	s := newOrphanScan(ctx, dataDir, opts)
+
+	result := &DumpResult{}
+	for _, db := range ParsePGDatabase(dbData) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if isTemplateDB(db.Name) || (opts.DatabaseFilter != "" && db.Name != opts.DatabaseFilter) {
+			continue
+		}
+		tables, err := s.droppedTables(db)
+		if err != nil {
+			return nil, err
+		}
+		if len(tables) > 0 {
+			result.Databases = append(result.Databases, DatabaseDump{OID: db.OID, Name: db.Name, Tables: tables})
+		}
+	}
+	return result, nil
+}
+
+// droppedTables finds the dropped tables of db, in OID order
+func (s *orphanScan) droppedTables(db DatabaseInfo) ([]TableDump, error) {
+	cat := s.catalogs(db)
+	if cat == nil {
+		return nil, nil
+	}
+
+	// the last version of each relation no live entry describes anymore,
+	// not one a rolled back ALTER TABLE wrote
+	type entry struct {
+		info  TableInfo
+		tuple *HeapTupleData
+	}
+	last := make(map[uint32]entry)
+	for _, e := range ReadTuples(cat.class, false) {
+		info := classInfo(DecodeTuple(e.Tuple, schemaPGClass))
+		if info.OID == 0 || cat.liveOIDs[info.OID] {
+			continue
+		}
+		if prev, ok := last[info.OID]; ok && !e.Tuple.supersedes(prev.tuple, s.clog) {
+			continue
+		}
+		last[info.OID] = entry{info, e.Tuple}
+	}
+	oids := make([]uint32, 0, len(last))
+	for oid := range last {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i, j int) bool { return oids[i] < oids[j] })
+
+	var tables []TableDump
+	for _, oid := range oids {
+		if err := s.context.Err(); err != nil {
+			return nil, err
+		}
+		e := last[oid]
+		// a table, removed by a committed delete rather than never created
+		if !strings.Contains("rpm", e.info.Kind) || !isDeleted(e.tuple, s.clog) {
+			continue
+		}
+		e.info.Schema = cat.namespaces[e.info.Namespace]
+		if !s.keep(e.info) {
+			continue
+		}
+		t := s.tableDump(db, cat, e.info, e.tuple, s.spaces.RelationPath(db, e.info.Tablespace, e.info.Filenode))
+		t.Dropped = true
+		tables = append(tables, *t)
+	}
+	return tables, nil
+}
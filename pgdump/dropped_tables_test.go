@@ -0,0 +1,66 @@
+package pgdump
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestScanDroppedTables(t *testing.T) {
+	// kept was renamed, not dropped; gone and lost were dropped, and only
+	// gone's file is left, after a rename of gone that rolled back; never
+	// was created by a transaction that aborted
+	dir := testCatalogDataDir(t, [][]byte{
+		testDeadTuple(testClassRow(16500, "old_name", 2200, 16500, 'r'), 400, 450),
+		testClassRow(16500, "kept", 2200, 16500, 'r'),
+		testDeadTuple(testClassRow(16501, "gone", 2200, 16501, 'r'), 500, 600),
+		testDeadTuple(testClassRow(16502, "lost", 2200, 16502, 'r'), 510, 610),
+		// renamed to lost before XID wraparound
+		testDeadTuple(testClassRow(16502, "before_wraparound", 2200, 16502, 'r'), 4294967000, 510),
+		testAbortedTuple(testClassRow(16501, "rolled_back", 2200, 16501, 'r'), 580),
+		testAbortedTuple(testClassRow(16503, "never", 2200, 16503, 'r'), 700),
+	}, [][]byte{
+		testAttrRow(16500, "id", OidInt4, 4, 1, nil),
+		testDeadTuple(testAttrRow(16501, "id", OidInt4, 4, 1, nil), 500, 600),
+		testDeadTuple(testAttrRow(16501, "note", OidInt4, 4, 2, nil), 550, 600),
+		testAbortedTuple(testAttrRow(16501, "rolled_back", OidInt4, 4, 3, nil), 580),
+		testDeadTuple(testAttrRow(16502, "v", OidText, -1, 1, nil), 510, 610),
+	})
+	testWriteFile(t, dir, "base/16384/16500", testHeapPage(testInt4Rows(1)...))
+	testWriteFile(t, dir, "base/16384/16501", testHeapPage(testHeapTuple(2, []byte{7, 0, 0, 0, 70, 0, 0, 0})))
+
+	result, err := ScanDroppedTables(dir, &Options{SkipSystemTables: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Databases) != 1 || result.Databases[0].Name != "app" || len(result.Databases[0].Tables) != 2 {
+		t.Fatalf("result = %+v, want gone and lost in app", result)
+	}
+	gone, lost := result.Databases[0].Tables[0], result.Databases[0].Tables[1]
+	if gone.Name != "gone" || gone.Filenode != 16501 || !gone.Dropped || len(gone.Columns) != 2 {
+		t.Errorf("gone = %+v", gone)
+	}
+	if want := []Row{testRow("id", int32(7), "note", int32(70))}; !reflect.DeepEqual(gone.Rows, want) {
+		t.Errorf("rows = %+v, want %+v", gone.Rows, want)
+	}
+	if lost.Name != "lost" || !lost.Dropped || len(lost.Columns) != 1 || lost.Columns[0].Type != "text" || lost.RowCount != 0 {
+		t.Errorf("lost = %+v", lost)
+	}
+
+	want, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := result.ToJSON(&got); err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+	if got.String() != string(want)+"\n" {
+		t.Errorf("ToJSON =\n%s\nwant\n%s", got.String(), want)
+	}
+
+	if result, _ := ScanDroppedTables(dir, &Options{TableFilter: "lost", SkipSystemTables: true}); len(result.Databases) != 1 || len(result.Databases[0].Tables) != 1 {
+		t.Errorf("filtered result = %+v", result)
+	}
+}
@@ -195,6 +195,18 @@ func TestNewTOASTReader(t *testing.T) {
 	}
 }
 
+func TestTableFilesReleaseTOAST(t *testing.T) {
+	reader := NewTOASTReader()
+	reader.chunks[16389] = []TOASTChunk{{ChunkID: 1, Data: []byte("hello")}}
+
+	if err := (&tableFiles{toast: reader}).Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if reader.loaded(16389) {
+		t.Error("Expected TOAST chunks released when the table is closed")
+	}
+}
+
 // === Search Tests ===
 
 func TestMatchValue(t *testing.T) {
@@ -239,9 +251,9 @@ func TestSearchInDump(t *testing.T) {
 							{Name: "key", TypID: OidText},
 							{Name: "value", TypID: OidText},
 						},
-						Rows: []map[string]interface{}{
-							{"key": "api_key", "value": "sk_live_abc123"},
-							{"key": "name", "value": "test"},
+						Rows: []Row{
+							testRow("key", "api_key", "value", "sk_live_abc123"),
+							testRow("key", "name", "value", "test"),
 						},
 					},
 				},
@@ -271,9 +283,9 @@ func TestTableToCSV(t *testing.T) {
 			{Name: "id", TypID: OidInt4},
 			{Name: "name", TypID: OidText},
 		},
-		Rows: []map[string]interface{}{
-			{"id": int32(1), "name": "alice"},
-			{"id": int32(2), "name": "bob"},
+		Rows: []Row{
+			testRow("id", int32(1), "name", "alice"),
+			testRow("id", int32(2), "name", "bob"),
 		},
 	}
 
@@ -0,0 +1,196 @@
+package pgdump
+
+import (
+	"fmt"
+	"io"
+)
+
+// Visibility map bits of a heap block (visibilitymap.h)
+const (
+	vmAllVisible = 0x01
+	vmAllFrozen  = 0x02
+)
+
+// vmHeapBlocksPerPage is how many heap blocks a visibility map page
+// covers: two bits each, after the page header
+const vmHeapBlocksPerPage = (PageSize - headerSize) * 4
+
+// An FSM page is a binary tree of one-byte free space categories, after
+// the page header and fp_next_slot, whose leaves are the heap blocks or
+// the FSM pages of the level below (fsm_internals.h)
+const (
+	fsmNodesPerPage   = PageSize - headerSize - 4
+	fsmNonLeafNodes   = PageSize/2 - 1
+	fsmSlotsPerPage   = fsmNodesPerPage - fsmNonLeafNodes
+	fsmTreeDepth      = 3              // levels of pages addressing 2^32 blocks
+	fsmCategoryStep   = PageSize / 256 // bytes per category
+	fsmPageDataOffset = headerSize + 4
+)
+
+// VisibilityMap is the visibility map fork (_vm) of a heap relation
+type VisibilityMap struct {
+	data []byte
+}
+
+// ParseVisibilityMap reads the pages of a visibility map fork
+func ParseVisibilityMap(data []byte) *VisibilityMap {
+	return &VisibilityMap{data: data}
+}
+
+// bits returns the map bits of heap block, 0 for blocks past the map
+func (vm *VisibilityMap) bits(block uint32) byte {
+	if vm == nil {
+		return 0
+	}
+	idx := int(block % vmHeapBlocksPerPage)
+	off := int(block/vmHeapBlocksPerPage)*PageSize + headerSize + idx/4
+	if off >= len(vm.data) {
+		return 0
+	}
+	return vm.data[off] >> (2 * (idx % 4)) & 3
+}
+
+// AllVisible reports whether every tuple of heap block is visible to all
+// transactions: all live, with no deleted or aborted rows left
+func (vm *VisibilityMap) AllVisible(block uint32) bool {
+	return vm.bits(block)&vmAllVisible != 0
+}
+
+// AllFrozen reports whether every tuple of heap block is frozen
+func (vm *VisibilityMap) AllFrozen(block uint32) bool {
+	return vm.bits(block)&vmAllFrozen != 0
+}
+
+// FreeSpaceMap is the free space map fork (_fsm) of a heap relation
+type FreeSpaceMap struct {
+	data []byte
+}
+
+// ParseFreeSpaceMap reads the pages of a free space map fork
+func ParseFreeSpaceMap(data []byte) *FreeSpaceMap {
+	return &FreeSpaceMap{data: data}
+}
+
+// FreeSpace returns the free space the map records for heap block, in
+// bytes: rounded down to a multiple of 32, and 0 for blocks past the map
+func (fsm *FreeSpaceMap) FreeSpace(block uint32) int {
+	if off, ok := fsm.leaf(block); ok {
+		return int(fsm.data[off]) * fsmCategoryStep
+	}
+	return 0
+}
+
+// Carve reports whether heap block may hold the bytes of tuples VACUUM
+// removed, for -carve to recover: VACUUM records the space it frees in the
+// map, so blocks it records none for have had theirs filled again. Blocks
+// past the map, or of a relation without one (nil), may.
+func (fsm *FreeSpaceMap) Carve(block uint32) bool {
+	off, ok := fsm.leaf(block)
+	return !ok || fsm.data[off] != 0
+}
+
+// leaf returns the offset in the map of the leaf node of heap block
+func (fsm *FreeSpaceMap) leaf(block uint32) (int, bool) {
+	if fsm == nil {
+		return 0, false
+	}
+	page := fsmLeafBlock(int(block / fsmSlotsPerPage))
+	off := page*PageSize + fsmPageDataOffset + fsmNonLeafNodes + int(block%fsmSlotsPerPage)
+	return off, off < len(fsm.data)
+}
+
+// fsmLeafBlock is the block of bottom-level FSM page n. Pages are stored
+// depth-first, each upper page before the pages below it, as
+// fsm_logical_to_physical lays them out.
+func fsmLeafBlock(n int) int {
+	pages := 0
+	for l := 0; l < fsmTreeDepth; l++ {
+		pages += n + 1
+		n /= fsmSlotsPerPage
+	}
+	return pages - 1
+}
+
+// BlockMapInfo is what the visibility map and free space map of a heap
+// relation record about one of its blocks
+type BlockMapInfo struct {
+	Block uint32 `json:"block"`
+
+	// AllVisible pages hold live tuples only: -deleted has nothing to find
+	// there, and their rows are current without checking pg_xact
+	AllVisible bool `json:"all_visible"`
+	AllFrozen  bool `json:"all_frozen"`
+	FreeSpace  int  `json:"free_space"` // in bytes, rounded down to 32
+
+	// Carve marks the blocks -carve reads, as FreeSpaceMap.Carve decides
+	Carve bool `json:"carve,omitempty"`
+}
+
+// BlockMaps reports on blocks 0 to nblocks-1 of a heap relation, from
+// its visibility map and free space map (nil if the fork is missing)
+func BlockMaps(nblocks int, vm *VisibilityMap, fsm *FreeSpaceMap) []BlockMapInfo {
+	maps := make([]BlockMapInfo, nblocks)
+	for i := range maps {
+		block := uint32(i)
+		maps[i] = BlockMapInfo{
+			Block:      block,
+			AllVisible: vm.AllVisible(block),
+			AllFrozen:  vm.AllFrozen(block),
+			FreeSpace:  fsm.FreeSpace(block),
+			Carve:      fsm.Carve(block),
+		}
+	}
+	return maps
+}
+
+// ReadBlockMaps reports on each block of the heap relation whose main
+// fork is at path, from the path_vm and path_fsm forks next to it. segSize
+// is the size of a full segment, 0 for the one the pg_control of the data
+// directory path is in records (or DefaultSegmentSize).
+func ReadBlockMaps(path string, segSize int) ([]BlockMapInfo, error) {
+	if segSize <= 0 {
+		segSize = dataDirSegmentSize(path)
+	}
+	rel, err := OpenRelation(path, segSize)
+	if err != nil {
+		return nil, err
+	}
+	nblocks := int(rel.Size() / PageSize)
+	rel.Close()
+
+	var vm *VisibilityMap
+	if data, err := ReadRelationFile(path+"_vm", segSize); err == nil {
+		vm = ParseVisibilityMap(data)
+	}
+	fsm := readFreeSpaceMap(path, segSize)
+	if vm == nil && fsm == nil {
+		return nil, fmt.Errorf("%s has neither a visibility map nor a free space map", path)
+	}
+	return BlockMaps(nblocks, vm, fsm), nil
+}
+
+// readFreeSpaceMap reads the path_fsm fork of the relation at path, nil if
+// there is none
+func readFreeSpaceMap(path string, segSize int) *FreeSpaceMap {
+	data, err := ReadRelationFile(path+"_fsm", segSize)
+	if err != nil {
+		return nil
+	}
+	return ParseFreeSpaceMap(data)
+}
+
+// WriteBlockMaps writes maps as psql prints a table
+func WriteBlockMaps(w io.Writer, maps []BlockMapInfo) error {
+	rows := make([][]string, len(maps))
+	for i, m := range maps {
+		rows[i] = []string{utoa(m.Block), psqlBool(m.AllVisible), psqlBool(m.AllFrozen), itoa(m.FreeSpace), psqlBool(m.Carve)}
+	}
+	return writePsqlTable(w, []string{"block", "all_visible", "all_frozen", "free_space", "carve"}, "rllrl", rows)
+}
+
+func psqlBool(b bool) string {
+	if b {
+		return "t"
+	}
+	return "f"
+}
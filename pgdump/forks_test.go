@@ -0,0 +1,69 @@
+package pgdump
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBlockMaps(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "base", "16384")
+
+	// Segments of two blocks, as pg_control records them
+	control := make([]byte, 512)
+	putU32(control, 232, 8)
+	putU32(control, 240, PageSize)
+	putU32(control, 244, 2)
+	putU32(control, 248, PageSize)
+	testWriteFile(t, root, "global/pg_control", control)
+
+	// Block 0 all-visible and all-frozen, block 1 all-visible, block 2
+	// neither; the FSM records 2 KB free in block 2
+	vm := make([]byte, PageSize)
+	vm[headerSize] = vmAllVisible | vmAllFrozen | vmAllVisible<<2
+	putU16(vm, 8, computePageChecksum(vm, 0))
+	fsm := make([]byte, 3*PageSize)
+	fsm[2*PageSize+fsmPageDataOffset+fsmNonLeafNodes+2] = 64
+	putU16(fsm, 2*PageSize+8, 0xBAD)
+	testWriteFile(t, dir, "16385", make([]byte, 2*PageSize))
+	testWriteFile(t, dir, "16385.1", make([]byte, PageSize))
+	testWriteFile(t, dir, "16385_vm", vm)
+	testWriteFile(t, dir, "16385_fsm", fsm)
+
+	maps, err := ReadBlockMaps(filepath.Join(dir, "16385"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BlockMapInfo{
+		{Block: 0, AllVisible: true, AllFrozen: true},
+		{Block: 1, AllVisible: true},
+		{Block: 2, FreeSpace: 2048, Carve: true},
+	}
+	if !reflect.DeepEqual(maps, want) {
+		t.Errorf("ReadBlockMaps = %+v, want %+v", maps, want)
+	}
+	var table bytes.Buffer
+	if err := WriteBlockMaps(&table, maps); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "     2 | f           | f          |       2048 | t\n") {
+		t.Errorf("WriteBlockMaps:\n%s", table.String())
+	}
+
+	// Upper FSM pages come before the leaves they address
+	if got := []int{fsmLeafBlock(0), fsmLeafBlock(1), fsmLeafBlock(fsmSlotsPerPage)}; !reflect.DeepEqual(got, []int{2, 3, fsmSlotsPerPage + 3}) {
+		t.Errorf("fsmLeafBlock = %v", got)
+	}
+
+	// Both forks are checked: the VM page is valid, the FSM leaf is not
+	result, err := VerifyDataDirChecksums(filepath.Dir(filepath.Dir(dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalFiles != 4 || result.InvalidBlocks != 1 || len(result.Files) != 1 || !strings.HasSuffix(result.Files[0].Path, "16385_fsm") {
+		t.Errorf("VerifyDataDirChecksums = %+v", result)
+	}
+}
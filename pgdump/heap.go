@@ -1,20 +1,34 @@
 package pgdump
 
 import (
+	"bytes"
 	"fmt"
+	"time"
 
 	"golang.org/x/text/encoding"
 )
 
 // ReadTuples extracts all visible tuples from heap file data
 func ReadTuples(data []byte, visibleOnly bool) []TupleEntry {
+	var visible func(*HeapTupleData) bool
+	if visibleOnly {
+		visible = (*HeapTupleData).IsVisible
+	}
 	var entries []TupleEntry
 	for off := 0; off+PageSize <= len(data); off += PageSize {
-		for _, e := range ParsePage(data[off : off+PageSize]) {
-			if !visibleOnly || e.Tuple.IsVisible() {
-				e.PageOffset = off
-				entries = append(entries, e)
-			}
+		entries = append(entries, pageTuples(data[off:off+PageSize], off, visible)...)
+	}
+	return entries
+}
+
+// pageTuples extracts the tuples of the page at offset off that visible
+// accepts, or all of them if visible is nil
+func pageTuples(page []byte, off int, visible func(*HeapTupleData) bool) []TupleEntry {
+	var entries []TupleEntry
+	for _, e := range ParsePage(page) {
+		if visible == nil || visible(e.Tuple) {
+			e.PageOffset = off
+			entries = append(entries, e)
 		}
 	}
 	return entries
@@ -27,28 +41,68 @@ func ReadRows(data []byte, columns []Column, visibleOnly bool) []map[string]inte
 
 // ReadRowsWithTOAST decodes tuples using column schema, resolving TOAST pointers.
 func ReadRowsWithTOAST(data []byte, columns []Column, visibleOnly bool, toastReader *TOASTReader) []map[string]interface{} {
-	return readRowsConverted(data, columns, toastReader, nil, nil)
+	return rowMaps(readRowsConverted(data, columns, &rowDecoder{toast: toastReader}, nil, nil))
+}
+
+// rowDecoder carries the per-database state needed to decode column values
+type rowDecoder struct {
+	toast *TOASTReader   // resolves out-of-line values, may be nil
+	types *TypeCatalog   // resolves user-defined types, may be nil
+	loc   *time.Location // time zone timestamptz is shown in, UTC if nil
+	clog  *CommitLog     // resolves tuple visibility, hint bits only if nil
+	asOf  *Snapshot      // past snapshot to reproduce, nil for the latest
+}
+
+// visible reports whether the decoder's scans return tuple
+func (d *rowDecoder) visible(t *HeapTupleData) bool {
+	if d.asOf != nil {
+		return t.IsVisibleAsOf(d.clog, *d.asOf)
+	}
+	return t.IsVisibleWithCommitLog(d.clog)
+}
+
+// deleted reports whether tuple is a row deleted but not vacuumed, one
+// the decoder's scans do not return
+func (d *rowDecoder) deleted(t *HeapTupleData) bool {
+	return !d.visible(t) && isDeleted(t, d.clog)
+}
+
+// catalog returns the decoder's type catalog, nil without one
+func (d *rowDecoder) catalog() *TypeCatalog {
+	if d == nil {
+		return nil
+	}
+	return d.types
+}
+
+// location returns the time zone timestamptz values are shown in
+func (d *rowDecoder) location() *time.Location {
+	if d == nil || d.loc == nil {
+		return time.UTC
+	}
+	return d.loc
 }
 
 // readRowsConverted decodes tuples with optional encoding conversion.
 // decoder converts from DB encoding to UTF-8, encoder converts from UTF-8 to output encoding.
-func readRowsConverted(data []byte, columns []Column, toastReader *TOASTReader, decoder *encoding.Decoder, encoder *encoding.Encoder) []map[string]interface{} {
-	var rows []map[string]interface{}
-	for _, t := range ReadTuples(data, true) {
-		row := DecodeTupleWithTOAST(t.Tuple, columns, toastReader)
-		if row == nil {
-			continue
-		}
-		if decoder != nil || encoder != nil {
-			convertRowStrings(row, decoder, encoder)
-		}
-		rows = append(rows, row)
+func readRowsConverted(data []byte, columns []Column, dec *rowDecoder, decoder *encoding.Decoder, encoder *encoding.Encoder) []Row {
+	return newRowIterator(bytes.NewReader(data), columns, dec, decoder, encoder).all()
+}
+
+// rowMaps converts rows for the map-based API
+func rowMaps(rows []Row) []map[string]interface{} {
+	if rows == nil {
+		return nil
 	}
-	return rows
+	maps := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		maps[i] = row.Map()
+	}
+	return maps
 }
 
-func convertRowStrings(row map[string]interface{}, decoder *encoding.Decoder, encoder *encoding.Encoder) {
-	for k, v := range row {
+func convertRowStrings(row Row, decoder *encoding.Decoder, encoder *encoding.Encoder) {
+	for k, v := range row.Values {
 		s, ok := v.(string)
 		if !ok {
 			continue
@@ -63,7 +117,7 @@ func convertRowStrings(row map[string]interface{}, decoder *encoding.Decoder, en
 				s = c
 			}
 		}
-		row[k] = s
+		row.Values[k] = s
 	}
 }
 
@@ -79,11 +133,20 @@ func DecodeTuple(tuple *HeapTupleData, columns []Column) map[string]interface{}
 
 // DecodeTupleWithTOAST decodes a tuple, resolving TOAST pointers via the reader.
 func DecodeTupleWithTOAST(tuple *HeapTupleData, columns []Column, toastReader *TOASTReader) map[string]interface{} {
+	return (&rowDecoder{toast: toastReader}).decodeTuple(tuple, columns, nil).Map()
+}
+
+// decodeTuple decodes a tuple into a row named by names (nil = the column
+// names). The row has no values if the tuple has no data.
+func (d *rowDecoder) decodeTuple(tuple *HeapTupleData, columns []Column, names []string) Row {
 	if tuple == nil || len(tuple.Data) == 0 {
-		return nil
+		return Row{}
+	}
+	if names == nil {
+		names = columnNames(columns)
 	}
 
-	result := make(map[string]interface{}, len(columns))
+	result := Row{Columns: names, Values: make([]interface{}, len(columns))}
 	offset := 0
 
 	for idx, col := range columns {
@@ -107,6 +170,13 @@ func DecodeTupleWithTOAST(tuple *HeapTupleData, columns []Column, toastReader *T
 			}
 		}
 
+		// Columns added after the tuple was written are absent from it:
+		// fast-default columns report attmissingval, others NULL
+		if tuple.Header != nil && num > tuple.Header.Natts {
+			result.Values[idx] = col.Missing
+			continue
+		}
+
 		prevOffset := offset
 		offset = align(offset, colAlign)
 
@@ -124,11 +194,10 @@ func DecodeTupleWithTOAST(tuple *HeapTupleData, columns []Column, toastReader *T
 				}
 				fmt.Printf("DEBUG: col=%s num=%d offset=%d (align=%d) NULL (%s)\n", col.Name, num, offset, colAlign, bitmapInfo)
 			}
-			result[col.Name] = nil
 			continue
 		}
 
-		val, consumed := readValueWithTOAST(tuple.Data, offset, col.TypID, col.Len, toastReader)
+		val, consumed := d.readValue(tuple.Data, offset, col.TypID, col.Len)
 		if Debug {
 			dataPreview := ""
 			if offset < len(tuple.Data) {
@@ -141,7 +210,7 @@ func DecodeTupleWithTOAST(tuple *HeapTupleData, columns []Column, toastReader *T
 			fmt.Printf("DEBUG: col=%s num=%d offset=%d->%d (align=%d/%c) len=%d consumed=%d val=%v%s\n",
 				col.Name, num, prevOffset, offset, colAlign, col.Align, col.Len, consumed, val, dataPreview)
 		}
-		result[col.Name] = val
+		result.Values[idx] = val
 		offset += consumed
 	}
 
@@ -220,10 +289,10 @@ func typeAlign(typID, length int) int {
 }
 
 func readValue(data []byte, offset, typID, length int) (interface{}, int) {
-	return readValueWithTOAST(data, offset, typID, length, nil)
+	return (&rowDecoder{}).readValue(data, offset, typID, length)
 }
 
-func readValueWithTOAST(data []byte, offset, typID, length int, toastReader *TOASTReader) (interface{}, int) {
+func (d *rowDecoder) readValue(data []byte, offset, typID, length int) (interface{}, int) {
 	if offset >= len(data) {
 		return nil, 0
 	}
@@ -233,21 +302,15 @@ func readValueWithTOAST(data []byte, offset, typID, length int, toastReader *TOA
 		if len(remaining) < length {
 			return nil, 0
 		}
-		return DecodeType(remaining[:length], typID), length
+		return decodeType(remaining[:length], typID, d), length
 	}
 
 	if length == -1 {
-		var val []byte
-		var consumed int
-		if toastReader != nil {
-			val, consumed = ReadVarlenaWithTOAST(remaining, toastReader)
-		} else {
-			val, consumed = ReadVarlena(remaining)
-		}
+		val, consumed := ReadVarlenaWithTOAST(remaining, d.toast)
 		if val == nil {
 			return nil, max(consumed, 1)
 		}
-		return DecodeType(val, typID), consumed
+		return decodeType(val, typID, d), consumed
 	}
 
 	// C-string
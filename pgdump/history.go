@@ -0,0 +1,217 @@
+package pgdump
+
+import (
+	"context"
+	"reflect"
+)
+
+// RowHistory is the versions of a row still on disk, oldest first. An
+// UPDATE writes a new version and leaves the old one in place, pointing to
+// it through t_ctid, until VACUUM removes it.
+type RowHistory struct {
+	Ctid     ItemPointer  `json:"ctid"` // of the newest version
+	Versions []RowVersion `json:"versions"`
+}
+
+// RowVersion is one version of a row
+type RowVersion struct {
+	Ctid   ItemPointer `json:"ctid"`
+	Xmin   uint32      `json:"xmin"`
+	Xmax   uint32      `json:"xmax,omitempty"` // the transaction that updated, deleted or locked it
+	Status TxStatus    `json:"status"`         // of xmin: versions of aborted updates were never seen
+	HOT    bool        `json:"hot,omitempty"`  // heap-only tuple, updated without new index entries
+	Row    Row         `json:"row"`
+
+	// Changes lists the columns that differ from the previous version
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a column an UPDATE changed
+type FieldChange struct {
+	Column string      `json:"column"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// TableHistory is the updated rows of a table
+type TableHistory struct {
+	Database string       `json:"database"`
+	Table    string       `json:"table"`
+	Rows     []RowHistory `json:"rows"`
+}
+
+// ReadRowHistory follows the update chains of a heap relation and returns
+// every row, with all its versions still on disk, in physical order
+func ReadRowHistory(data []byte, columns []Column) []RowHistory {
+	chains := newUpdateChains()
+	for off := 0; off+PageSize <= len(data); off += PageSize {
+		chains.add(data[off:off+PageSize], uint32(off/PageSize))
+	}
+	dec, names := &rowDecoder{}, columnNames(columns)
+	return chains.history(func(t *HeapTupleData) Row {
+		return dec.decodeTuple(t, columns, names)
+	}, nil)
+}
+
+// ScanRowHistory returns the rows of the tables opts selects that have
+// more than one version on disk. Update chains span the whole table, so
+// each table is read into memory at once and opts.Workers is ignored.
+func ScanRowHistory(dataDir string, opts *Options) ([]TableHistory, error) {
+	return ScanRowHistoryContext(context.Background(), dataDir, opts)
+}
+
+// ScanRowHistoryContext is ScanRowHistory stopping early with ctx's error
+// once ctx is done
+func ScanRowHistoryContext(ctx context.Context, dataDir string, opts *Options) ([]TableHistory, error) {
+	o := *withDefaults(opts)
+	o.Workers, o.ListOnly = 0, false
+	w := &historyWriter{}
+	if err := StreamDataDirContext(ctx, dataDir, &o, w); err != nil {
+		return nil, err
+	}
+	return w.tables, nil
+}
+
+// historyWriter collects the updated rows of a streamed dump
+type historyWriter struct {
+	tables []TableHistory
+}
+
+func (h *historyWriter) BeginDatabase(*DatabaseDump) error { return nil }
+
+func (h *historyWriter) WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	if !rows.streaming() {
+		return nil
+	}
+	hist, err := rows.history()
+	if err != nil {
+		return err
+	}
+	var updated []RowHistory
+	for _, row := range hist {
+		if len(row.Versions) > 1 {
+			updated = append(updated, row)
+		}
+	}
+	if len(updated) > 0 {
+		h.tables = append(h.tables, TableHistory{Database: db.Name, Table: t.QualifiedName(), Rows: updated})
+	}
+	return nil
+}
+
+func (h *historyWriter) EndDatabase(*DatabaseDump) error { return nil }
+
+func (h *historyWriter) Close() error { return nil }
+
+// history reads the iterator's pages again and follows their update
+// chains, whatever the visibility of the versions
+func (it *RowIterator) history() ([]RowHistory, error) {
+	it.Reset()
+	chains := newUpdateChains()
+	for page := it.readPage(); page != nil; page = it.readPage() {
+		chains.add(page, uint32((it.off-PageSize)/PageSize))
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	return chains.history(it.decode, it.dec.clog), nil
+}
+
+// updateChains indexes the tuples of a relation by their location
+type updateChains struct {
+	tuples    map[ItemPointer]*HeapTupleData
+	order     []ItemPointer // physical order
+	redirects map[ItemPointer]uint16
+}
+
+func newUpdateChains() *updateChains {
+	return &updateChains{tuples: make(map[ItemPointer]*HeapTupleData), redirects: make(map[ItemPointer]uint16)}
+}
+
+// add indexes the tuples and redirects of page number block
+func (c *updateChains) add(page []byte, block uint32) {
+	for _, e := range ParsePage(page) {
+		ptr := ItemPointer{Block: block, Offset: e.Item}
+		c.tuples[ptr] = e.Tuple
+		c.order = append(c.order, ptr)
+	}
+	for from, to := range PageRedirects(page) {
+		c.redirects[ItemPointer{Block: block, Offset: from}] = to
+	}
+}
+
+// next returns the newer version of the tuple at ptr, if it is still on disk
+func (c *updateChains) next(ptr ItemPointer) (ItemPointer, bool) {
+	t := c.tuples[ptr]
+	ctid := t.Header.Ctid
+	if ctid == ptr || t.Header.Xmax == 0 || t.xmaxLockOnly() {
+		return ptr, false
+	}
+	if to, ok := c.redirects[ctid]; ok {
+		ctid.Offset = to
+	}
+	n, ok := c.tuples[ctid]
+	if !ok {
+		return ptr, false
+	}
+	// The line pointer may have been reused since, so the newer version
+	// must have been inserted by the updater, as heap_get_latest_tid checks.
+	// A multixact xmax hides the updater; the update bit has to do.
+	if t.Header.Infomask&heapXmaxIsMulti != 0 {
+		return ctid, n.Header.Infomask&heapUpdated != 0
+	}
+	return ctid, n.Header.Xmin == t.Header.Xmax
+}
+
+// history walks each chain from its oldest version left, decoding the
+// versions with decode
+func (c *updateChains) history(decode func(*HeapTupleData) Row, clog *CommitLog) []RowHistory {
+	newer := make(map[ItemPointer]ItemPointer)
+	hasOlder := make(map[ItemPointer]bool)
+	for _, ptr := range c.order {
+		if n, ok := c.next(ptr); ok && !hasOlder[n] {
+			newer[ptr], hasOlder[n] = n, true
+		}
+	}
+
+	var rows []RowHistory
+	for _, start := range c.order {
+		if hasOlder[start] {
+			continue
+		}
+		var hist RowHistory
+		for ptr, ok := start, true; ok; ptr, ok = newer[ptr] {
+			t := c.tuples[ptr]
+			v := RowVersion{
+				Ctid:   ptr,
+				Xmin:   t.Header.Xmin,
+				Xmax:   t.Header.Xmax,
+				Status: t.XminStatus(clog),
+				HOT:    t.Header.HeapOnly,
+				Row:    decode(t),
+			}
+			if n := len(hist.Versions); n > 0 {
+				v.Changes = rowChanges(hist.Versions[n-1].Row, v.Row)
+			}
+			hist.Versions = append(hist.Versions, v)
+			hist.Ctid = ptr
+		}
+		rows = append(rows, hist)
+	}
+	return rows
+}
+
+// rowChanges lists the columns whose values differ between two versions
+func rowChanges(old, cur Row) []FieldChange {
+	var changes []FieldChange
+	for i, val := range cur.Values {
+		var prev interface{}
+		if i < len(old.Values) {
+			prev = old.Values[i]
+		}
+		if !reflect.DeepEqual(prev, val) {
+			changes = append(changes, FieldChange{Column: cur.Columns[i], Old: prev, New: val})
+		}
+	}
+	return changes
+}
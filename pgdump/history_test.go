@@ -0,0 +1,82 @@
+package pgdump
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testHistoryColumns = []Column{
+	{Name: "id", TypID: OidInt4, Len: 4, Num: 1, Align: 'i'},
+	{Name: "v", TypID: OidInt4, Len: 4, Num: 2, Align: 'i'},
+}
+
+// testVersion builds a row version (id, v) pointing to ctid
+func testVersion(xmin, xmax uint32, ctid ItemPointer, infomask2 uint16, id, v int32) []byte {
+	data := make([]byte, 8)
+	putU32(data, 0, uint32(id))
+	putU32(data, 4, uint32(v))
+	var infomask uint16
+	if xmax == 0 {
+		infomask = 0x0800
+	}
+	tup := testTupleXids(xmin, xmax, infomask, data)
+	putU16(tup, 12, uint16(ctid.Block>>16))
+	putU16(tup, 14, uint16(ctid.Block))
+	putU16(tup, 16, ctid.Offset)
+	putU16(tup, 18, 2|infomask2)
+	return tup
+}
+
+func TestReadRowHistory(t *testing.T) {
+	at := func(block uint32, off uint16) ItemPointer { return ItemPointer{Block: block, Offset: off} }
+	page0 := testHeapPage(
+		testVersion(100, 0, at(0, 1), 0, 0, 0), // pruned root, replaced below
+		testVersion(101, 102, at(0, 3), heapHotUpdated|heapOnlyTuple, 1, 10),
+		testVersion(102, 0, at(0, 3), heapOnlyTuple, 1, 20),
+		testVersion(100, 0, at(0, 4), 0, 2, 5),
+		testVersion(100, 103, at(0, 6), 0, 3, 7), // slot reused since
+		testVersion(999, 0, at(0, 6), 0, 4, 8),
+	)
+	putU32(page0, headerSize, 2|lpRedirect<<15)
+	page1 := testHeapPage(testVersion(90, 101, at(0, 1), 0, 1, 5))
+
+	if got := PageRedirects(page0); !reflect.DeepEqual(got, map[uint16]uint16{1: 2}) {
+		t.Errorf("PageRedirects = %v", got)
+	}
+
+	hist := ReadRowHistory(append(page0, page1...), testHistoryColumns)
+	if len(hist) != 4 {
+		t.Fatalf("got %d rows, want 4", len(hist))
+	}
+	row := hist[3]
+	var ctids []ItemPointer
+	for _, v := range row.Versions {
+		ctids = append(ctids, v.Ctid)
+	}
+	if want := []ItemPointer{at(1, 1), at(0, 2), at(0, 3)}; !reflect.DeepEqual(ctids, want) {
+		t.Fatalf("versions = %v, want %v", ctids, want)
+	}
+	if row.Ctid != at(0, 3) {
+		t.Errorf("Ctid = %v", row.Ctid)
+	}
+	if !row.Versions[2].HOT || row.Versions[0].HOT {
+		t.Error("HOT flags not read from infomask2")
+	}
+	want := [][]FieldChange{nil, {{"v", int32(5), int32(10)}}, {{"v", int32(10), int32(20)}}}
+	for i, v := range row.Versions {
+		if !reflect.DeepEqual(v.Changes, want[i]) {
+			t.Errorf("version %d: changes = %v, want %v", i, v.Changes, want[i])
+		}
+	}
+	for i, id := range []int32{2, 3, 4} {
+		if len(hist[i].Versions) != 1 || hist[i].Versions[0].Row.Values[0] != id {
+			t.Errorf("row %d = %+v, want id %d alone", i, hist[i], id)
+		}
+	}
+
+	data, _ := json.Marshal(row.Versions[1])
+	if want := `{"ctid":"(0,2)","xmin":101,"xmax":102,"status":"unknown","hot":true,"row":{"id":1,"v":10},"changes":[{"column":"v","old":5,"new":10}]}`; string(data) != want {
+		t.Errorf("JSON = %s", data)
+	}
+}
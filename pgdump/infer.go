@@ -0,0 +1,369 @@
+package pgdump
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// InferredColumn is a column of a layout guessed from tuple bytes
+type InferredColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Confidence is the share of the sampled tuples holding a value for
+	// the column whose bytes fit the type, from 0 to 1: 0 for a column
+	// that is NULL in all of them
+	Confidence float64 `json:"confidence"`
+}
+
+// InferredSchema is a column layout for a heap file without catalog, as
+// InferSchema guesses it or ScoreSchema checks a given one
+type InferredSchema struct {
+	Columns []InferredColumn `json:"columns"`
+	Tuples  int              `json:"tuples"` // sampled
+
+	// Fit is the share of the sampled tuples whose data the layout covers
+	// exactly, with every value fitting its type
+	Fit float64 `json:"fit"`
+
+	columns []Column
+}
+
+// DecodeColumns returns the layout as columns to decode the file with
+func (s *InferredSchema) DecodeColumns() []Column {
+	return s.columns
+}
+
+const (
+	maxInferTuples = 500  // sampled by InferSchema
+	maxInferNodes  = 5000 // partial layouts tried before settling
+
+	// minInferFit is the share of the tuples a type must fit for a column
+	// before the search tries it, after the best one
+	minInferFit = 0.9
+	// goodInferFit is the share of tuples a layout must cover to stop
+	goodInferFit = 0.95
+)
+
+// inferCandidates are the types InferSchema tells apart, most specific
+// first: the first of the types fitting as many tuples is tried first
+var inferCandidates = []Column{
+	{TypID: OidText, Len: -1},
+	{TypID: OidUUID, Len: 16},
+	{TypID: OidTimestamp, Len: 8},
+	{TypID: OidBool, Len: 1},
+	{TypID: OidInt4, Len: 4},
+	{TypID: OidInt8, Len: 8},
+	{TypID: OidFloat8, Len: 8},
+	{TypID: OidInt2, Len: 2},
+	{TypID: OidBytea, Len: -1},
+}
+
+// InferSchema guesses the columns of the table a heap file belongs to from
+// its tuples, live or dead. The null bitmaps tell which attributes a tuple
+// holds, and the layout must account for every byte of each tuple's data:
+// alignment padding is zeroes, varlena headers give the lengths of the
+// values, and fixed-size values must be plausible for their type (a bool is
+// 0 or 1, a timestamp falls between 1970 and 2100, a UUID has a version and
+// variant, text is clean UTF-8). Types are tried column by column, going
+// back to the previous column when the data stops making sense.
+//
+// Columns are named col1, col2, ... after their attribute numbers. Types
+// sharing a storage layout cannot be told apart: varchar reads as text,
+// timestamptz as timestamp, date and oid as int4.
+func InferSchema(data []byte) *InferredSchema {
+	s := newLayoutSearch(data)
+	s.search(0, nil, nil, s.start())
+	// columns the search never reached, past the node limit, are text
+	columns, scores := s.best, s.bestScores
+	for i := len(columns); i < s.natts; i++ {
+		columns = append(columns, Column{Name: fmt.Sprintf("col%d", i+1), TypID: OidText, Len: -1, Num: i + 1})
+		scores = append(scores, 0)
+	}
+	return s.schema(columns, scores, s.bestFit)
+}
+
+// ScoreSchema checks how well columns, such as ParseColumnTypes returns,
+// fit the tuples of a heap file
+func ScoreSchema(data []byte, columns []Column) *InferredSchema {
+	s := newLayoutSearch(data)
+	offsets := s.start()
+	scores := make([]float64, len(columns))
+	for i, col := range columns {
+		num := col.Num
+		if num == 0 {
+			num = i + 1
+		}
+		scores[i], offsets = s.place(num, col, offsets)
+	}
+	return s.schema(columns, scores, s.complete(offsets))
+}
+
+// ParseColumnTypes reads a comma-separated list of type names, such as
+// "int4,text,timestamptz", as the columns col1, col2, ... of a table.
+// SQL spellings (integer, character varying(20), ...) are accepted; type
+// modifiers are ignored.
+func ParseColumnTypes(spec string) ([]Column, error) {
+	var columns []Column
+	for i, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if p := strings.IndexByte(name, '('); p >= 0 {
+			name = strings.TrimSpace(name[:p])
+		}
+		oid, ok := typeByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column type %q", name)
+		}
+		columns = append(columns, Column{Name: fmt.Sprintf("col%d", i+1), TypID: oid, Len: typeLength(oid), Num: i + 1})
+	}
+	return columns, nil
+}
+
+// typeAliases are the SQL names of types typeNames knows by another
+var typeAliases = map[string]int{
+	"boolean": OidBool, "smallint": OidInt2, "integer": OidInt4, "int": OidInt4,
+	"bigint": OidInt8, "real": OidFloat4, "double precision": OidFloat8,
+	"decimal": OidNumeric, "character varying": OidVarchar, "character": OidBpchar,
+	"timestamp without time zone": OidTimestamp, "timestamp with time zone": OidTimestampTZ,
+	"time without time zone": OidTime, "time with time zone": OidTimeTZ,
+}
+
+func typeByName(name string) (int, bool) {
+	if oid, ok := typeAliases[name]; ok {
+		return oid, true
+	}
+	for oid, n := range typeNames {
+		if n == name {
+			return oid, true
+		}
+	}
+	return 0, false
+}
+
+// typeLength is the attlen of a built-in type: -1 for varlena types
+func typeLength(oid int) int {
+	if oid == OidName {
+		return 64 // NAMEDATALEN
+	}
+	if n, ok := fixedLengths[oid]; ok {
+		return n
+	}
+	return -1
+}
+
+// layoutSearch tries column layouts against sampled tuples. A partial
+// layout is the offsets each tuple's data is read up to, -1 for the
+// tuples it does not fit.
+type layoutSearch struct {
+	tuples []*HeapTupleData
+	natts  int
+	nodes  int
+
+	best       []Column
+	bestScores []float64
+	bestFit    float64
+}
+
+func newLayoutSearch(data []byte) *layoutSearch {
+	s := &layoutSearch{}
+	for _, e := range ReadTuples(data, false) {
+		t := e.Tuple
+		if t == nil || t.Header.Natts == 0 {
+			continue
+		}
+		s.tuples = append(s.tuples, t)
+		if t.Header.Natts > s.natts {
+			s.natts = t.Header.Natts
+		}
+		if len(s.tuples) == maxInferTuples {
+			break
+		}
+	}
+	return s
+}
+
+// start is the empty layout, every tuple read up to the start of its data
+func (s *layoutSearch) start() []int {
+	return make([]int, len(s.tuples))
+}
+
+// search extends a layout of col columns with the next one, reporting
+// whether it found one fitting enough tuples to stop
+func (s *layoutSearch) search(col int, columns []Column, scores []float64, offsets []int) bool {
+	if col == s.natts {
+		if fit := s.complete(offsets); s.best == nil || fit > s.bestFit {
+			s.best, s.bestScores, s.bestFit = columns, scores, fit
+		}
+		return s.bestFit >= goodInferFit
+	}
+	// no extension covers more tuples than this one still fits
+	if s.best != nil && s.alive(offsets) <= s.bestFit {
+		return false
+	}
+	s.nodes++
+
+	type candidate struct {
+		col     Column
+		score   float64
+		offsets []int
+	}
+	var cands []candidate
+	for _, c := range inferCandidates {
+		score, next := s.place(col+1, c, offsets)
+		cands = append(cands, candidate{c, score, next})
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].score > cands[j].score })
+
+	for i, c := range cands {
+		if i > 0 && (c.score < minInferFit || s.nodes > maxInferNodes) {
+			break
+		}
+		c.col.Name, c.col.Num = fmt.Sprintf("col%d", col+1), col+1
+		if s.search(col+1, append(columns[:col:col], c.col), append(scores[:col:col], c.score), c.offsets) {
+			return true
+		}
+		if s.applicable(col+1, offsets) == 0 {
+			break // NULL everywhere: any type does
+		}
+	}
+	return false
+}
+
+// place reads attribute num as col in each tuple the layout fits so far,
+// returning the share of those holding a value that it fits and the new
+// offsets
+func (s *layoutSearch) place(num int, col Column, offsets []int) (float64, []int) {
+	next := make([]int, len(offsets))
+	fit, applicable := 0, 0
+	for i, t := range s.tuples {
+		off := offsets[i]
+		next[i] = off
+		if off < 0 || num > t.Header.Natts || t.IsNull(num) {
+			continue
+		}
+		applicable++
+		if next[i] = placeValue(t.Data, off, col); next[i] >= 0 {
+			fit++
+		}
+	}
+	if applicable == 0 {
+		return 0, next
+	}
+	return float64(fit) / float64(applicable), next
+}
+
+// applicable counts the tuples the layout fits that hold attribute num
+func (s *layoutSearch) applicable(num int, offsets []int) int {
+	n := 0
+	for i, t := range s.tuples {
+		if offsets[i] >= 0 && num <= t.Header.Natts && !t.IsNull(num) {
+			n++
+		}
+	}
+	return n
+}
+
+// alive is the share of the tuples the layout fits so far
+func (s *layoutSearch) alive(offsets []int) float64 {
+	n := 0
+	for _, off := range offsets {
+		if off >= 0 {
+			n++
+		}
+	}
+	return s.share(n)
+}
+
+// complete is the share of the tuples a whole layout reads to the end
+func (s *layoutSearch) complete(offsets []int) float64 {
+	n := 0
+	for i, off := range offsets {
+		if off == len(s.tuples[i].Data) {
+			n++
+		}
+	}
+	return s.share(n)
+}
+
+func (s *layoutSearch) share(n int) float64 {
+	if len(s.tuples) == 0 {
+		return 0
+	}
+	return float64(n) / float64(len(s.tuples))
+}
+
+// schema describes a layout
+func (s *layoutSearch) schema(columns []Column, scores []float64, fit float64) *InferredSchema {
+	schema := &InferredSchema{Tuples: len(s.tuples), Fit: fit, columns: columns}
+	for i, col := range columns {
+		schema.Columns = append(schema.Columns, InferredColumn{Name: col.Name, Type: TypeName(col.TypID), Confidence: scores[i]})
+	}
+	return schema
+}
+
+// placeValue reads a value of col at offset off of a tuple's data, as
+// decodeTuple does, returning the offset after it or -1 if the padding
+// before it is not zeroes, it runs past the data or it does not fit col's
+// type
+func placeValue(data []byte, off int, col Column) int {
+	colAlign := alignFromChar(col.Align)
+	if colAlign == 0 {
+		colAlign = typeAlign(col.TypID, col.Len)
+	}
+	if col.Len == -1 && off < len(data) && (isShortVarlena(data[off:]) || data[off] == 0x01) {
+		colAlign = 1
+	}
+	start := align(off, colAlign)
+	if start >= len(data) || !zeroes(data[off:start]) {
+		return -1
+	}
+
+	n := col.Len
+	if n == -1 {
+		n = varlenaSize(data[start:])
+	}
+	if n <= 0 || start+n > len(data) || !valueFits(col.TypID, data[start:start+n]) {
+		return -1
+	}
+	return start + n
+}
+
+const (
+	unixEpochMicros = -946684800 * 1000000 // 1970-01-01 since 2000-01-01
+	year2100Micros  = 3155760000 * 1000000 // 2100-01-01
+)
+
+// valueFits reports whether v is a plausible value of type typID, its
+// varlena header included. Types without a check fit any bytes.
+func valueFits(typID int, v []byte) bool {
+	switch typID {
+	case OidBool:
+		return v[0] <= 1
+	case OidInt8:
+		// a 2^53 bound keeps two small int4 from reading as one int8
+		n := int64(binary.LittleEndian.Uint64(v))
+		return n > -1<<53 && n < 1<<53
+	case OidFloat8:
+		f := math.Abs(math.Float64frombits(binary.LittleEndian.Uint64(v)))
+		return f == 0 || (f >= 1e-12 && f <= 1e15)
+	case OidTimestamp, OidTimestampTZ:
+		// not within 12 days of 2000-01-01, where small integers would be
+		n := int64(binary.LittleEndian.Uint64(v))
+		return n >= unixEpochMicros && n < year2100Micros && (n > 1e12 || n < -1e12)
+	case OidUUID:
+		version := v[6] >> 4
+		return version >= 1 && version <= 8 && v[8]&0xC0 == 0x80
+	case OidText, OidVarchar, OidBpchar:
+		switch {
+		case v[0] == 0x01 || (v[0]&1 == 0 && v[0]&2 != 0):
+			return true // TOAST pointer, or compressed inline
+		case v[0]&1 == 1:
+			return cleanString(string(v[1:]))
+		}
+		return cleanString(string(v[4:]))
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package pgdump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	// id int4, name text, created timestamp, active bool
+	tuple := func(id int, name string, created uint64, active byte) []byte {
+		data := make([]byte, 4, 32)
+		putU32(data, 0, uint32(id))
+		data = append(data, byte(len(name)+1)<<1|1)
+		data = append(append(data, name...), make([]byte, align(len(data)+len(name), 8)-len(data)-len(name))...)
+		ts := make([]byte, 8)
+		putU32(ts, 0, uint32(created))
+		putU32(ts, 4, uint32(created>>32))
+		return testHeapTuple(4, append(append(data, ts...), active))
+	}
+	page := testHeapPage(
+		tuple(1, "alice", 767750400000000, 1),
+		tuple(2, "bob", 767836800000000, 0),
+		tuple(3, "carol", 767923200000000, 1),
+	)
+
+	schema := InferSchema(page)
+	want := []InferredColumn{
+		{Name: "col1", Type: "int4", Confidence: 1},
+		{Name: "col2", Type: "text", Confidence: 1},
+		{Name: "col3", Type: "timestamp", Confidence: 1},
+		{Name: "col4", Type: "bool", Confidence: 1},
+	}
+	if !reflect.DeepEqual(schema.Columns, want) || schema.Tuples != 3 || schema.Fit != 1 {
+		t.Errorf("InferSchema = %+v, want columns %+v fitting 3 tuples", schema, want)
+	}
+	rows := readRowsConverted(page, schema.DecodeColumns(), &rowDecoder{}, nil, nil)
+	if len(rows) != 3 || rows[1].Values[0] != int32(2) || rows[1].Values[1] != "bob" || rows[1].Values[3] != false {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	// A user's layout: right, and one column short with the wrong type
+	columns, err := ParseColumnTypes("integer, varchar(20), timestamptz, boolean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ScoreSchema(page, columns); got.Fit != 1 || got.Columns[2].Type != "timestamptz" {
+		t.Errorf("ScoreSchema = %+v, want a full fit", got)
+	}
+	columns, _ = ParseColumnTypes("int4,int8")
+	if got := ScoreSchema(page, columns); got.Fit != 0 || got.Columns[0].Confidence != 1 || got.Columns[1].Confidence != 0 {
+		t.Errorf("ScoreSchema of a wrong layout = %+v", got)
+	}
+	if _, err := ParseColumnTypes("int4,blob"); err == nil {
+		t.Error("ParseColumnTypes accepted an unknown type")
+	}
+}
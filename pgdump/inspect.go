@@ -0,0 +1,264 @@
+package pgdump
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PageHeaderInfo is a page header as pageinspect's page_header shows it
+type PageHeaderInfo struct {
+	LSN      string `json:"lsn"`
+	Checksum int16  `json:"checksum"` // smallint, so it can be negative
+	Flags    int    `json:"flags"`
+	Lower    int    `json:"lower"`
+	Upper    int    `json:"upper"`
+	Special  int    `json:"special"`
+	PageSize int    `json:"pagesize"`
+	Version  int    `json:"version"`
+	PruneXid uint32 `json:"prune_xid"`
+}
+
+// HeapPageItem is a line pointer and the header of its tuple, as
+// pageinspect's heap_page_items shows them. The t_ fields are nil (NULL)
+// where heap_page_items has none: for line pointers without storage, and
+// t_bits and t_oid for tuples without nulls or OIDs.
+type HeapPageItem struct {
+	Lp      int `json:"lp"`
+	LpOff   int `json:"lp_off"`
+	LpFlags int `json:"lp_flags"` // 0 unused, 1 normal, 2 redirect, 3 dead
+	LpLen   int `json:"lp_len"`
+
+	TXmin      *uint32      `json:"t_xmin"`
+	TXmax      *uint32      `json:"t_xmax"`
+	TField3    *int32       `json:"t_field3"` // cmin/cmax, or xvac
+	TCtid      *ItemPointer `json:"t_ctid"`
+	TInfomask2 *int         `json:"t_infomask2"`
+	TInfomask  *int         `json:"t_infomask"`
+	THoff      *int         `json:"t_hoff"`
+	TBits      *string      `json:"t_bits"`
+	TOid       *uint32      `json:"t_oid"`
+	TData      *string      `json:"t_data"` // bytea in hex format
+
+	// Flags names the infomask bits, as heap_tuple_infomask_flags does
+	Flags []string `json:"flags,omitempty"`
+}
+
+// PageInspection is a heap page broken down as pageinspect does
+type PageInspection struct {
+	Block  uint32         `json:"block"`
+	Header PageHeaderInfo `json:"header"`
+	Items  []HeapPageItem `json:"items"`
+}
+
+// minHeapTupleSize is the smallest lp_len heap_page_items decodes a tuple
+// header from: the header, MAXALIGNed
+const minHeapTupleSize = 24
+
+// InspectHeapPage breaks down page number block as page_header and
+// heap_page_items would on a live server
+func InspectHeapPage(page []byte, block uint32) (*PageInspection, error) {
+	if len(page) < PageSize {
+		return nil, fmt.Errorf("page too short: %d bytes", len(page))
+	}
+	psv := u16(page, 18)
+	insp := &PageInspection{
+		Block: block,
+		Header: PageHeaderInfo{
+			LSN:      FormatLSN(u64(page, 0)),
+			Checksum: int16(u16(page, 8)),
+			Flags:    int(u16(page, 10)),
+			Lower:    int(u16(page, 12)),
+			Upper:    int(u16(page, 14)),
+			Special:  int(u16(page, 16)),
+			PageSize: int(psv & 0xFF00),
+			Version:  int(psv & 0x00FF),
+			PruneXid: u32(page, 20),
+		},
+	}
+
+	h := parseHeader(page)
+	if int(h.Lower) > PageSize {
+		return insp, nil
+	}
+	for i, lp := range parseItems(page, h) {
+		item := HeapPageItem{Lp: i + 1, LpOff: lp.Offset, LpFlags: lp.Flags, LpLen: lp.Length}
+		if lp.Length >= minHeapTupleSize && lp.Offset%8 == 0 && lp.Offset+lp.Length <= PageSize {
+			item.setTuple(page[lp.Offset : lp.Offset+lp.Length])
+		}
+		insp.Items = append(insp.Items, item)
+	}
+	return insp, nil
+}
+
+// setTuple fills the t_ fields from a tuple, as heap_page_items does
+func (item *HeapPageItem) setTuple(tup []byte) {
+	xmin, xmax, field3 := u32(tup, 0), u32(tup, 4), int32(u32(tup, 8))
+	ctid := ItemPointer{Block: uint32(u16(tup, 12))<<16 | uint32(u16(tup, 14)), Offset: u16(tup, 16)}
+	infomask2, infomask := int(u16(tup, 18)), int(u16(tup, 20))
+	hoff := int(tup[22])
+	item.TXmin, item.TXmax, item.TField3, item.TCtid = &xmin, &xmax, &field3, &ctid
+	item.TInfomask2, item.TInfomask, item.THoff = &infomask2, &infomask, &hoff
+	item.Flags = infomaskFlagNames(uint16(infomask), uint16(infomask2))
+
+	// t_hoff must be sane to find the null bitmap, the OID and the data
+	if hoff < tupleHeaderSize || hoff > len(tup) || hoff%8 != 0 {
+		return
+	}
+	if infomask&0x0001 != 0 {
+		natts := infomask2 & 0x07FF
+		bitsLen := (natts + 7) / 8
+		if tupleHeaderSize+bitsLen <= hoff {
+			var sb strings.Builder
+			for i := 0; i < bitsLen*8; i++ {
+				if tup[tupleHeaderSize+i/8]&(1<<(i%8)) != 0 {
+					sb.WriteByte('1')
+				} else {
+					sb.WriteByte('0')
+				}
+			}
+			bits := sb.String()
+			item.TBits = &bits
+		}
+	}
+	if infomask&0x0008 != 0 && hoff >= tupleHeaderSize+4 {
+		oid := u32(tup, hoff-4)
+		item.TOid = &oid
+	}
+	data := `\x` + hex.EncodeToString(tup[hoff:])
+	item.TData = &data
+}
+
+// InspectBlockRange inspects the heap pages of a file in a block range
+// (nil for all of them)
+func InspectBlockRange(path string, blockRange *BlockRange) ([]PageInspection, error) {
+	data, err := ReadBlockRange(path, blockRange)
+	if err != nil {
+		return nil, err
+	}
+	startBlock := 0
+	if blockRange != nil && blockRange.Start >= 0 {
+		startBlock = blockRange.Start
+	}
+
+	var pages []PageInspection
+	for off := 0; off+PageSize <= len(data); off += PageSize {
+		insp, err := InspectHeapPage(data[off:off+PageSize], uint32(startBlock+off/PageSize))
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, *insp)
+	}
+	return pages, nil
+}
+
+// WriteInspection writes pages as psql prints page_header and
+// heap_page_items results, one pair of tables per block
+func WriteInspection(w io.Writer, pages []PageInspection) error {
+	for _, p := range pages {
+		h := p.Header
+		fmt.Fprintf(w, "Block %d\n", p.Block)
+		err := writePsqlTable(w,
+			[]string{"lsn", "checksum", "flags", "lower", "upper", "special", "pagesize", "version", "prune_xid"},
+			"lrrrrrrrr",
+			[][]string{{h.LSN, itoa(int(h.Checksum)), itoa(h.Flags), itoa(h.Lower), itoa(h.Upper), itoa(h.Special), itoa(h.PageSize), itoa(h.Version), utoa(h.PruneXid)}})
+
+		rows := make([][]string, len(p.Items))
+		for i, item := range p.Items {
+			rows[i] = []string{
+				itoa(item.Lp), itoa(item.LpOff), itoa(item.LpFlags), itoa(item.LpLen),
+				optional(item.TXmin), optional(item.TXmax), optional(item.TField3), optional(item.TCtid),
+				optional(item.TInfomask2), optional(item.TInfomask), optional(item.THoff),
+				optional(item.TBits), optional(item.TOid), optional(item.TData),
+			}
+		}
+		if err == nil {
+			err = writePsqlTable(w,
+				[]string{"lp", "lp_off", "lp_flags", "lp_len", "t_xmin", "t_xmax", "t_field3", "t_ctid", "t_infomask2", "t_infomask", "t_hoff", "t_bits", "t_oid", "t_data"},
+				"rrrrrrrlrrrlrl",
+				rows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePsqlTable writes rows aligned as psql does: headers centered, each
+// column left- or right-aligned as align says ('l' or 'r'), no padding at
+// the end of a line, and a row count. Right-aligned are the numeric types,
+// xid and oid included.
+func writePsqlTable(w io.Writer, header []string, align string, rows [][]string) error {
+	widths := make([]int, len(header))
+	for i, name := range header {
+		widths[i] = len(name)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	cells := make([]string, len(header))
+	for i, name := range header {
+		left := (widths[i] - len(name)) / 2
+		cells[i] = strings.Repeat(" ", left) + name + strings.Repeat(" ", widths[i]-len(name)-left)
+	}
+	fmt.Fprintf(w, " %s\n", strings.TrimRight(strings.Join(cells, " | "), " "))
+	for i := range header {
+		cells[i] = strings.Repeat("-", widths[i])
+	}
+	fmt.Fprintf(w, "-%s-\n", strings.Join(cells, "-+-"))
+	for _, row := range rows {
+		for i, cell := range row {
+			if align[i] == 'r' {
+				cells[i] = fmt.Sprintf("%*s", widths[i], cell)
+			} else {
+				cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+			}
+		}
+		fmt.Fprintf(w, " %s\n", strings.TrimRight(strings.Join(cells, " | "), " "))
+	}
+	if len(rows) == 1 {
+		_, err := fmt.Fprintf(w, "(1 row)\n\n")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "(%d rows)\n\n", len(rows))
+	return err
+}
+
+func itoa(n int) string { return strconv.Itoa(n) }
+
+func utoa(n uint32) string { return strconv.FormatUint(uint64(n), 10) }
+
+// optional formats a nullable field, NULL as psql's empty string
+func optional(v interface{}) string {
+	switch p := v.(type) {
+	case *uint32:
+		if p != nil {
+			return utoa(*p)
+		}
+	case *int32:
+		if p != nil {
+			return strconv.Itoa(int(*p))
+		}
+	case *int:
+		if p != nil {
+			return itoa(*p)
+		}
+	case *string:
+		if p != nil {
+			return *p
+		}
+	case *ItemPointer:
+		if p != nil {
+			return p.String()
+		}
+	}
+	return ""
+}
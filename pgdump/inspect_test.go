@@ -0,0 +1,65 @@
+package pgdump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInspectHeapPage(t *testing.T) {
+	// A tuple whose v is NULL: t_bits after the header, data at t_hoff 32
+	base := testVersion(100, 0, ItemPointer{Offset: 2}, 0, 2, 0)
+	withNull := append(append(base[:24:24], make([]byte, 8)...), base[24:28]...)
+	putU16(withNull, 20, u16(withNull, 20)|0x0001)
+	withNull[tupleHeaderSize] = 0x01
+	withNull[22] = 32
+	page := testHeapPage(testVersion(100, 101, ItemPointer{Offset: 2}, heapHotUpdated, 1, 10), withNull)
+	putU32(page, headerSize, 2|lpRedirect<<15) // item 1 pruned to a redirect to item 2
+	putU32(page, 20, 101)                      // pd_prune_xid
+
+	insp, err := InspectHeapPage(page, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := insp.Header
+	if insp.Block != 3 || h.Lower != headerSize+2*itemIDSize || h.PageSize != PageSize || h.Version != 4 || h.PruneXid != 101 {
+		t.Errorf("header = %+v", h)
+	}
+	if len(insp.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(insp.Items))
+	}
+
+	redirect := insp.Items[0]
+	if redirect.Lp != 1 || redirect.LpFlags != lpRedirect || redirect.LpOff != 2 || redirect.LpLen != 0 {
+		t.Errorf("redirect = %+v", redirect)
+	}
+	if redirect.TXmin != nil || redirect.TData != nil {
+		t.Error("redirect line pointer has tuple fields")
+	}
+
+	item := insp.Items[1]
+	if item.TXmin == nil || *item.TXmin != 100 || *item.TCtid != (ItemPointer{Offset: 2}) || *item.THoff != 32 {
+		t.Fatalf("item = %+v", item)
+	}
+	if item.TBits == nil || *item.TBits != "10000000" || item.TOid != nil {
+		t.Errorf("t_bits = %v, t_oid = %v", item.TBits, item.TOid)
+	}
+	if *item.TData != `\x02000000` {
+		t.Errorf("t_data = %s", *item.TData)
+	}
+
+	var out bytes.Buffer
+	if err := WriteInspection(&out, []PageInspection{*insp}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Block 3\n lsn | checksum | flags | lower | upper | special | pagesize | version | prune_xid\n",
+		" lp | lp_off | lp_flags | lp_len | t_xmin | t_xmax | t_field3 | t_ctid | t_infomask2 | t_infomask | t_hoff |  t_bits  | t_oid |   t_data\n",
+		"  1 |      2 |        2 |      0 |        |        |          |        |             |            |        |          |       |\n",
+		"  2 |   8120 |        1 |     36 |    100 |      0 |        0 | (0,2)  |           2 |       2049 |     32 | 10000000 |       | \\x02000000\n(2 rows)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteInspection missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package pgdump
 
-import "math"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // JSONB constants
 const (
@@ -170,81 +175,108 @@ func decodeJNumeric(data []byte) interface{} {
 			content = data[1:n]
 		}
 	}
-	return DecodeNumeric(content)
+	// JSON numbers keep their exact digits
+	if s, ok := DecodeNumeric(content).(string); ok {
+		return json.Number(s)
+	}
+	return nil
 }
 
-// DecodeNumeric decodes PostgreSQL numeric type
+// On-disk numeric header bits (numeric.c)
+const (
+	numericSignMask    = 0xC000
+	numericNeg         = 0x4000
+	numericShort       = 0x8000
+	numericSpecial     = 0xC000
+	numericExtSignMask = 0xF000
+	numericPInf        = 0xD000
+	numericNInf        = 0xF000
+
+	numericShortSign        = 0x2000
+	numericShortDscaleMask  = 0x1F80
+	numericShortDscaleShift = 7
+	numericShortWeightSign  = 0x0040
+	numericShortWeightMask  = 0x003F
+	numericDscaleMask       = 0x3FFF
+)
+
+// DecodeNumeric decodes PostgreSQL numeric type to its exact decimal text,
+// as numeric_out prints it: "12345678901234.56", "NaN", "Infinity".
+// Returns nil if the datum is truncated.
 func DecodeNumeric(raw []byte) interface{} {
 	if len(raw) < 2 {
 		return nil
 	}
 
 	header := u16(raw, 0)
-	if header&0x8000 != 0 {
-		return decodeNumericShort(raw, header)
-	}
-	return decodeNumericLong(raw)
-}
-
-func decodeNumericShort(raw []byte, header uint16) interface{} {
-	sign := 1
-	if header&0x2000 != 0 {
-		sign = -1
-	}
-	weight := int(header & 0x003F)
-	if header&0x0040 != 0 {
-		weight = -weight - 1
+	if header&numericSignMask == numericSpecial {
+		switch header & numericExtSignMask {
+		case numericPInf:
+			return "Infinity"
+		case numericNInf:
+			return "-Infinity"
+		}
+		return "NaN"
 	}
 
-	ndigits := (len(raw) - 2) / 2
-	if ndigits == 0 {
-		return 0
+	// Short format: sign, display scale and weight packed in one word
+	var neg bool
+	var weight, dscale, start int
+	if header&numericShort != 0 {
+		neg = header&numericShortSign != 0
+		dscale = int(header&numericShortDscaleMask) >> numericShortDscaleShift
+		weight = int(header & numericShortWeightMask)
+		if header&numericShortWeightSign != 0 {
+			weight -= numericShortWeightMask + 1
+		}
+		start = 2
+	} else {
+		if len(raw) < 4 {
+			return nil
+		}
+		neg = header&numericSignMask == numericNeg
+		dscale = int(header & numericDscaleMask)
+		weight = int(i16(raw, 2))
+		start = 4
 	}
 
-	digits := make([]int, ndigits)
-	for i := 0; i < ndigits; i++ {
-		digits[i] = int(u16(raw, 2+i*2))
+	digits := make([]int, (len(raw)-start)/2)
+	for i := range digits {
+		digits[i] = int(u16(raw, start+i*2))
 	}
-	return computeNumeric(digits, weight, sign)
+	return numericString(digits, weight, dscale, neg)
 }
 
-func decodeNumericLong(raw []byte) interface{} {
-	if len(raw) < 8 {
-		return nil
-	}
-	ndigits := int(u16(raw, 0))
-	weight := int(i16(raw, 2))
-	sign := 1
-	if u16(raw, 4) == 0x4000 {
-		sign = -1
-	}
-	if ndigits == 0 {
-		return 0
-	}
-	if len(raw) < 8+ndigits*2 {
-		return nil
-	}
-
-	digits := make([]int, ndigits)
-	for i := 0; i < ndigits; i++ {
-		digits[i] = int(u16(raw, 8+i*2))
+// numericString prints base-10000 digits the way get_str_from_var does:
+// digits[0] is the 10000^weight group, and dscale decimal digits follow
+// the point
+func numericString(digits []int, weight, dscale int, neg bool) string {
+	group := func(i int) int {
+		if i < 0 || i >= len(digits) {
+			return 0
+		}
+		return digits[i]
 	}
-	return computeNumeric(digits, weight, sign)
-}
 
-func computeNumeric(digits []int, weight, sign int) float64 {
-	if len(digits) == 0 {
-		return 0
-	}
-	result := float64(0)
-	for _, d := range digits {
-		result = result*10000 + float64(d)
+	var sb strings.Builder
+	if neg && len(digits) > 0 {
+		sb.WriteByte('-')
 	}
-	exp := weight - len(digits) + 1
-	if exp >= 0 {
-		result *= math.Pow(10000, float64(exp))
+	if weight < 0 {
+		sb.WriteByte('0')
 	} else {
-		result /= math.Pow(10000, float64(-exp))
+		sb.WriteString(strconv.Itoa(group(0)))
+		for i := 1; i <= weight; i++ {
+			fmt.Fprintf(&sb, "%04d", group(i))
+		}
+	}
+	if dscale > 0 {
+		var frac strings.Builder
+		for i := weight + 1; frac.Len() < dscale; i++ {
+			fmt.Fprintf(&frac, "%04d", group(i))
+		}
+		sb.WriteByte('.')
+		sb.WriteString(frac.String()[:dscale])
 	}
-	return float64(sign) * result
+	return sb.String()
 }
@@ -1,6 +1,7 @@
 package pgdump
 
 import (
+	"os"
 	"testing"
 )
 
@@ -179,6 +180,68 @@ func TestRelMapGetOID(t *testing.T) {
 	}
 }
 
+// testRelMap builds a pg_filenode.map with the given OID -> filenode pairs
+func testRelMap(pairs ...uint32) []byte {
+	data := make([]byte, 512)
+	putU32(data, 0, RelMapMagic)
+	putU32(data, 4, uint32(len(pairs)/2))
+	for i := 0; i+1 < len(pairs); i += 2 {
+		putU32(data, 8+i*4, pairs[i])
+		putU32(data, 12+i*4, pairs[i+1])
+	}
+	return data
+}
+
+func TestReadMappedCatalog(t *testing.T) {
+	files := map[string][]byte{
+		"global/pg_filenode.map": testRelMap(PGDatabase, 16500),
+		"global/16500":           []byte("rewritten"),
+		"global/1260":            []byte("authid"),
+	}
+	reader := func(path string) ([]byte, error) {
+		if data, ok := files[path]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	if data, err := ReadMappedCatalog(reader, "global", PGDatabase); err != nil || string(data) != "rewritten" {
+		t.Errorf("remapped catalog: got %q, %v", data, err)
+	}
+	if data, err := ReadMappedCatalog(reader, "global", PGAuthID); err != nil || string(data) != "authid" {
+		t.Errorf("unmapped catalog should fall back to OID: got %q, %v", data, err)
+	}
+	if _, err := ReadMappedCatalog(reader, "base/5", PGClass); err == nil {
+		t.Error("expected error for missing catalog")
+	}
+}
+
+func TestDumpDataDirRemappedCatalogs(t *testing.T) {
+	dir := t.TempDir()
+
+	dbRow := make([]byte, 76)
+	putU32(dbRow, 0, 16384)
+	copy(dbRow[4:], testName("app"))
+	putU32(dbRow, 72, PGEncUTF8)
+
+	// Both pg_database and pg_class were rewritten by VACUUM FULL
+	testWriteFile(t, dir, "global/pg_filenode.map", testRelMap(PGDatabase, 17000))
+	testWriteFile(t, dir, "global/17000", testHeapPage(testHeapTuple(4, dbRow)))
+	testWriteFile(t, dir, "base/16384/pg_filenode.map", testRelMap(PGClass, 17001))
+	testWriteFile(t, dir, "base/16384/17001", testHeapPage(testClassRow(16400, "users", 2200, 16400, 'r')))
+
+	result, err := DumpDataDir(dir, &Options{SkipSystemTables: true, ListOnly: true})
+	if err != nil {
+		t.Fatalf("DumpDataDir failed: %v", err)
+	}
+	if len(result.Databases) != 1 || result.Databases[0].Name != "app" {
+		t.Fatalf("expected database app, got %+v", result.Databases)
+	}
+	if tables := result.Databases[0].Tables; len(tables) != 1 || tables[0].Name != "users" {
+		t.Errorf("expected table users, got %+v", tables)
+	}
+}
+
 func TestGetCatalogName(t *testing.T) {
 	tests := []struct {
 		oid  uint32
@@ -0,0 +1,505 @@
+package pgdump
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pg_node_tree is the text form of an analyzed expression (outfuncs.c), as
+// stored in pg_attrdef.adbin, pg_constraint.conbin and pg_index.indexprs:
+//
+//	{OPEXPR :opno 521 :args ({VAR :varattno 2 ...} {CONST :consttype 23 ... :constvalue 4 [ 0 0 0 0 ]})}
+//
+// There is no SQL text to fall back on since PostgreSQL 12 dropped adsrc and
+// consrc, so the trees are parsed and deparsed here.
+
+// exprNode is a parsed {NODE :field value ...}. Field values are strings,
+// *exprNode, []interface{} (lists), []byte (datums) or nil (<>).
+type exprNode struct {
+	Type   string
+	Fields map[string]interface{}
+}
+
+func (n *exprNode) str(field string) string {
+	s, _ := n.Fields[field].(string)
+	return s
+}
+
+func (n *exprNode) int(field string) int {
+	v, _ := strconv.Atoi(n.str(field))
+	return v
+}
+
+func (n *exprNode) node(field string) *exprNode {
+	c, _ := n.Fields[field].(*exprNode)
+	return c
+}
+
+func (n *exprNode) list(field string) []interface{} {
+	l, _ := n.Fields[field].([]interface{})
+	return l
+}
+
+// ParseNodeTree parses a pg_node_tree into a node, or a list of nodes for
+// pg_index.indexprs
+func ParseNodeTree(s string) (interface{}, error) {
+	p := &nodeParser{toks: tokenizeNodeTree(s)}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("trailing data in node tree at token %d", p.pos)
+	}
+	return v, nil
+}
+
+// tokenizeNodeTree splits on whitespace and the delimiters (){}[]. A
+// backslash escapes the next character; <> stays a single token.
+func tokenizeNodeTree(s string) []string {
+	var toks []string
+	var cur strings.Builder
+	inTok := false
+	flush := func() {
+		if inTok {
+			toks = append(toks, cur.String())
+			cur.Reset()
+			inTok = false
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inTok = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		case strings.IndexByte("(){}[]", c) >= 0:
+			flush()
+			toks = append(toks, string(c))
+		case c == '"' && !inTok:
+			// quoted string (empty strings and PG16+ string fields)
+			flush()
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				cur.WriteByte(s[j])
+				j++
+			}
+			toks = append(toks, cur.String())
+			cur.Reset()
+			i = j
+		default:
+			cur.WriteByte(c)
+			inTok = true
+		}
+	}
+	flush()
+	return toks
+}
+
+type nodeParser struct {
+	toks []string
+	pos  int
+}
+
+func (p *nodeParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *nodeParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *nodeParser) value() (interface{}, error) {
+	switch t := p.next(); t {
+	case "":
+		return nil, fmt.Errorf("unexpected end of node tree")
+	case "<>":
+		return nil, nil
+	case "{":
+		return p.node()
+	case "(":
+		return p.list()
+	default:
+		// datum: length followed by its bytes, e.g. 4 [ 5 0 0 0 0 0 0 0 ]
+		if p.peek() == "[" {
+			return p.datum()
+		}
+		return t, nil
+	}
+}
+
+func (p *nodeParser) node() (*exprNode, error) {
+	n := &exprNode{Type: p.next(), Fields: make(map[string]interface{})}
+	for {
+		t := p.next()
+		switch {
+		case t == "}":
+			return n, nil
+		case strings.HasPrefix(t, ":"):
+			// flag-less fields are followed by their value, except an empty
+			// list or node written as nothing before the next field
+			if nt := p.peek(); strings.HasPrefix(nt, ":") || nt == "}" {
+				n.Fields[t[1:]] = nil
+				continue
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			n.Fields[t[1:]] = v
+		case t == "":
+			return nil, fmt.Errorf("unterminated %s node", n.Type)
+		default:
+			return nil, fmt.Errorf("unexpected token %q in %s node", t, n.Type)
+		}
+	}
+}
+
+func (p *nodeParser) list() ([]interface{}, error) {
+	var items []interface{}
+	// typed lists: (i 1 2), (o 23 25), (b 1 3) for bitmapsets
+	if t := p.peek(); t == "i" || t == "o" || t == "b" || t == "x" {
+		p.next()
+	}
+	for p.peek() != ")" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("unterminated list")
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	p.next()
+	return items, nil
+}
+
+func (p *nodeParser) datum() ([]byte, error) {
+	p.next() // [
+	var b []byte
+	for p.peek() != "]" {
+		t := p.next()
+		if t == "" {
+			return nil, fmt.Errorf("unterminated datum")
+		}
+		v, err := strconv.ParseInt(t, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datum byte %q", t)
+		}
+		b = append(b, byte(v))
+	}
+	p.next()
+	return b, nil
+}
+
+// exprContext resolves the OIDs an expression refers to
+type exprContext struct {
+	columns   map[int]string    // varattno -> column name
+	relations map[uint32]string // pg_class OID -> qualified name (regclass)
+	procs     map[uint32]string // pg_proc OID -> proname
+	operators map[uint32]string // pg_operator OID -> oprname
+	types     *TypeCatalog
+
+	// regclasses collects the relations referenced by regclass constants
+	// (the sequences of nextval defaults), if non-nil
+	regclasses map[uint32]bool
+}
+
+// DeparseExpr turns a pg_node_tree into SQL, as pg_get_expr would
+func (ctx *exprContext) DeparseExpr(tree string) (string, error) {
+	v, err := ParseNodeTree(tree)
+	if err != nil {
+		return "", err
+	}
+	return ctx.deparse(v)
+}
+
+// deparseList deparses each element of a list (pg_index.indexprs). As in
+// pg_get_indexdef, function calls stand alone and anything else, casts
+// included, is parenthesized.
+func (ctx *exprContext) deparseList(tree string) ([]string, error) {
+	v, err := ParseNodeTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		if out[i], err = ctx.deparse(item); err != nil {
+			return nil, err
+		}
+		if !looksLikeFunction(item) {
+			out[i] = "(" + out[i] + ")"
+		}
+	}
+	return out, nil
+}
+
+// looksLikeFunction reports whether v deparses to function call syntax
+// (looks_like_function in ruleutils.c)
+func looksLikeFunction(v interface{}) bool {
+	n, ok := v.(*exprNode)
+	if !ok {
+		return false
+	}
+	switch n.Type {
+	case "FUNCEXPR":
+		format := n.int("funcformat")
+		return format == 0 || format == 3 // explicit call, SQL syntax
+	case "COALESCEEXPR", "SQLVALUEFUNCTION":
+		return true
+	}
+	return false
+}
+
+func (ctx *exprContext) deparseArgs(n *exprNode) ([]string, error) {
+	var args []string
+	for _, a := range n.list("args") {
+		s, err := ctx.deparse(a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, s)
+	}
+	return args, nil
+}
+
+func (ctx *exprContext) typeName(oid int) string {
+	return pgTypeToSQL(ctx.types.Name(oid), oid)
+}
+
+// sqlValueFunctions are the SQLValueFunction ops of PG12-15 (SVFOp)
+var sqlValueFunctions = []string{
+	"CURRENT_DATE", "CURRENT_TIME", "CURRENT_TIME", "CURRENT_TIMESTAMP", "CURRENT_TIMESTAMP",
+	"LOCALTIME", "LOCALTIME", "LOCALTIMESTAMP", "LOCALTIMESTAMP",
+	"CURRENT_ROLE", "CURRENT_USER", "USER", "SESSION_USER", "CURRENT_CATALOG", "CURRENT_SCHEMA",
+}
+
+// sqlSyntaxFunctions are the SQL keywords of the functions PG16+ calls with
+// COERCE_SQL_SYNTAX, by proname; those of the first line take an optional
+// precision argument
+var sqlSyntaxFunctions = map[string]string{
+	"current_time": "CURRENT_TIME", "current_timestamp": "CURRENT_TIMESTAMP", "localtime": "LOCALTIME", "localtimestamp": "LOCALTIMESTAMP",
+	"current_date": "CURRENT_DATE", "current_role": "CURRENT_ROLE", "current_user": "CURRENT_USER", "user": "USER",
+	"session_user": "SESSION_USER", "system_user": "SYSTEM_USER", "current_database": "CURRENT_CATALOG", "current_schema": "CURRENT_SCHEMA",
+}
+
+func (ctx *exprContext) deparse(v interface{}) (string, error) {
+	n, ok := v.(*exprNode)
+	if !ok {
+		return "", fmt.Errorf("expected a node, got %T", v)
+	}
+
+	switch n.Type {
+	case "VAR":
+		if name, ok := ctx.columns[n.int("varattno")]; ok {
+			return quoteIdent(name), nil
+		}
+		return "", fmt.Errorf("unknown column %d", n.int("varattno"))
+
+	case "CONST":
+		return ctx.deparseConst(n)
+
+	case "FUNCEXPR":
+		args, err := ctx.deparseArgs(n)
+		if err != nil {
+			return "", err
+		}
+		name, ok := ctx.procs[uint32(n.int("funcid"))]
+		switch n.int("funcformat") {
+		case 1: // explicit cast
+			if len(args) > 0 {
+				return fmt.Sprintf("(%s)::%s", args[0], ctx.typeName(n.int("funcresulttype"))), nil
+			}
+		case 2: // implicit cast
+			if len(args) > 0 {
+				return args[0], nil
+			}
+		case 3: // SQL syntax (PG16+ CURRENT_TIMESTAMP and friends)
+			keyword, known := sqlSyntaxFunctions[name]
+			switch {
+			case !ok || !known:
+				return "", fmt.Errorf("no SQL syntax for function %d", n.int("funcid"))
+			case len(args) == 0:
+				return keyword, nil
+			case len(args) == 1 && (strings.HasPrefix(name, "current_time") || strings.HasPrefix(name, "localtime")):
+				return fmt.Sprintf("%s(%s)", keyword, args[0]), nil
+			}
+			return "", fmt.Errorf("no SQL syntax for %s with %d arguments", name, len(args))
+		}
+		if !ok {
+			return "", fmt.Errorf("unknown function %d", n.int("funcid"))
+		}
+		return fmt.Sprintf("%s(%s)", quoteIdent(name), strings.Join(args, ", ")), nil
+
+	case "OPEXPR", "DISTINCTEXPR":
+		args, err := ctx.deparseArgs(n)
+		if err != nil {
+			return "", err
+		}
+		op, ok := ctx.operators[uint32(n.int("opno"))]
+		if !ok {
+			return "", fmt.Errorf("unknown operator %d", n.int("opno"))
+		}
+		if n.Type == "DISTINCTEXPR" {
+			op = "IS DISTINCT FROM"
+		}
+		switch len(args) {
+		case 1:
+			return fmt.Sprintf("(%s %s)", op, args[0]), nil
+		case 2:
+			return fmt.Sprintf("(%s %s %s)", args[0], op, args[1]), nil
+		}
+		return "", fmt.Errorf("operator with %d arguments", len(args))
+
+	case "SCALARARRAYOPEXPR":
+		args, err := ctx.deparseArgs(n)
+		if err != nil || len(args) != 2 {
+			return "", fmt.Errorf("malformed ScalarArrayOpExpr")
+		}
+		op, ok := ctx.operators[uint32(n.int("opno"))]
+		if !ok {
+			return "", fmt.Errorf("unknown operator %d", n.int("opno"))
+		}
+		quantifier := "ALL"
+		if n.str("useOr") == "true" {
+			quantifier = "ANY"
+		}
+		return fmt.Sprintf("(%s %s %s (%s))", args[0], op, quantifier, args[1]), nil
+
+	case "BOOLEXPR":
+		args, err := ctx.deparseArgs(n)
+		if err != nil || len(args) == 0 {
+			return "", fmt.Errorf("malformed BoolExpr")
+		}
+		switch n.str("boolop") {
+		case "not":
+			return fmt.Sprintf("(NOT %s)", args[0]), nil
+		case "or":
+			return "(" + strings.Join(args, " OR ") + ")", nil
+		}
+		return "(" + strings.Join(args, " AND ") + ")", nil
+
+	case "NULLTEST":
+		arg, err := ctx.deparse(n.node("arg"))
+		if err != nil {
+			return "", err
+		}
+		if n.int("nulltesttype") == 1 {
+			return fmt.Sprintf("(%s IS NOT NULL)", arg), nil
+		}
+		return fmt.Sprintf("(%s IS NULL)", arg), nil
+
+	case "BOOLEANTEST":
+		arg, err := ctx.deparse(n.node("arg"))
+		if err != nil {
+			return "", err
+		}
+		tests := []string{"IS TRUE", "IS NOT TRUE", "IS FALSE", "IS NOT FALSE", "IS UNKNOWN", "IS NOT UNKNOWN"}
+		if t := n.int("booltesttype"); t >= 0 && t < len(tests) {
+			return fmt.Sprintf("(%s %s)", arg, tests[t]), nil
+		}
+		return "", fmt.Errorf("unknown boolean test")
+
+	case "RELABELTYPE", "COERCEVIAIO", "ARRAYCOERCEEXPR", "COERCETODOMAIN":
+		arg, err := ctx.deparse(n.node("arg"))
+		if err != nil {
+			return "", err
+		}
+		// CoercionForm: 1 = explicit cast, anything else shows just the argument
+		format := n.str("relabelformat") + n.str("coerceformat") + n.str("coercionformat")
+		if format != "1" {
+			return arg, nil
+		}
+		return fmt.Sprintf("(%s)::%s", arg, ctx.typeName(n.int("resulttype"))), nil
+
+	case "ARRAYEXPR":
+		var elems []string
+		for _, e := range n.list("elements") {
+			s, err := ctx.deparse(e)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, s)
+		}
+		return "ARRAY[" + strings.Join(elems, ", ") + "]", nil
+
+	case "COALESCEEXPR":
+		args, err := ctx.deparseArgs(n)
+		if err != nil {
+			return "", err
+		}
+		return "COALESCE(" + strings.Join(args, ", ") + ")", nil
+
+	case "SQLVALUEFUNCTION":
+		op := n.int("op")
+		if op < 0 || op >= len(sqlValueFunctions) {
+			return "", fmt.Errorf("unknown SQLValueFunction %d", op)
+		}
+		// the _N variants carry a precision in typmod
+		if typmod := n.int("typmod"); op <= 8 && op%2 == 0 && op > 0 && typmod >= 0 {
+			return fmt.Sprintf("%s(%d)", sqlValueFunctions[op], typmod), nil
+		}
+		return sqlValueFunctions[op], nil
+	}
+	return "", fmt.Errorf("unsupported expression node %s", n.Type)
+}
+
+func (ctx *exprContext) deparseConst(n *exprNode) (string, error) {
+	typ := n.int("consttype")
+	if n.str("constisnull") == "true" {
+		return "NULL::" + ctx.typeName(typ), nil
+	}
+	raw, _ := n.Fields["constvalue"].([]byte)
+	switch length := n.int("constlen"); {
+	case length == -1:
+		raw, _ = ReadVarlena(raw)
+	case length == -2:
+		raw = []byte(cstring(raw, len(raw)))
+	case length > 0 && length <= len(raw):
+		raw = raw[:length]
+	}
+
+	switch typ {
+	case OidRegclass:
+		if len(raw) >= 4 {
+			if name, ok := ctx.relations[u32(raw, 0)]; ok {
+				if ctx.regclasses != nil {
+					ctx.regclasses[u32(raw, 0)] = true
+				}
+				return quoteLiteral(name) + "::regclass", nil
+			}
+		}
+		return "", fmt.Errorf("unknown regclass constant")
+	case OidInt2, OidInt4, OidInt8, OidOid, OidFloat4, OidFloat8, OidBool:
+		return formatSQLValue(decodeType(raw, typ, &rowDecoder{types: ctx.types}), typ), nil
+	}
+
+	val := decodeType(raw, typ, &rowDecoder{types: ctx.types})
+	switch {
+	case val == nil && len(raw) == 0:
+		val = "" // empty string
+	case val == nil:
+		return "", fmt.Errorf("undecodable constant of type %d", typ)
+	}
+	if _, isArray := val.([]interface{}); isArray {
+		return formatSQLValue(val, typ) + "::" + ctx.typeName(typ), nil
+	}
+	return quoteLiteral(fmt.Sprintf("%v", val)) + "::" + ctx.typeName(typ), nil
+}
@@ -0,0 +1,75 @@
+package pgdump
+
+import "testing"
+
+func testExprContext() *exprContext {
+	return &exprContext{
+		columns:   map[int]string{1: "id", 2: "email", 3: "total"},
+		relations: map[uint32]string{16420: "public.orders_id_seq"},
+		procs:     map[uint32]string{480: "nextval", 870: "lower", 861: "current_database", 1299: "now", 2647: "localtimestamp"},
+		operators: map[uint32]string{521: ">", 98: "="},
+	}
+}
+
+func TestDeparseExpr(t *testing.T) {
+	tests := []struct {
+		tree, want string
+	}{
+		// nextval('orders_id_seq'::regclass), as stored in pg_attrdef.adbin
+		{`{FUNCEXPR :funcid 480 :funcresulttype 20 :funcretset false :funcvariadic false :funcformat 0 :funccollid 0 :inputcollid 0 :args ({CONST :consttype 2205 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 64 :constvalue 4 [ 36 64 0 0 0 0 0 0 ]}) :location 56}`,
+			"nextval('public.orders_id_seq'::regclass)"},
+		{`{OPEXPR :opno 521 :opfuncid 147 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 0 :args ({VAR :varno 1 :varattno 3 :vartype 23 :vartypmod -1 :varcollid 0 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 3 :location 42} {CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 50 :constvalue 4 [ 0 0 0 0 0 0 0 0 ]}) :location 48}`,
+			"(total > 0)"},
+		{`{BOOLEXPR :boolop or :args ({NULLTEST :arg {VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 7} :nulltesttype 0 :argisrow false :location 13} {OPEXPR :opno 98 :opfuncid 67 :opresulttype 16 :opretset false :opcollid 0 :inputcollid 100 :args ({VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 26} {CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 34 :constvalue 7 [ 28 0 0 0 110 101 119 ]}) :location 32}) :location 21}`,
+			"((email IS NULL) OR (email = 'new'::TEXT))"},
+		{`{SQLVALUEFUNCTION :op 3 :type 1184 :typmod -1 :location 57}`, "CURRENT_TIMESTAMP"},
+		// PG16+ calls the functions behind these keywords with COERCE_SQL_SYNTAX
+		{`{FUNCEXPR :funcid 861 :funcresulttype 19 :funcretset false :funcvariadic false :funcformat 3 :funccollid 950 :inputcollid 0 :args <> :location 9}`, "CURRENT_CATALOG"},
+		{`{FUNCEXPR :funcid 2647 :funcresulttype 1114 :funcretset false :funcvariadic false :funcformat 3 :funccollid 0 :inputcollid 0 :args ({CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true :constisnull false :location 22 :constvalue 4 [ 2 0 0 0 0 0 0 0 ]}) :location 7}`, "LOCALTIMESTAMP(2)"},
+		{`{CONST :consttype 25 :consttypmod -1 :constcollid 100 :constlen -1 :constbyval false :constisnull false :location 1 :constvalue 4 [ 16 0 0 0 ]}`, "''::TEXT"},
+	}
+	ctx := testExprContext()
+	for _, tt := range tests {
+		got, err := ctx.DeparseExpr(tt.tree)
+		if err != nil {
+			t.Errorf("DeparseExpr(%.40s...) failed: %v", tt.tree, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DeparseExpr = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDeparseExprErrors(t *testing.T) {
+	ctx := testExprContext()
+	for _, tree := range []string{
+		`{OPEXPR :opno 521 :args ({VAR :varattno 9}`,
+		`{VAR :varattno 9}`,
+		`{WINDOWFUNC :winfnoid 3100}`,
+		`{FUNCEXPR :funcid 1299 :funcformat 3 :args <>}`,
+	} {
+		if got, err := ctx.DeparseExpr(tree); err == nil {
+			t.Errorf("DeparseExpr(%q) = %q, want an error", tree, got)
+		}
+	}
+}
+
+func TestDeparseIndexExprs(t *testing.T) {
+	exprs, err := testExprContext().deparseList(`({FUNCEXPR :funcid 870 :funcresulttype 25 :funcretset false :funcvariadic false :funcformat 0 :funccollid 100 :inputcollid 100 :args ({VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 52}) :location 46})`)
+	if err != nil {
+		t.Fatalf("deparseList failed: %v", err)
+	}
+	if len(exprs) != 1 || exprs[0] != "lower(email)" {
+		t.Errorf("got %q, want [lower(email)]", exprs)
+	}
+
+	// Casts and operators are parenthesized, whatever they end with
+	exprs, err = testExprContext().deparseList(`({RELABELTYPE :arg {VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 1} :resulttype 1043 :resulttypmod -1 :resultcollid 100 :relabelformat 1 :location 6} {COALESCEEXPR :coalescetype 25 :coalescecollid 100 :args ({VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100 :varnullingrels (b) :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 30}) :location 21})`)
+	if err != nil {
+		t.Fatalf("deparseList failed: %v", err)
+	}
+	if len(exprs) != 2 || exprs[0][0] != '(' || exprs[1] != "COALESCE(email)" {
+		t.Errorf("got %q, want a parenthesized cast and a bare COALESCE", exprs)
+	}
+}
@@ -0,0 +1,404 @@
+package pgdump
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrphanRelation is a relation file no live pg_class entry points at: a
+// leftover of TRUNCATE, of a table rewrite, of an aborted CREATE TABLE AS,
+// or of a DROP TABLE whose files the next checkpoint has not removed yet
+type OrphanRelation struct {
+	Database string   `json:"database"`
+	Path     string   `json:"path"` // first segment, relative to the data directory
+	Filenode uint32   `json:"filenode"`
+	Size     int64    `json:"size"`            // main fork, all segments
+	Forks    []string `json:"forks,omitempty"` // other forks on disk: fsm, vm, init
+
+	// Table is the relation as the last pg_class entry pointing at the
+	// file describes it, dead or not, with the columns pg_attribute had for
+	// it then, and its rows. Without such an entry, rows are decoded with
+	// the columns InferSchema guesses, in Schema, and Guessed is set.
+	Table   *TableDump      `json:"table,omitempty"`
+	Guessed bool            `json:"guessed,omitempty"`
+	Schema  *InferredSchema `json:"schema,omitempty"`
+}
+
+// inferSamplePages is how many pages of an orphan nothing describes its
+// columns are guessed from
+const inferSamplePages = 16
+
+// relationFileRegex matches relation files: filenode, fork and segment
+var relationFileRegex = regexp.MustCompile(`^(\d+)(?:_(fsm|vm|init))?(?:\.(\d+))?$`)
+
+// ScanOrphans lists the relation files of the databases opts selects that
+// no live pg_class entry references, and dumps those holding heap pages
+func ScanOrphans(dataDir string, opts *Options) ([]OrphanRelation, error) {
+	return ScanOrphansContext(context.Background(), dataDir, opts)
+}
+
+// ScanOrphansContext is ScanOrphans stopping early with ctx's error once
+// ctx is done
+func ScanOrphansContext(ctx context.Context, dataDir string, opts *Options) ([]OrphanRelation, error) {
+	opts = withDefaults(opts)
+
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
+	if err != nil {
+		return nil, err
+	}
+	s := newOrphanScan(ctx, dataDir, opts)
+
+	var orphans []OrphanRelation
+	for _, db := range ParsePGDatabase(dbData) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if isTemplateDB(db.Name) || (opts.DatabaseFilter != "" && db.Name != opts.DatabaseFilter) {
+			continue
+		}
+		found, err := s.database(db)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+	return orphans, nil
+}
+
+// orphanScan holds the state shared by the databases of a scan
+type orphanScan struct {
+	context context.Context
+	dataDir string
+	local   RemoteReader
+	spaces  *Tablespaces
+	segSize int
+	opts    *Options
+	clog    *CommitLog
+}
+
+func newOrphanScan(ctx context.Context, dataDir string, opts *Options) *orphanScan {
+	s := &orphanScan{
+		context: ctx,
+		dataDir: dataDir,
+		local:   LocalReader(dataDir),
+		spaces:  loadLocalTablespaces(dataDir, opts.TablespaceMap),
+		opts:    opts,
+		clog:    NewCommitLog(LocalReader(dataDir)),
+	}
+	s.segSize = relationSegmentSize(s.local)
+	return s
+}
+
+// orphanCatalogs holds what a database's catalogs, live and dead tuples
+// alike, tell about its relations
+type orphanCatalogs struct {
+	class, attr []byte
+	live        map[uint32]bool // filenodes of live relations, mapped catalogs included
+	liveOIDs    map[uint32]bool // their OIDs
+	namespaces  map[uint32]string
+	types       *TypeCatalog
+}
+
+// catalogs reads what db's catalogs tell about its relations, nil if it
+// has no pg_class
+func (s *orphanScan) catalogs(db DatabaseInfo) *orphanCatalogs {
+	dbDir := s.spaces.DatabaseDir(db)
+	classData, _ := ReadMappedCatalog(s.local, dbDir, PGClass)
+	if len(classData) == 0 {
+		return nil
+	}
+	attrData, _ := ReadMappedCatalog(s.local, dbDir, PGAttribute)
+	typeData, _ := ReadMappedCatalog(s.local, dbDir, PGType)
+
+	tables := ParsePGClass(classData)
+	cat := &orphanCatalogs{class: classData, attr: attrData, live: make(map[uint32]bool), liveOIDs: make(map[uint32]bool)}
+	oidToFilenode := make(map[uint32]uint32)
+	for fn, info := range tables {
+		cat.live[fn], cat.liveOIDs[info.OID] = true, true
+		oidToFilenode[info.OID] = fn
+	}
+	if data, err := s.local(dbDir + "/pg_filenode.map"); err == nil {
+		if rm, err := ParseRelMapFile(data); err == nil {
+			for _, m := range rm.Mappings {
+				cat.live[m.Filenode], cat.liveOIDs[m.OID] = true, true
+			}
+		}
+	}
+	read := func(oid uint32) []byte {
+		data, _ := ReadRelation(s.local, s.spaces.RelationPath(db, 0, catalogFilenode(oidToFilenode, oid)), s.segSize)
+		return data
+	}
+	cat.namespaces = ParsePGNamespace(read(PGNamespace))
+	cat.types = NewTypeCatalog(typeData, read(PGEnum), ParsePGAttribute(attrData, s.opts.PostgresVersion))
+	return cat
+}
+
+// database finds the orphans of db, in its default tablespace and in the
+// others holding a directory for it
+func (s *orphanScan) database(db DatabaseInfo) ([]OrphanRelation, error) {
+	cat := s.catalogs(db)
+	if cat == nil {
+		return nil, nil
+	}
+	dbDir := s.spaces.DatabaseDir(db)
+	dirs := []string{dbDir}
+	for _, spc := range ListTablespaces(s.dataDir) {
+		if dir := s.spaces.Dir(spc.OID, db.OID); spc.OID != GlobalTablespace && dir != dbDir {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var orphans []OrphanRelation
+	for _, dir := range dirs {
+		for _, o := range s.orphanFiles(db, dir, cat.live) {
+			if err := s.context.Err(); err != nil {
+				return nil, err
+			}
+			if s.dump(&o, db, cat) {
+				orphans = append(orphans, o)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// orphanFiles lists the relations of dir whose filenode is not in live
+func (s *orphanScan) orphanFiles(db DatabaseInfo, dir string, live map[uint32]bool) []OrphanRelation {
+	entries, err := os.ReadDir(localPath(s.dataDir, dir))
+	if err != nil {
+		return nil
+	}
+	byNode := make(map[uint32]*OrphanRelation)
+	var nodes []uint32
+	for _, e := range entries {
+		m := relationFileRegex.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		n, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil || live[uint32(n)] {
+			continue
+		}
+		fn := uint32(n)
+		o := byNode[fn]
+		if o == nil {
+			o = &OrphanRelation{Database: db.Name, Path: fmt.Sprintf("%s/%d", dir, fn), Filenode: fn}
+			byNode[fn] = o
+			nodes = append(nodes, fn)
+		}
+		if m[2] != "" {
+			if !strings.Contains(e.Name(), ".") {
+				o.Forks = append(o.Forks, m[2])
+			}
+		} else if info, err := e.Info(); err == nil {
+			o.Size += info.Size()
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	orphans := make([]OrphanRelation, len(nodes))
+	for i, fn := range nodes {
+		orphans[i] = *byNode[fn]
+	}
+	return orphans
+}
+
+// dump describes orphan o and decodes its rows, reporting whether the
+// scan's filters keep it
+func (s *orphanScan) dump(o *OrphanRelation, db DatabaseInfo, cat *orphanCatalogs) bool {
+	opts := s.opts
+	info, tuple, found := lastClassEntry(cat.class, s.clog, func(info TableInfo) bool { return info.Filenode == o.Filenode })
+	if !found {
+		if opts.TableFilter != "" || opts.SchemaFilter != "" {
+			return false
+		}
+		if !opts.ListOnly {
+			s.guessRows(o, db)
+		}
+		return true
+	}
+
+	info.Schema = cat.namespaces[info.Namespace]
+	if !s.keep(info) {
+		return false
+	}
+	o.Table = s.tableDump(db, cat, info, tuple, o.Path)
+	return true
+}
+
+// keep reports whether the scan's filters keep relation info
+func (s *orphanScan) keep(info TableInfo) bool {
+	opts := s.opts
+	if opts.SkipSystemTables && (strings.HasPrefix(info.Name, "pg_") || isSystemSchema(info.Schema)) {
+		return false
+	}
+	if opts.SchemaFilter != "" && info.Schema != opts.SchemaFilter {
+		return false
+	}
+	if opts.ExcludeSchema != "" && info.Schema == opts.ExcludeSchema {
+		return false
+	}
+	return opts.TableFilter == "" || strings.Contains(strings.ToLower(info.Name), strings.ToLower(opts.TableFilter))
+}
+
+// tableDump describes the relation of pg_class entry info, whose tuple is
+// live or dead, and decodes the rows of the file at path if it is still
+// there
+func (s *orphanScan) tableDump(db DatabaseInfo, cat *orphanCatalogs, info TableInfo, tuple *HeapTupleData, path string) *TableDump {
+	opts := s.opts
+
+	// The columns are those before the transaction that moved the
+	// relation off the file, which may have changed them too
+	var before uint32
+	if h := tuple.Header; !h.XmaxInvalid && h.Infomask&heapXmaxIsMulti == 0 && !tuple.xmaxLockOnly() {
+		before = h.Xmax
+	}
+	attrs := lastAttributes(cat.attr, opts.PostgresVersion, info.OID, before, s.clog)
+
+	t := &TableDump{OID: info.OID, Schema: info.Schema, Name: info.Name, Filenode: info.Filenode, Kind: info.Kind}
+	for _, a := range attrs {
+		t.Columns = append(t.Columns, ColumnInfo{
+			Name:    a.Name,
+			Type:    cat.types.FormatType(a.TypID, a.TypMod, a.NDims),
+			TypID:   a.TypID,
+			NotNull: a.NotNull,
+		})
+	}
+	if opts.ListOnly || len(attrs) == 0 || !strings.Contains("rtm", info.Kind) {
+		return t
+	}
+
+	f, err := OpenRelation(localPath(s.dataDir, path), s.segSize)
+	if err != nil {
+		return t
+	}
+	defer f.Close()
+	dec := &rowDecoder{types: cat.types, loc: opts.TimeZone, clog: s.clog, toast: s.toast(db, cat, info)}
+	rows := newRowIterator(f, attrColumns(attrs), dec, pgEncodingToDecoder(db.Encoding), OutputEncoder(opts.OutputEncoding))
+	rows.ctx = s.context
+	t.Rows = rows.all()
+	t.RowCount = len(t.Rows)
+	return t
+}
+
+// toast loads the TOAST table info last had, nil if it had none or its
+// file is gone
+func (s *orphanScan) toast(db DatabaseInfo, cat *orphanCatalogs, info TableInfo) *TOASTReader {
+	if info.ToastRelID == 0 {
+		return nil
+	}
+	toast, _, found := lastClassEntry(cat.class, s.clog, func(t TableInfo) bool { return t.OID == info.ToastRelID })
+	if !found {
+		return nil
+	}
+	data, err := ReadRelation(s.local, s.spaces.RelationPath(db, toast.Tablespace, toast.Filenode), s.segSize)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	reader := &TOASTReader{chunks: make(map[uint32][]TOASTChunk)}
+	reader.LoadTOASTTable(info.ToastRelID, data)
+	return reader
+}
+
+// guessRows decodes the visible tuples of an orphan nothing describes,
+// if its first page is a heap page, with the columns InferSchema guesses
+// from its first pages
+func (s *orphanScan) guessRows(o *OrphanRelation, db DatabaseInfo) {
+	f, err := OpenRelation(localPath(s.dataDir, o.Path), s.segSize)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sample := make([]byte, inferSamplePages*PageSize)
+	n, _ := f.ReadAt(sample, 0)
+	sample = sample[:n-n%PageSize]
+	if len(sample) == 0 || !validHeader(parseHeader(sample)) || u16(sample, 16) != PageSize {
+		return // no heap page: an index or a sequence
+	}
+	schema := InferSchema(sample)
+	columns := schema.DecodeColumns()
+
+	dec := &rowDecoder{clog: s.clog}
+	decoder, encoder := pgEncodingToDecoder(db.Encoding), OutputEncoder(s.opts.OutputEncoding)
+	t := &TableDump{Filenode: o.Filenode}
+	for i, c := range schema.Columns {
+		t.Columns = append(t.Columns, ColumnInfo{Name: c.Name, Type: c.Type, TypID: columns[i].TypID})
+	}
+	names := columnNames(columns)
+	page := make([]byte, PageSize)
+	for off := int64(0); ; off += PageSize {
+		if n, _ := f.ReadAt(page, off); n < PageSize || s.context.Err() != nil {
+			break
+		}
+		for _, e := range ParsePage(page) {
+			if !dec.visible(e.Tuple) {
+				continue
+			}
+			row := dec.decodeTuple(e.Tuple, columns, names)
+			convertRowStrings(row, decoder, encoder)
+			t.Rows = append(t.Rows, row)
+		}
+	}
+	t.RowCount = len(t.Rows)
+	o.Table, o.Schema, o.Guessed = t, schema, true
+}
+
+// lastClassEntry returns the pg_class entry match accepts that the latest
+// transaction wrote, live or dead, with its tuple. Entries of aborted
+// transactions are only returned when there is no other, as after an
+// aborted CREATE TABLE AS.
+func lastClassEntry(classData []byte, clog *CommitLog, match func(TableInfo) bool) (TableInfo, *HeapTupleData, bool) {
+	var last TableInfo
+	var tuple *HeapTupleData
+	for _, e := range ReadTuples(classData, false) {
+		info := classInfo(DecodeTuple(e.Tuple, schemaPGClass))
+		if !match(info) || (tuple != nil && !e.Tuple.supersedes(tuple, clog)) {
+			continue
+		}
+		last, tuple = info, e.Tuple
+	}
+	return last, tuple, tuple != nil
+}
+
+// lastAttributes returns the columns of relation relid from the latest
+// version of each of its pg_attribute entries, live or dead, written
+// before transaction before (0 for any). Columns only aborted transactions
+// wrote are left out, unless the relation has no other.
+func lastAttributes(attrData []byte, version int, relid, before uint32, clog *CommitLog) []AttrInfo {
+	schema := detectAttrSchema(attrData, version)
+	byNum := make(map[int]AttrInfo)
+	tuples := make(map[int]*HeapTupleData)
+	for _, e := range ReadTuples(attrData, false) {
+		if before != 0 && !xidPrecedes(e.Tuple.orderXmin(), before) {
+			continue
+		}
+		id, a := attrInfo(DecodeTuple(e.Tuple, schema))
+		if id != relid || a.Num <= 0 {
+			continue
+		}
+		if prev, ok := tuples[a.Num]; ok && !e.Tuple.supersedes(prev, clog) {
+			continue
+		}
+		byNum[a.Num], tuples[a.Num] = a, e.Tuple
+	}
+
+	committed := false
+	for _, t := range tuples {
+		committed = committed || t.XminStatus(clog) != TxAborted
+	}
+	attrs := make([]AttrInfo, 0, len(byNum))
+	for num, a := range byNum {
+		if committed && tuples[num].XminStatus(clog) == TxAborted {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	sortAttrs(attrs)
+	return attrs
+}
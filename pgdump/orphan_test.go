@@ -0,0 +1,72 @@
+package pgdump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanOrphans(t *testing.T) {
+	// kept is live; gone was dropped by transaction 600, after note was
+	// added to it, and a column added after the drop does not count, nor
+	// do a rename and an ADD COLUMN that aborted. ctas is all an aborted
+	// CREATE TABLE AS left.
+	dir := testCatalogDataDir(t, [][]byte{
+		testClassRow(16500, "kept", 2200, 16500, 'r'),
+		testDeadTuple(testClassRow(16501, "gone", 2200, 16501, 'r'), 500, 600),
+		testAbortedTuple(testClassRow(16501, "renamed", 2200, 16501, 'r'), 590),
+		testAbortedTuple(testClassRow(16503, "ctas", 2200, 16503, 'r'), 800),
+	}, [][]byte{
+		testAttrRow(16500, "id", OidInt4, 4, 1, nil),
+		testDeadTuple(testAttrRow(16501, "id", OidInt4, 4, 1, nil), 500, 600),
+		testDeadTuple(testAttrRow(16501, "note", OidInt4, 4, 2, nil), 550, 600),
+		testAbortedTuple(testAttrRow(16501, "renamed", OidText, -1, 2, nil), 580),
+		testAbortedTuple(testAttrRow(16501, "extra", OidInt4, 4, 3, nil), 590),
+		testDeadTuple(testAttrRow(16501, "later", OidInt4, 4, 3, nil), 700, 0),
+		testAbortedTuple(testAttrRow(16503, "v", OidInt4, 4, 1, nil), 800),
+	})
+	testWriteFile(t, dir, "base/16384/16500", testHeapPage(testInt4Rows(1)...))
+	testWriteFile(t, dir, "base/16384/16501", testHeapPage(testHeapTuple(2, []byte{7, 0, 0, 0, 70, 0, 0, 0})))
+	testWriteFile(t, dir, "base/16384/16503", testHeapPage(testHeapTuple(1, []byte{9, 0, 0, 0})))
+
+	// No pg_class entry left for 16502: a short varlena 'hello', then an int4
+	guessed := []byte{6<<1 | 1, 'h', 'e', 'l', 'l', 'o', 0, 0, 42, 0, 0, 0}
+	testWriteFile(t, dir, "base/16384/16502", testHeapPage(testHeapTuple(2, guessed)))
+	testWriteFile(t, dir, "base/16384/16502_fsm", make([]byte, PageSize))
+
+	orphans, err := ScanOrphans(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 3 {
+		t.Fatalf("got %d orphans, want 3: %+v", len(orphans), orphans)
+	}
+
+	gone := orphans[0]
+	if gone.Filenode != 16501 || gone.Path != "base/16384/16501" || gone.Size != PageSize || gone.Schema != nil || gone.Guessed || gone.Table == nil {
+		t.Fatalf("orphan = %+v", gone)
+	}
+	if gone.Table.Name != "gone" || len(gone.Table.Columns) != 2 || gone.Table.Columns[1].Name != "note" {
+		t.Errorf("table = %+v", gone.Table)
+	}
+	if want := []Row{testRow("id", int32(7), "note", int32(70))}; !reflect.DeepEqual(gone.Table.Rows, want) {
+		t.Errorf("rows = %+v, want %+v", gone.Table.Rows, want)
+	}
+
+	unknown := orphans[1]
+	if unknown.Filenode != 16502 || unknown.Schema == nil || !unknown.Guessed || !reflect.DeepEqual(unknown.Forks, []string{"fsm"}) {
+		t.Fatalf("orphan = %+v", unknown)
+	}
+	if want := []Row{testRow("col1", "hello", "col2", int32(42))}; !reflect.DeepEqual(unknown.Table.Rows, want) {
+		t.Errorf("guessed rows = %+v, want %+v", unknown.Table.Rows, want)
+	}
+
+	ctas := orphans[2]
+	if ctas.Table == nil || ctas.Table.Name != "ctas" || !reflect.DeepEqual(ctas.Table.Rows, []Row{testRow("v", int32(9))}) {
+		t.Errorf("aborted CREATE TABLE AS = %+v", ctas.Table)
+	}
+
+	// Filtering on a table name leaves out the orphan with no name
+	if orphans, _ := ScanOrphans(dir, &Options{TableFilter: "gone", SkipSystemTables: true}); len(orphans) != 1 {
+		t.Errorf("filtered orphans = %+v", orphans)
+	}
+}
@@ -6,6 +6,14 @@ const (
 	itemIDSize = 4
 )
 
+// Line pointer states (itemid.h)
+const (
+	lpUnused   = 0
+	lpNormal   = 1
+	lpRedirect = 2 // points to another line pointer, after HOT pruning
+	lpDead     = 3
+)
+
 // PageHeader represents PostgreSQL page header
 type PageHeader struct {
 	Lower, Upper uint16
@@ -22,6 +30,7 @@ type ItemID struct {
 type TupleEntry struct {
 	Tuple      *HeapTupleData
 	PageOffset int
+	Item       uint16 // line pointer number on the page, from 1
 }
 
 // ParsePage extracts all visible tuples from a page
@@ -36,8 +45,8 @@ func ParsePage(data []byte) []TupleEntry {
 	}
 
 	var entries []TupleEntry
-	for _, item := range parseItems(data, h) {
-		if item.Flags != 1 || item.Length <= 0 {
+	for i, item := range parseItems(data, h) {
+		if item.Flags != lpNormal || item.Length <= 0 {
 			continue
 		}
 		if item.Offset < int(h.Upper) || item.Offset+item.Length > PageSize {
@@ -46,12 +55,32 @@ func ParsePage(data []byte) []TupleEntry {
 
 		tuple := ParseHeapTuple(data[item.Offset : item.Offset+item.Length])
 		if tuple != nil {
-			entries = append(entries, TupleEntry{Tuple: tuple})
+			entries = append(entries, TupleEntry{Tuple: tuple, Item: uint16(i + 1)})
 		}
 	}
 	return entries
 }
 
+// PageRedirects returns the redirect line pointers of a page, by line
+// pointer number. HOT pruning turns the root of an update chain into one,
+// pointing to the oldest version left.
+func PageRedirects(data []byte) map[uint16]uint16 {
+	if len(data) < PageSize {
+		return nil
+	}
+	h := parseHeader(data)
+	if !validHeader(h) {
+		return nil
+	}
+	redirects := make(map[uint16]uint16)
+	for i, item := range parseItems(data, h) {
+		if item.Flags == lpRedirect {
+			redirects[uint16(i+1)] = uint16(item.Offset)
+		}
+	}
+	return redirects
+}
+
 func parseHeader(data []byte) *PageHeader {
 	psv := u16(data, 18)
 	return &PageHeader{
@@ -0,0 +1,203 @@
+package pgdump
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// rangePages is how many pages of a table a worker decodes at a time, so a
+// large table is spread over the pool instead of tying up one worker
+const rangePages = 1024
+
+// decodeJob is a range of pages of a table, decoded by a worker
+type decodeJob struct {
+	table  int
+	rows   *RowIterator
+	last   bool      // the table's last range
+	closer io.Closer // the table's files, on its first range
+	result []Row
+	err    error
+	done   chan struct{}
+}
+
+// pipeline decodes tables on a pool of workers and hands them back in
+// order. Only a few ranges per worker are decoded ahead of the reader, so
+// memory stays bounded however large the tables are.
+type pipeline struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	ordered chan *decodeJob
+	wg      sync.WaitGroup
+}
+
+// startPipeline decodes tables 0 to n-1 with workers goroutines. open splits
+// a table into page ranges and returns the files to close once it is read.
+func startPipeline(ctx context.Context, n, workers int, open func(i int) ([]*RowIterator, io.Closer)) *pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &pipeline{ctx: ctx, cancel: cancel, ordered: make(chan *decodeJob, 2*workers)}
+	jobs := make(chan *decodeJob)
+
+	p.wg.Add(workers + 1)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range jobs {
+				job.result = job.rows.all()
+				job.err = job.rows.Err()
+				close(job.done)
+			}
+		}()
+	}
+	go func() {
+		defer p.wg.Done()
+		defer close(jobs)
+		defer close(p.ordered)
+		for i := 0; i < n; i++ {
+			parts, closer := open(i)
+			for k, part := range parts {
+				job := &decodeJob{table: i, rows: part, last: k == len(parts)-1, done: make(chan struct{})}
+				if k == 0 {
+					job.closer = closer
+				}
+				select {
+				case p.ordered <- job:
+				case <-ctx.Done():
+					if k == 0 && closer != nil {
+						closer.Close()
+					}
+					return
+				}
+				jobs <- job
+			}
+		}
+	}()
+	return p
+}
+
+// receive returns the next range in table order
+func (p *pipeline) receive() (*decodeJob, error) {
+	job, ok := <-p.ordered
+	if !ok {
+		if err := p.ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	return job, nil
+}
+
+// wait waits for a range to be decoded
+func (p *pipeline) wait(job *decodeJob) error {
+	select {
+	case <-job.done:
+		return job.err
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// table returns an iterator over the next table's rows. Tables must be
+// taken in order, and each iterator closed before the next is taken.
+func (p *pipeline) table() *RowIterator {
+	job, err := p.receive()
+	if err != nil {
+		return &RowIterator{err: err}
+	}
+
+	// Decoding again after Reset goes through the whole relation
+	first := job.rows
+	rows := first.clone(first.decoder, first.encoder)
+	rows.ctx = p.ctx
+
+	t := &pipelineTable{p: p, job: job, closer: job.closer}
+	rows.feed = t.next
+	rows.closer = t
+	return rows
+}
+
+// stop cancels the pipeline and closes the files of tables not taken
+func (p *pipeline) stop() {
+	p.cancel()
+	for job := range p.ordered {
+		if job.closer != nil {
+			job.closer.Close()
+		}
+	}
+	p.wg.Wait()
+}
+
+// pipelineTable feeds a table's rows from its decoded ranges
+type pipelineTable struct {
+	p      *pipeline
+	job    *decodeJob // next range, nil once the last one is returned
+	closer io.Closer
+}
+
+func (t *pipelineTable) next() ([]Row, error) {
+	job := t.job
+	if job == nil {
+		return nil, io.EOF
+	}
+	if err := t.p.wait(job); err != nil {
+		return nil, err
+	}
+	if job.last {
+		t.job = nil
+		return job.result, nil
+	}
+	next, err := t.p.receive()
+	if err != nil {
+		return nil, err
+	}
+	t.job = next
+	return job.result, nil
+}
+
+// Close skips the ranges the reader did not consume, then closes the files
+func (t *pipelineTable) Close() error {
+	var err error
+	for err == nil {
+		_, err = t.next()
+	}
+	if t.closer != nil {
+		if cerr := t.closer.Close(); cerr != nil && err == io.EOF {
+			err = cerr
+		}
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// parallel calls fn for 0 to n-1 on up to workers goroutines, and stops
+// handing out work once ctx is done
+func parallel(ctx context.Context, n, workers int, fn func(i int)) error {
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < n && err == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+	return err
+}
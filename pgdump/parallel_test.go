@@ -0,0 +1,156 @@
+package pgdump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testParallelDataDir lays out a data directory with a few small tables
+// and one spanning several page ranges
+func testParallelDataDir(t *testing.T) string {
+	dir := t.TempDir()
+
+	control := make([]byte, 300)
+	putU32(control, 12, 202307071)
+	testWriteFile(t, dir, "PG_VERSION", []byte("16\n"))
+	testWriteFile(t, dir, "global/pg_control", control)
+	testWriteFile(t, dir, "global/1262", testHeapPage(testDatabaseRow(16384, "app", DefaultTablespace)))
+
+	// pg_class's own oid column lets ParsePGAttribute detect the layout
+	classes, attrs := [][]byte{}, [][]byte{testAttrRow(PGClass, "oid", OidOid, 4, 1, nil)}
+	for i, name := range []string{"a", "b", "big", "c", "d"} {
+		oid := uint32(16500 + i)
+		classes = append(classes, testClassRow(oid, name, 2200, oid, 'r'))
+		attrs = append(attrs, testAttrRow(oid, "id", OidInt4, 4, 1, nil))
+
+		pages := 1
+		if name == "big" {
+			pages = 2*rangePages + 10
+		}
+		var data []byte
+		for p := 0; p < pages; p++ {
+			data = append(data, testHeapPage(testInt4Rows(uint32(p*2), uint32(p*2+1))...)...)
+		}
+		testWriteFile(t, dir, "base/16384/"+uitoa(oid), data)
+	}
+	testWriteFile(t, dir, "base/16384/1259", testHeapPage(classes...))
+	testWriteFile(t, dir, "base/16384/1249", testHeapPage(attrs...))
+	return dir
+}
+
+func TestDumpDataDirWorkers(t *testing.T) {
+	dir := testParallelDataDir(t)
+
+	want, err := DumpDataDir(dir, nil)
+	if err != nil {
+		t.Fatalf("DumpDataDir failed: %v", err)
+	}
+	got, err := DumpDataDirContext(context.Background(), dir, &Options{SkipSystemTables: true, Workers: 4})
+	if err != nil {
+		t.Fatalf("DumpDataDirContext failed: %v", err)
+	}
+	// pg_class order is not stable from one parse to the next
+	byName := func(r *DumpResult) map[string]TableDump {
+		tables := make(map[string]TableDump)
+		for _, tbl := range r.Databases[0].Tables {
+			tables[tbl.Name] = tbl
+		}
+		return tables
+	}
+	if !reflect.DeepEqual(byName(got), byName(want)) {
+		t.Error("parallel dump differs from the sequential one")
+	}
+
+	for _, tbl := range got.Databases[0].Tables {
+		wantRows := 2
+		if tbl.Name == "big" {
+			wantRows = 2 * (2*rangePages + 10)
+		}
+		if tbl.RowCount != wantRows || len(tbl.Rows) != wantRows {
+			t.Errorf("%s: RowCount %d, %d rows, want %d", tbl.Name, tbl.RowCount, len(tbl.Rows), wantRows)
+		}
+		if id, _ := tbl.Rows[wantRows-1].Get("id"); tbl.Name == "big" && id != int32(wantRows-1) {
+			t.Errorf("big: last row %v, ranges out of order", tbl.Rows[wantRows-1])
+		}
+	}
+}
+
+func TestStreamDataDirWorkersSystemColumns(t *testing.T) {
+	dir := testParallelDataDir(t)
+
+	// The table writer reads each table twice, the second time after Reset
+	grid := func(workers int) []string {
+		var out bytes.Buffer
+		opts := &Options{SkipSystemTables: true, SystemColumns: true, Workers: workers}
+		if err := StreamDataDir(dir, opts, NewTableWriter(&out)); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(out.String(), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+	want := grid(1)
+	if got := grid(4); !reflect.DeepEqual(got, want) {
+		t.Errorf("parallel table output differs from the sequential one:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestDumpDataDirCancelled(t *testing.T) {
+	dir := testParallelDataDir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{1, 4} {
+		_, err := DumpDataDirContext(ctx, dir, &Options{SkipSystemTables: true, Workers: workers})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("workers %d: err = %v, want context.Canceled", workers, err)
+		}
+	}
+	if _, err := VerifyDataDirChecksumsContext(ctx, dir, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyDataDirChecksumsContext: err = %v, want context.Canceled", err)
+	}
+}
+
+// cancelWriter cancels the dump while the first table is being written
+type cancelWriter struct {
+	resultWriter
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	w.cancel()
+	return w.resultWriter.WriteTable(db, t, rows)
+}
+
+func TestStreamDataDirCancelMidway(t *testing.T) {
+	dir := testParallelDataDir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelWriter{resultWriter{&DumpResult{}}, cancel}
+	err := StreamDataDirContext(ctx, dir, &Options{SkipSystemTables: true, Workers: 4}, w)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestVerifyDataDirChecksumsWorkers(t *testing.T) {
+	dir := testParallelDataDir(t)
+	want, err := VerifyDataDirChecksums(dir)
+	if err != nil {
+		t.Fatalf("VerifyDataDirChecksums failed: %v", err)
+	}
+	got, err := VerifyDataDirChecksumsContext(context.Background(), dir, 4)
+	if err != nil {
+		t.Fatalf("VerifyDataDirChecksumsContext failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parallel result %+v, want %+v", got, want)
+	}
+	if got.TotalFiles != 7 {
+		t.Errorf("TotalFiles = %d, want 7", got.TotalFiles)
+	}
+}
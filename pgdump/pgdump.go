@@ -5,6 +5,14 @@
 //   - 1262: pg_database (global/1262)
 //   - 1259: pg_class (base/<db_oid>/1259)
 //   - 1249: pg_attribute (base/<db_oid>/1249)
+//   - 1247: pg_type (base/<db_oid>/1247)
+//   - 1255: pg_proc (base/<db_oid>/1255)
+//   - 2615: pg_namespace (base/<db_oid>/<filenode from pg_class>)
+//   - 3501: pg_enum (base/<db_oid>/<filenode from pg_class>)
+//   - 2604, 2606, 2610: pg_attrdef, pg_constraint, pg_index (likewise)
+//
+// Mapped catalogs are resolved through pg_filenode.map first, so a
+// VACUUM FULL on pg_class, pg_attribute or pg_type does not hide the schema.
 //
 // # Quick Start (Auto-detect)
 //
@@ -37,12 +45,12 @@
 package pgdump
 
 import (
-	"os"
-	"path/filepath"
-	"strconv"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"strings"
-
-	"golang.org/x/text/encoding"
+	"time"
 )
 
 // Version is set at build time via ldflags
@@ -52,10 +60,40 @@ var Version = "dev"
 type Options struct {
 	DatabaseFilter   string // Filter by database name
 	TableFilter      string // Filter tables containing string
+	SchemaFilter     string // Only dump tables in this schema
+	ExcludeSchema    string // Skip tables in this schema
 	ListOnly         bool   // Schema only, no data
-	SkipSystemTables bool   // Skip pg_* tables (default: true)
+	SkipSystemTables bool   // Skip pg_* tables and system schemas (default: true)
 	PostgresVersion  int    // Hint PG version (0 = auto)
 	OutputEncoding   string // Output encoding (default: "UTF-8")
+
+	// TimeZone is the zone timestamptz values are shown in, like the
+	// server's TimeZone setting (default: UTC)
+	TimeZone *time.Location
+
+	// AsOfXID and AsOfTime dump tables as they were at the start of a
+	// transaction, or at a commit time (needs pg_commit_ts): later inserts
+	// are left out and later deletes not yet vacuumed are brought back.
+	// See Snapshot.
+	AsOfXID  uint32
+	AsOfTime time.Time
+
+	// IncludeDeleted adds the rows deleted but not vacuumed yet to each
+	// table's DeletedRows, read in a second pass over its pages
+	IncludeDeleted bool
+
+	// SystemColumns adds ctid, xmin, xmax, cmin, cmax and the decoded
+	// infomask flags in front of the columns of every table, pinning each
+	// row to its tuple (see TupleInfo)
+	SystemColumns bool
+
+	// Workers decode tables, and page ranges of large tables, concurrently.
+	// 0 or 1 decodes one table at a time.
+	Workers int
+
+	// TablespaceMap relocates tablespaces by OID, for copies where the
+	// pg_tblspc symlinks no longer resolve (see Tablespaces)
+	TablespaceMap map[uint32]string
 }
 
 // DumpResult contains complete dump
@@ -68,29 +106,72 @@ type DatabaseDump struct {
 	OID    uint32      `json:"oid"`
 	Name   string      `json:"name"`
 	Tables []TableDump `json:"tables"`
+
+	// Sequences referenced by column defaults
+	Sequences []SequenceData `json:"sequences,omitempty"`
 }
 
 // TableDump contains single table dump
 type TableDump struct {
-	OID      uint32                   `json:"oid"`
-	Name     string                   `json:"name"`
-	Filenode uint32                   `json:"filenode"`
-	Kind     string                   `json:"kind"`
-	Columns  []ColumnInfo             `json:"columns,omitempty"`
-	Rows     []map[string]interface{} `json:"rows,omitempty"`
-	RowCount int                      `json:"row_count"`
+	OID      uint32       `json:"oid"`
+	Schema   string       `json:"schema,omitempty"`
+	Name     string       `json:"name"`
+	Filenode uint32       `json:"filenode"`
+	Kind     string       `json:"kind"`
+	Columns  []ColumnInfo `json:"columns,omitempty"`
+	Rows     []Row        `json:"rows,omitempty"`
+	RowCount int          `json:"row_count"`
+
+	// DeletedRows are the rows deleted but not vacuumed, with
+	// Options.IncludeDeleted
+	DeletedRows []DeletedRow `json:"deleted_rows,omitempty"`
+
+	Constraints []ConstraintDef `json:"constraints,omitempty"`
+	Indexes     []IndexDef      `json:"indexes,omitempty"`
+	Skipped     []string        `json:"skipped,omitempty"` // defaults, constraints and indexes that could not be rendered
+
+	// Dropped marks a table a DROP TABLE removed, rebuilt from the dead
+	// catalog tuples it left by ScanDroppedTables
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// QualifiedName returns schema.name, or just the name if the schema is unknown
+func (t *TableDump) QualifiedName() string {
+	return qualifiedName(t.Schema, t.Name)
 }
 
 // ColumnInfo describes a column
 type ColumnInfo struct {
-	Name  string `json:"name"`
-	Type  string `json:"type"`
-	TypID int    `json:"typid"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	TypID   int    `json:"typid"`
+	NotNull bool   `json:"not_null,omitempty"`
+	Default string `json:"default,omitempty"` // default expression as SQL
+	System  bool   `json:"system,omitempty"`  // a system column, see Options.SystemColumns
+}
+
+// ConstraintDef is a table constraint as pg_get_constraintdef renders it
+type ConstraintDef struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"` // contype: p, u, f, c or x
+	Definition string `json:"definition"`
+}
+
+// IndexDef is an index not backing a constraint, as pg_get_indexdef renders it
+type IndexDef struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
 }
 
 // FileReader reads table data by filenode
 type FileReader func(filenode uint32) ([]byte, error)
 
+// relationReader reads table data by tablespace (0 = database default) and filenode
+type relationReader func(spcOID, filenode uint32) ([]byte, error)
+
+// relationOpener opens table data by tablespace and filenode for streaming
+type relationOpener func(spcOID, filenode uint32) (io.ReaderAt, error)
+
 // DumpAll auto-detects all PostgreSQL data directories and dumps them.
 // Returns a slice of results, one per data directory found.
 func DumpAll(opts *Options) ([]*DumpResult, error) {
@@ -110,15 +191,49 @@ func DumpAll(opts *Options) ([]*DumpResult, error) {
 
 // DumpDataDir dumps all databases from a data directory
 func DumpDataDir(dataDir string, opts *Options) (*DumpResult, error) {
+	return DumpDataDirContext(context.Background(), dataDir, opts)
+}
+
+// DumpDataDirContext is DumpDataDir stopping early with ctx's error once
+// ctx is done
+func DumpDataDirContext(ctx context.Context, dataDir string, opts *Options) (*DumpResult, error) {
+	result := &DumpResult{}
+	if err := StreamDataDirContext(ctx, dataDir, opts, &resultWriter{result: result}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StreamDataDir dumps all databases from a data directory like DumpDataDir,
+// but hands each table to w with an iterator over its rows instead of
+// collecting them, so memory use does not grow with the size of the tables.
+func StreamDataDir(dataDir string, opts *Options, w DumpWriter) error {
+	return StreamDataDirContext(context.Background(), dataDir, opts, w)
+}
+
+// StreamDataDirContext is StreamDataDir stopping early with ctx's error once
+// ctx is done. With opts.Workers above 1, tables are decoded ahead of w a
+// few page ranges at a time.
+func StreamDataDirContext(ctx context.Context, dataDir string, opts *Options, w DumpWriter) error {
 	opts = withDefaults(opts)
 
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	local := LocalReader(dataDir)
+	segSize := relationSegmentSize(local)
+	spaces := loadLocalTablespaces(dataDir, opts.TablespaceMap)
+	clog := NewCommitLog(local)
+	if !opts.AsOfTime.IsZero() && !hasCommitTimestamps(dataDir) {
+		return fmt.Errorf("as-of time needs commit timestamps, but %s has no pg_commit_ts segments (track_commit_timestamp)", dataDir)
 	}
 
-	result := &DumpResult{}
 	for _, db := range ParsePGDatabase(dbData) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if isTemplateDB(db.Name) {
 			continue
 		}
@@ -126,37 +241,69 @@ func DumpDataDir(dataDir string, opts *Options) (*DumpResult, error) {
 			continue
 		}
 
-		basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(db.OID), 10))
-		classData, _ := os.ReadFile(filepath.Join(basePath, "1259"))
-		attrData, _ := os.ReadFile(filepath.Join(basePath, "1249"))
+		dbDir := spaces.DatabaseDir(db)
+		classData, _ := ReadMappedCatalog(local, dbDir, PGClass)
+		attrData, _ := ReadMappedCatalog(local, dbDir, PGAttribute)
+		typeData, _ := ReadMappedCatalog(local, dbDir, PGType)
+		procData, _ := ReadMappedCatalog(local, dbDir, PGProc)
 
 		if len(classData) == 0 {
 			continue
 		}
 
-		reader := func(fn uint32) ([]byte, error) {
-			return os.ReadFile(filepath.Join(basePath, strconv.FormatUint(uint64(fn), 10)))
+		reader := func(spc, fn uint32) ([]byte, error) {
+			return ReadRelation(local, spaces.RelationPath(db, spc, fn), segSize)
+		}
+		open := func(spc, fn uint32) (io.ReaderAt, error) {
+			f, err := OpenRelation(localPath(dataDir, spaces.RelationPath(db, spc, fn)), segSize)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
 		}
 
-		if dump, _ := dumpDatabaseWithEncoding(classData, attrData, reader, opts, db.Encoding); dump != nil {
-			dump.OID, dump.Name = db.OID, db.Name
-			result.Databases = append(result.Databases, *dump)
+		catalogs := mappedCatalogs{class: classData, attr: attrData, typ: typeData, proc: procData}
+		dump := &DatabaseDump{OID: db.OID, Name: db.Name}
+		if err := streamDatabase(ctx, dump, catalogs, reader, open, clog, opts, db.Encoding, w); err != nil {
+			return err
 		}
 	}
-	return result, nil
+	return w.Close()
 }
 
 // DumpDatabaseFromFiles dumps using pre-read catalog files and custom reader.
 // Assumes UTF-8 encoding. Use DumpDataDir for automatic encoding detection.
+// Relations in other tablespaces are requested from reader by filenode too,
+// and pg_type and pg_proc are requested by their OIDs (1247, 1255).
 func DumpDatabaseFromFiles(classData, attrData []byte, reader FileReader, opts *Options) (*DatabaseDump, error) {
-	return dumpDatabaseWithEncoding(classData, attrData, reader, opts, PGEncUTF8)
+	var rr relationReader
+	catalogs := mappedCatalogs{class: classData, attr: attrData}
+	if reader != nil {
+		rr = func(_, fn uint32) ([]byte, error) { return reader(fn) }
+		catalogs.typ, _ = reader(PGType)
+		catalogs.proc, _ = reader(PGProc)
+	}
+	result := &DumpResult{}
+	if err := streamDatabase(context.Background(), &DatabaseDump{}, catalogs, rr, nil, nil, opts, PGEncUTF8, &resultWriter{result: result}); err != nil {
+		return nil, err
+	}
+	return &result.Databases[0], nil
+}
+
+// mappedCatalogs holds the heap files of a database's mapped catalogs
+type mappedCatalogs struct {
+	class, attr, typ, proc []byte
 }
 
-func dumpDatabaseWithEncoding(classData, attrData []byte, reader FileReader, opts *Options, enc int) (*DatabaseDump, error) {
+// streamDatabase describes the tables of a database and writes them to w
+// one at a time. Table data is opened through open, or read whole through
+// reader when open is nil. Row visibility is checked against clog, or
+// against hint bits alone if it is nil.
+func streamDatabase(c context.Context, db *DatabaseDump, catalogs mappedCatalogs, reader relationReader, open relationOpener, clog *CommitLog, opts *Options, enc int, w DumpWriter) error {
 	opts = withDefaults(opts)
 
-	tables := ParsePGClass(classData)
-	attrs := ParsePGAttribute(attrData, opts.PostgresVersion)
+	tables := ParsePGClass(catalogs.class)
+	attrs := ParsePGAttribute(catalogs.attr, opts.PostgresVersion)
 
 	// Build OID-to-filenode map for resolving TOAST table filenodes.
 	// After VACUUM FULL, the OID (reltoastrelid) stays the same but the
@@ -166,94 +313,236 @@ func dumpDatabaseWithEncoding(classData, attrData []byte, reader FileReader, opt
 		oidToFilenode[ti.OID] = fn
 	}
 
+	// pg_namespace, pg_enum and the constraint catalogs are not mapped
+	// catalogs, so their filenodes come from pg_class
+	var enumData []byte
+	schemaData := map[uint32][]byte{PGProc: catalogs.proc}
+	if reader != nil {
+		if nspData, err := reader(0, catalogFilenode(oidToFilenode, PGNamespace)); err == nil {
+			resolveSchemas(tables, ParsePGNamespace(nspData))
+		}
+		enumData, _ = reader(0, catalogFilenode(oidToFilenode, PGEnum))
+		for _, oid := range schemaCatalogs {
+			schemaData[oid], _ = reader(0, catalogFilenode(oidToFilenode, oid))
+		}
+		if open == nil {
+			open = func(spc, fn uint32) (io.ReaderAt, error) {
+				data, err := reader(spc, fn)
+				return bytes.NewReader(data), err
+			}
+		}
+	}
+	types := NewTypeCatalog(catalogs.typ, enumData, attrs)
+
 	ctx := &dumpContext{
-		reader: reader,
-		opts:   opts,
-		toastReader: &TOASTReader{
-			chunks: make(map[uint32][]TOASTChunk),
-		},
+		context:       c,
+		reader:        reader,
+		open:          open,
+		opts:          opts,
 		oidToFilenode: oidToFilenode,
+		types:         types,
+		schema:        newRelationSchema(tables, attrs, types, schemaData, opts.PostgresVersion),
+		clog:          clog,
 		encoding:      enc,
-		outEncoder:    OutputEncoder(opts.OutputEncoding),
 	}
 
-	result := &DatabaseDump{}
+	var infos []TableInfo
 	for filenode, info := range tables {
 		if info.Kind != "r" && info.Kind != "" {
 			continue
 		}
-		if opts.SkipSystemTables && strings.HasPrefix(info.Name, "pg_") {
+		if opts.SkipSystemTables && (strings.HasPrefix(info.Name, "pg_") || isSystemSchema(info.Schema)) {
+			continue
+		}
+		if opts.SchemaFilter != "" && info.Schema != opts.SchemaFilter {
+			continue
+		}
+		if opts.ExcludeSchema != "" && info.Schema == opts.ExcludeSchema {
 			continue
 		}
 		if opts.TableFilter != "" && !strings.Contains(strings.ToLower(info.Name), strings.ToLower(opts.TableFilter)) {
 			continue
 		}
 
-		table := dumpTable(filenode, info, attrs[info.OID], ctx)
-		result.Tables = append(result.Tables, table)
+		info.Filenode = filenode
+		infos = append(infos, info)
 	}
-	return result, nil
+	sortTables(infos)
+	for _, info := range infos {
+		db.Tables = append(db.Tables, describeTable(info, attrs[info.OID], ctx))
+	}
+	db.Sequences = ctx.schema.sequenceDumps(func(seq TableInfo) []byte {
+		if reader == nil {
+			return nil
+		}
+		data, _ := reader(seq.Tablespace, seq.Filenode)
+		return data
+	})
+
+	if err := w.BeginDatabase(db); err != nil {
+		return err
+	}
+
+	next := 0
+	table := func() *RowIterator {
+		info := infos[next]
+		next++
+		return openRows(info, attrs[info.OID], ctx)
+	}
+	if opts.Workers > 1 && !opts.ListOnly && open != nil {
+		p := startPipeline(c, len(infos), opts.Workers, func(i int) ([]*RowIterator, io.Closer) {
+			return openRowRanges(infos[i], attrs[infos[i].OID], ctx)
+		})
+		defer p.stop()
+		table = p.table
+	}
+
+	for i := range infos {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		t := &db.Tables[i]
+		if opts.IncludeDeleted {
+			if err := readDeleted(t, infos[i], attrs[infos[i].OID], ctx); err != nil {
+				return err
+			}
+		}
+		rows := table()
+		err := w.WriteTable(db, t, rows)
+		t.RowCount = rows.n
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.EndDatabase(db)
 }
 
 // dumpContext holds shared state for dumping tables within a database
 type dumpContext struct {
-	reader        FileReader
+	context       context.Context
+	reader        relationReader
+	open          relationOpener
 	opts          *Options
-	toastReader   *TOASTReader
 	oidToFilenode map[uint32]uint32
+	types         *TypeCatalog
+	schema        *relationSchema
+	clog          *CommitLog
 	encoding      int
-	outEncoder    *encoding.Encoder
 }
 
-func dumpTable(filenode uint32, info TableInfo, attrs []AttrInfo, ctx *dumpContext) TableDump {
+// describeTable returns a table's columns, defaults, constraints and
+// indexes, without its rows
+func describeTable(info TableInfo, attrs []AttrInfo, ctx *dumpContext) TableDump {
 	t := TableDump{
 		OID:      info.OID,
+		Schema:   info.Schema,
 		Name:     info.Name,
-		Filenode: filenode,
+		Filenode: info.Filenode,
 		Kind:     info.Kind,
 	}
 
 	for _, a := range attrs {
 		t.Columns = append(t.Columns, ColumnInfo{
-			Name:  a.Name,
-			Type:  TypeName(a.TypID),
-			TypID: a.TypID,
+			Name:    a.Name,
+			Type:    ctx.types.FormatType(a.TypID, a.TypMod, a.NDims),
+			TypID:   a.TypID,
+			NotNull: a.NotNull,
 		})
 	}
-
-	if ctx.opts.ListOnly || ctx.reader == nil {
-		return t
+	ctx.schema.describe(&t)
+	if ctx.opts.SystemColumns {
+		t.Columns = append(append([]ColumnInfo(nil), systemColumns...), t.Columns...)
 	}
+	return t
+}
 
-	data, err := ctx.reader(filenode)
-	if err != nil || len(data) == 0 {
-		return t
+// openRows opens an iterator over a table's rows, empty in ListOnly mode or
+// when the relation cannot be read
+func openRows(info TableInfo, attrs []AttrInfo, ctx *dumpContext) *RowIterator {
+	if ctx.opts.ListOnly || ctx.open == nil {
+		return rowSlice(nil)
 	}
-
-	cols := make([]Column, len(attrs))
-	for i, a := range attrs {
-		cols[i] = Column{Name: a.Name, TypID: a.TypID, Len: a.Len, Num: a.Num, Align: a.Align}
+	src, err := ctx.open(info.Tablespace, info.Filenode)
+	if err != nil {
+		return rowSlice(nil)
 	}
 
-	// Load TOAST table if this table has one and a reader is available
+	// Load the table's own TOAST table, released when the rows are closed,
+	// so TOAST chunks never outlive the table they belong to
 	var tableToastReader *TOASTReader
-	if info.ToastRelID != 0 && ctx.toastReader != nil {
-		if _, loaded := ctx.toastReader.chunks[info.ToastRelID]; !loaded {
-			toastFilenode := info.ToastRelID
-			if fn, ok := ctx.oidToFilenode[info.ToastRelID]; ok {
-				toastFilenode = fn
-			}
-			if toastData, err := ctx.reader(toastFilenode); err == nil && len(toastData) > 0 {
-				ctx.toastReader.LoadTOASTTable(info.ToastRelID, toastData)
-			}
+	if info.ToastRelID != 0 {
+		toastFilenode := info.ToastRelID
+		if fn, ok := ctx.oidToFilenode[info.ToastRelID]; ok {
+			toastFilenode = fn
+		}
+		// TOAST tables always share their parent's tablespace
+		if toastData, err := ctx.reader(info.Tablespace, toastFilenode); err == nil && len(toastData) > 0 {
+			tableToastReader = NewTOASTReader()
+			tableToastReader.LoadTOASTTable(info.ToastRelID, toastData)
 		}
-		tableToastReader = ctx.toastReader
 	}
 
-	decoder := pgEncodingToDecoder(ctx.encoding)
-	t.Rows = readRowsConverted(data, cols, tableToastReader, decoder, ctx.outEncoder)
-	t.RowCount = len(t.Rows)
-	return t
+	dec := &rowDecoder{toast: tableToastReader, types: ctx.types, loc: ctx.opts.TimeZone, clog: ctx.clog}
+	if ctx.opts.AsOfXID != 0 || !ctx.opts.AsOfTime.IsZero() {
+		dec.asOf = &Snapshot{XID: ctx.opts.AsOfXID, Time: ctx.opts.AsOfTime}
+	}
+	rows := newRowIterator(src, attrColumns(attrs), dec, pgEncodingToDecoder(ctx.encoding), OutputEncoder(ctx.opts.OutputEncoding))
+	files, _ := src.(io.Closer)
+	rows.closer = &tableFiles{files: files, toast: tableToastReader}
+	rows.ctx = ctx.context
+	rows.system = ctx.opts.SystemColumns
+	return rows
+}
+
+// tableFiles closes a table's relation files and releases its TOAST chunks
+type tableFiles struct {
+	files io.Closer
+	toast *TOASTReader
+}
+
+func (f *tableFiles) Close() error {
+	if f.toast != nil {
+		f.toast.release()
+	}
+	if f.files == nil {
+		return nil
+	}
+	return f.files.Close()
+}
+
+// readDeleted sets the deleted rows of t, before its live rows are written
+func readDeleted(t *TableDump, info TableInfo, attrs []AttrInfo, ctx *dumpContext) error {
+	rows := openRows(info, attrs, ctx)
+	deleted, err := rows.deletedRows()
+	if cerr := rows.Close(); err == nil {
+		err = cerr
+	}
+	t.DeletedRows = deleted
+	return err
+}
+
+// openRowRanges splits openRows into ranges of rangePages pages that can be
+// decoded concurrently, each with its own string conversion. The relation's
+// files are returned separately, to be closed once all ranges are read.
+func openRowRanges(info TableInfo, attrs []AttrInfo, ctx *dumpContext) ([]*RowIterator, io.Closer) {
+	rows := openRows(info, attrs, ctx)
+	closer := rows.closer
+	rows.closer = nil
+
+	sized, ok := rows.src.(interface{ Size() int64 })
+	if !ok || sized.Size() <= rangePages*PageSize {
+		return []*RowIterator{rows}, closer
+	}
+	var parts []*RowIterator
+	for start := int64(0); start < sized.Size(); start += rangePages * PageSize {
+		part := rows.clone(pgEncodingToDecoder(ctx.encoding), OutputEncoder(ctx.opts.OutputEncoding))
+		part.start, part.off, part.end = start, start, start+rangePages*PageSize
+		parts = append(parts, part)
+	}
+	return parts, closer
 }
 
 func withDefaults(opts *Options) *Options {
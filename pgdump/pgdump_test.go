@@ -1,9 +1,11 @@
 package pgdump
 
 import (
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // Test data paths - set via environment or use local testdata
@@ -211,9 +213,9 @@ func TestDumpDataDir(t *testing.T) {
 		if tbl.RowCount > 0 {
 			for _, row := range tbl.Rows {
 				// Look for any JSONB column (value, col_jsonb, etc.)
-				for colName, val := range row {
+				for i, val := range row.Values {
 					if _, isMap := val.(map[string]interface{}); isMap {
-						t.Logf("Found JSONB in table %s, column %s", tbl.Name, colName)
+						t.Logf("Found JSONB in table %s, column %s", tbl.Name, row.Columns[i])
 						return // Success - found at least one JSONB value
 					}
 				}
@@ -806,6 +808,14 @@ func TestDecodeJSON(t *testing.T) {
 	if m["key"] != "value" {
 		t.Errorf("DecodeType(json)[\"key\"] = %v, want 'value'", m["key"])
 	}
+
+	// Numbers keep all their digits; text that is not one JSON value stays text
+	if got := DecodeType([]byte(`[12345678901234567890.5]`), OidJSON); copyText(got, OidJSON) != "[12345678901234567890.5]" {
+		t.Errorf("DecodeType(json number) = %v", got)
+	}
+	if got := DecodeType([]byte(`{} {}`), OidJSON); got != "{} {}" {
+		t.Errorf("DecodeType(two JSON values) = %#v", got)
+	}
 }
 
 func TestDecodeTsvector(t *testing.T) {
@@ -993,6 +1003,92 @@ func TestDecodeNumeric(t *testing.T) {
 	}
 }
 
+// testNumeric lays out an on-disk numeric from its header words and digits
+func testNumeric(words ...uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		putU16(data, 2*i, w)
+	}
+	return data
+}
+
+func TestDecodeNumericExact(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		// Short format: sign, dscale and weight in the header
+		{testNumeric(0x8000|2<<7|3, 12, 3456, 7890, 1234, 5600), "12345678901234.56"},
+		{testNumeric(0x8000|0x2000|3<<7|0x40|63, 10), "-0.001"},
+		{testNumeric(0x8000|8<<7|0x40|62, 1), "0.00000001"},
+		{testNumeric(0x8000|1, 10), "100000"},
+		{testNumeric(0x8000 | 2<<7), "0.00"},
+		// Long format: sign and dscale, then the weight
+		{testNumeric(0x4000|1, 0, 1, 5000), "-1.5"},
+		{testNumeric(0xC000), "NaN"},
+		{testNumeric(0xD000), "Infinity"},
+		{testNumeric(0xF000), "-Infinity"},
+	}
+	for _, tt := range tests {
+		if got := DecodeNumeric(tt.data); got != tt.want {
+			t.Errorf("DecodeNumeric(%x) = %v, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeTemporal(t *testing.T) {
+	i32 := func(v int32) []byte {
+		b := make([]byte, 4)
+		putU32(b, 0, uint32(v))
+		return b
+	}
+	i64 := func(v int64) []byte {
+		b := make([]byte, 8)
+		putU64(b, 0, uint64(v))
+		return b
+	}
+	interval := func(us int64, days, months int32) []byte {
+		return append(append(i64(us), i32(days)...), i32(months)...)
+	}
+	ts := time.Date(2024, 2, 29, 13, 45, 30, 123456000, time.UTC).Sub(pgEpoch).Microseconds()
+	bcDays := int32((time.Date(-43, 3, 15, 0, 0, 0, 0, time.UTC).Unix() - pgEpoch.Unix()) / 86400)
+
+	tests := []struct {
+		data []byte
+		oid  int
+		loc  *time.Location
+		want string
+	}{
+		{i64(ts), OidTimestamp, nil, "2024-02-29 13:45:30.123456"},
+		{i64(ts), OidTimestampTZ, nil, "2024-02-29 13:45:30.123456+00"},
+		{i64(ts - 3456), OidTimestampTZ, time.FixedZone("", 5*3600+1800), "2024-02-29 19:15:30.12+05:30"},
+		{i64(int64(bcDays)*86400e6 + 12*3600e6), OidTimestamp, nil, "0044-03-15 12:00:00 BC"},
+		{i64(math.MaxInt64), OidTimestampTZ, nil, "infinity"},
+		{i64(math.MinInt64), OidTimestamp, nil, "-infinity"},
+		{i32(bcDays), OidDate, nil, "0044-03-15 BC"},
+		{i32(math.MaxInt32), OidDate, nil, "infinity"},
+		{i64(13*3600e6 + 45*60e6 + 30.5e6), OidTime, nil, "13:45:30.5"},
+		{append(i64(14*3600e6+30*60e6), i32(-7200)...), OidTimeTZ, nil, "14:30:00+02"},
+		{append(i64(0), i32(5*3600+1800)...), OidTimeTZ, nil, "00:00:00-05:30"},
+		{interval(4*3600e6+5*60e6+6e6, 3, 14), OidInterval, nil, "1 year 2 mons 3 days 04:05:06"},
+		{interval(0, 2, -1), OidInterval, nil, "-1 mons +2 days"},
+		{interval(-90.25e6, 1, 0), OidInterval, nil, "1 day -00:01:30.25"},
+		{interval(0, 0, 0), OidInterval, nil, "00:00:00"},
+		{interval(math.MaxInt64, math.MaxInt32, math.MaxInt32), OidInterval, nil, "infinity"},
+	}
+	for _, tt := range tests {
+		if got := decodeType(tt.data, tt.oid, &rowDecoder{loc: tt.loc}); got != tt.want {
+			t.Errorf("decode %s %x = %v, want %s", TypeName(tt.oid), tt.data, got, tt.want)
+		}
+	}
+
+	// Range bounds are quoted when they contain spaces
+	tsrange := append(append(i32(OidTsRange), i64(0)...), append(i64(1e6), 0x02)...)
+	if got, want := DecodeType(tsrange, OidTsRange), `["2000-01-01 00:00:00","2000-01-01 00:00:01")`; got != want {
+		t.Errorf("tsrange = %v, want %s", got, want)
+	}
+}
+
 func TestSafeString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1636,3 +1732,33 @@ func TestDecodeTupleWithNull(t *testing.T) {
 		t.Errorf("got[name] = %v, want nil", got["name"])
 	}
 }
+
+func TestFormatType(t *testing.T) {
+	tests := []struct {
+		oid, typmod, ndims int
+		want               string
+	}{
+		{OidVarchar, 255 + 4, 0, "varchar(255)"},
+		{OidVarchar, -1, 0, "varchar"},
+		{OidNumeric, 12<<16 | 2 + 4, 0, "numeric(12,2)"},
+		{OidNumeric, -1, 0, "numeric"},
+		{OidBpchar, 3 + 4, 0, "char(3)"},
+		{OidTimestamp, 3, 0, "timestamp(3)"},
+		{OidTimestampTZ, 0, 0, "timestamptz(0)"},
+		{OidBit, 8, 0, "bit(8)"},
+		{OidInterval, 0x7FFF0000 | 0xFFFF, 0, "interval"},
+		{OidInterval, 0x7FFF0000 | 3, 0, "interval(3)"},
+		{OidInterval, (intervalYear|intervalMonth)<<16 | 0xFFFF, 0, "interval year to month"},
+		{OidInterval, (intervalDay|intervalHour|intervalMinute|intervalSecond)<<16 | 3, 0, "interval day to second(3)"},
+		{OidInterval, intervalHour<<16 | 0xFFFF, 0, "interval hour"},
+		{OidInt4, -1, 0, "int4"},
+		{1015, 20 + 4, 1, "varchar(20)[]"},
+		{1007, -1, 2, "int4[][]"},
+		{1007, -1, 0, "int4[]"},
+	}
+	for _, tt := range tests {
+		if got := FormatType(tt.oid, tt.typmod, tt.ndims); got != tt.want {
+			t.Errorf("FormatType(%d, %d, %d) = %q, want %q", tt.oid, tt.typmod, tt.ndims, got, tt.want)
+		}
+	}
+}
@@ -138,6 +138,58 @@ func (rm *RelMapFile) GetOID(filenode uint32) uint32 {
 	return 0
 }
 
+// LocalReader returns a RemoteReader that serves paths relative to a local
+// data directory. Absolute paths (remapped tablespaces) are read as-is.
+func LocalReader(dataDir string) RemoteReader {
+	return func(path string) ([]byte, error) {
+		return os.ReadFile(localPath(dataDir, path))
+	}
+}
+
+// localPath resolves a slash-separated path relative to the data directory.
+// Absolute paths (tablespaces outside it) are kept.
+func localPath(dataDir, path string) string {
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dataDir, path)
+	}
+	return path
+}
+
+// ReadMappedCatalog reads a mapped system catalog from dir ("global" or
+// "base/<db_oid>"). The filenode is taken from dir/pg_filenode.map, so the
+// catalog is still found after VACUUM FULL or CLUSTER rewrote it; if the map
+// is missing or has no entry, the OID is used as the filenode.
+func ReadMappedCatalog(reader RemoteReader, dir string, oid uint32) ([]byte, error) {
+	return reader(fmt.Sprintf("%s/%d", dir, mappedFilenode(reader, dir, oid)))
+}
+
+func mappedFilenode(reader RemoteReader, dir string, oid uint32) uint32 {
+	if data, err := reader(dir + "/pg_filenode.map"); err == nil {
+		if rm, err := ParseRelMapFile(data); err == nil {
+			if fn := rm.GetFilenode(oid); fn != 0 {
+				return fn
+			}
+		}
+	}
+	return oid
+}
+
+// ReadGlobalCatalog reads a shared catalog (pg_database, pg_authid, ...) from a data directory
+func ReadGlobalCatalog(dataDir string, oid uint32) ([]byte, error) {
+	return ReadMappedCatalog(LocalReader(dataDir), "global", oid)
+}
+
+// ReadDatabaseCatalog reads a mapped per-database catalog (pg_class, pg_attribute, ...)
+// from the database's default tablespace
+func ReadDatabaseCatalog(dataDir string, db DatabaseInfo, oid uint32) ([]byte, error) {
+	return ReadMappedCatalog(LocalReader(dataDir), loadLocalTablespaces(dataDir, nil).DatabaseDir(db), oid)
+}
+
+func databaseDir(dbOID uint32) string {
+	return fmt.Sprintf("base/%d", dbOID)
+}
+
 // RelMapInfo contains information about all relmap files in a cluster
 type RelMapInfo struct {
 	Global    *RelMapFile   `json:"global"`
@@ -156,7 +208,7 @@ func ReadAllRelMaps(dataDir string) (*RelMapInfo, error) {
 	info.Global = globalMap
 
 	// Read database list
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return info, nil // Return with just global map
 	}
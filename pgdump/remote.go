@@ -13,10 +13,15 @@ type RemoteReader func(path string) ([]byte, error)
 type RemoteClient struct {
 	reader  RemoteReader
 	version int
+	segSize int
+	spaces  *Tablespaces
+	clog    *CommitLog
 	cache   struct {
 		databases []DatabaseInfo
 		tables    map[uint32]map[uint32]TableInfo
 		columns   map[uint32]map[uint32][]AttrInfo
+		types     map[uint32]*TypeCatalog
+		schemas   map[uint32]*relationSchema
 	}
 }
 
@@ -25,12 +30,30 @@ func NewRemoteClient(reader RemoteReader) *RemoteClient {
 	c := &RemoteClient{reader: reader}
 	c.cache.tables = make(map[uint32]map[uint32]TableInfo)
 	c.cache.columns = make(map[uint32]map[uint32][]AttrInfo)
+	c.cache.types = make(map[uint32]*TypeCatalog)
+	c.cache.schemas = make(map[uint32]*relationSchema)
 	if data, err := reader("PG_VERSION"); err == nil {
 		fmt.Sscanf(strings.TrimSpace(string(data)), "%d", &c.version)
 	}
+	c.segSize = relationSegmentSize(reader)
+	c.spaces = LoadTablespaces(reader, nil)
+	c.clog = NewCommitLog(reader)
 	return c
 }
 
+// MapTablespace reads tablespace spcOID from location instead of
+// pg_tblspc/<spcOID>, e.g. the target of the symlink on the server
+func (c *RemoteClient) MapTablespace(spcOID uint32, location string) {
+	if c.spaces.Remap == nil {
+		c.spaces.Remap = make(map[uint32]string)
+	}
+	c.spaces.Remap[spcOID] = location
+	c.cache.tables = make(map[uint32]map[uint32]TableInfo)
+	c.cache.columns = make(map[uint32]map[uint32][]AttrInfo)
+	c.cache.types = make(map[uint32]*TypeCatalog)
+	c.cache.schemas = make(map[uint32]*relationSchema)
+}
+
 // Result is the interface for all command results
 type Result interface {
 	String() string
@@ -82,7 +105,7 @@ func (t TablesResult) String() string {
 	b.WriteString("NAME                           KIND   OID\n")
 	for _, tbl := range t {
 		if tbl.Kind == "r" {
-			b.WriteString(fmt.Sprintf("%-30s table  %d\n", tbl.Name, tbl.OID))
+			b.WriteString(fmt.Sprintf("%-30s table  %d\n", tbl.QualifiedName(), tbl.OID))
 		}
 	}
 	return b.String()
@@ -95,34 +118,35 @@ func (c ColumnsResult) String() string {
 	b.WriteString("NAME                 TYPE\n")
 	for _, col := range c {
 		if col.Num > 0 {
-			b.WriteString(fmt.Sprintf("%-20s %s\n", col.Name, TypeName(col.TypID)))
+			b.WriteString(fmt.Sprintf("%-20s %s\n", col.Name, FormatType(col.TypID, col.TypMod, col.NDims)))
 		}
 	}
 	return b.String()
 }
 
-type QueryResult []map[string]any
+type QueryResult []Row
 
 func (q QueryResult) String() string {
 	if len(q) == 0 {
 		return "no data"
 	}
 	var b strings.Builder
-	var cols []string
-	for k := range q[0] {
-		cols = append(cols, k)
-	}
-	for _, col := range cols {
+	writeRows(&b, q)
+	return b.String()
+}
+
+// writeRows writes rows as fixed-width columns, in column order
+func writeRows(b *strings.Builder, rows []Row) {
+	for _, col := range rows[0].Columns {
 		b.WriteString(fmt.Sprintf("%-20s", truncate(col, 20)))
 	}
 	b.WriteString("\n")
-	for _, row := range q {
-		for _, col := range cols {
-			b.WriteString(fmt.Sprintf("%-20s", truncate(fmt.Sprintf("%v", row[col]), 20)))
+	for _, row := range rows {
+		for _, val := range row.Values {
+			b.WriteString(fmt.Sprintf("%-20s", truncate(fmt.Sprintf("%v", val), 20)))
 		}
 		b.WriteString("\n")
 	}
-	return b.String()
 }
 
 type DumpDatabaseResult struct{ *DatabaseDump }
@@ -245,7 +269,7 @@ func (c *RemoteClient) Control() *ControlFile {
 }
 
 func (c *RemoteClient) Credentials() []AuthInfo {
-	if data, err := c.reader(fmt.Sprintf("global/%d", PGAuthID)); err == nil {
+	if data, err := ReadMappedCatalog(c.reader, "global", PGAuthID); err == nil {
 		return ParsePGAuthID(data)
 	}
 	return nil
@@ -255,7 +279,7 @@ func (c *RemoteClient) Databases() []DatabaseInfo {
 	if c.cache.databases != nil {
 		return c.cache.databases
 	}
-	if data, err := c.reader(fmt.Sprintf("global/%d", PGDatabase)); err == nil {
+	if data, err := ReadMappedCatalog(c.reader, "global", PGDatabase); err == nil {
 		c.cache.databases = ParsePGDatabase(data)
 	}
 	return c.cache.databases
@@ -274,20 +298,45 @@ func (c *RemoteClient) loadCatalog(dbOID uint32) {
 	if _, ok := c.cache.tables[dbOID]; ok {
 		return
 	}
-	base := fmt.Sprintf("base/%d", dbOID)
-	classData, err := c.reader(fmt.Sprintf("%s/%d", base, PGClass))
+	base := c.spaces.DatabaseDir(c.dbInfo(dbOID))
+	classData, err := ReadMappedCatalog(c.reader, base, PGClass)
 	if err != nil {
 		c.cache.tables[dbOID] = make(map[uint32]TableInfo)
 		c.cache.columns[dbOID] = make(map[uint32][]AttrInfo)
 		return
 	}
-	c.cache.tables[dbOID] = ParsePGClass(classData)
-	attrData, err := c.reader(fmt.Sprintf("%s/%d", base, PGAttribute))
+	tables := ParsePGClass(classData)
+	c.cache.tables[dbOID] = tables
+	oidToFilenode := make(map[uint32]uint32)
+	for fn, t := range tables {
+		oidToFilenode[t.OID] = fn
+	}
+	if nspData, err := c.reader(fmt.Sprintf("%s/%d", base, catalogFilenode(oidToFilenode, PGNamespace))); err == nil {
+		resolveSchemas(tables, ParsePGNamespace(nspData))
+	}
+	attrData, err := ReadMappedCatalog(c.reader, base, PGAttribute)
 	if err != nil {
 		c.cache.columns[dbOID] = make(map[uint32][]AttrInfo)
 		return
 	}
-	c.cache.columns[dbOID] = ParsePGAttribute(attrData, c.version)
+	attrs := ParsePGAttribute(attrData, c.version)
+	c.cache.columns[dbOID] = attrs
+	if typeData, err := ReadMappedCatalog(c.reader, base, PGType); err == nil {
+		enumData, _ := c.reader(fmt.Sprintf("%s/%d", base, catalogFilenode(oidToFilenode, PGEnum)))
+		c.cache.types[dbOID] = NewTypeCatalog(typeData, enumData, attrs)
+	}
+	schemaData := make(map[uint32][]byte)
+	schemaData[PGProc], _ = ReadMappedCatalog(c.reader, base, PGProc)
+	for _, oid := range schemaCatalogs {
+		schemaData[oid], _ = c.reader(fmt.Sprintf("%s/%d", base, catalogFilenode(oidToFilenode, oid)))
+	}
+	c.cache.schemas[dbOID] = newRelationSchema(tables, attrs, c.cache.types[dbOID], schemaData, c.version)
+}
+
+// Types returns the user-defined types of a database (nil if pg_type is unreadable)
+func (c *RemoteClient) Types(dbOID uint32) *TypeCatalog {
+	c.loadCatalog(dbOID)
+	return c.cache.types[dbOID]
 }
 
 func (c *RemoteClient) Tables(dbOID uint32) []TableInfo {
@@ -296,6 +345,7 @@ func (c *RemoteClient) Tables(dbOID uint32) []TableInfo {
 	for _, t := range c.cache.tables[dbOID] {
 		tables = append(tables, t)
 	}
+	sortTables(tables)
 	return tables
 }
 
@@ -306,14 +356,27 @@ func (c *RemoteClient) TablesByName(dbName string) []TableInfo {
 	return nil
 }
 
+// Table finds a table by name, optionally qualified as "schema.table".
+// An unqualified name prefers the public schema when it is ambiguous.
 func (c *RemoteClient) Table(dbOID uint32, tableName string) *TableInfo {
 	c.loadCatalog(dbOID)
+	schema, name := "", tableName
+	if i := strings.IndexByte(tableName, '.'); i >= 0 {
+		schema, name = tableName[:i], tableName[i+1:]
+	}
+	var found *TableInfo
 	for _, t := range c.cache.tables[dbOID] {
-		if strings.EqualFold(t.Name, tableName) {
-			return &t
+		if !strings.EqualFold(t.Name, name) {
+			continue
+		}
+		if schema != "" && !strings.EqualFold(t.Schema, schema) {
+			continue
+		}
+		if found == nil || t.Schema == "public" {
+			found = &t
 		}
 	}
-	return nil
+	return found
 }
 
 func (c *RemoteClient) Columns(dbOID, tableOID uint32) []AttrInfo {
@@ -336,32 +399,37 @@ type QueryOptions struct {
 	Limit   int
 }
 
-func (c *RemoteClient) Query(dbOID uint32, table *TableInfo, opts *QueryOptions) []map[string]any {
+func (c *RemoteClient) Query(dbOID uint32, table *TableInfo, opts *QueryOptions) []Row {
 	if table == nil || table.Filenode == 0 {
 		return nil
 	}
-	data, err := c.reader(fmt.Sprintf("base/%d/%d", dbOID, table.Filenode))
+	data, err := ReadRelation(c.reader, c.spaces.RelationPath(c.dbInfo(dbOID), table.Tablespace, table.Filenode), c.segSize)
 	if err != nil {
 		return nil
 	}
 	attrs := c.Columns(dbOID, table.OID)
-	cols := make([]Column, len(attrs))
-	for i, a := range attrs {
-		cols[i] = Column{Name: a.Name, TypID: a.TypID, Len: a.Len, Num: a.Num, Align: a.Align}
-	}
-	rows := ReadRows(data, cols, true)
+	cols := attrColumns(attrs)
+	rows := readRowsConverted(data, cols, &rowDecoder{types: c.Types(dbOID), clog: c.clog}, nil, nil)
 	if opts != nil && len(opts.Columns) > 0 {
-		filtered := make([]map[string]any, 0, len(rows))
-		for _, row := range rows {
-			newRow := make(map[string]any)
-			for _, col := range opts.Columns {
-				if val, ok := row[col]; ok {
-					newRow[col] = val
+		// Requested columns in the requested order, skipping unknown ones
+		var names []string
+		var index []int
+		for _, name := range opts.Columns {
+			for i, col := range cols {
+				if col.Name == name {
+					names = append(names, name)
+					index = append(index, i)
+					break
 				}
 			}
-			filtered = append(filtered, newRow)
 		}
-		rows = filtered
+		for i, row := range rows {
+			values := make([]any, len(index))
+			for j, k := range index {
+				values[j] = row.Values[k]
+			}
+			rows[i] = Row{Columns: names, Values: values}
+		}
 	}
 	if opts != nil && opts.Limit > 0 && len(rows) > opts.Limit {
 		rows = rows[:opts.Limit]
@@ -369,7 +437,7 @@ func (c *RemoteClient) Query(dbOID uint32, table *TableInfo, opts *QueryOptions)
 	return rows
 }
 
-func (c *RemoteClient) QueryByName(dbName, tableName string, opts *QueryOptions) []map[string]any {
+func (c *RemoteClient) QueryByName(dbName, tableName string, opts *QueryOptions) []Row {
 	if db := c.Database(dbName); db != nil {
 		if table := c.Table(db.OID, tableName); table != nil {
 			return c.Query(db.OID, table, opts)
@@ -383,13 +451,16 @@ func (c *RemoteClient) DumpTable(dbOID uint32, table *TableInfo) *TableDump {
 		return nil
 	}
 	rows := c.Query(dbOID, table, nil)
+	types := c.Types(dbOID)
 	var cols []ColumnInfo
 	for _, a := range c.Columns(dbOID, table.OID) {
 		if a.Num > 0 {
-			cols = append(cols, ColumnInfo{Name: a.Name, TypID: a.TypID, Type: TypeName(a.TypID)})
+			cols = append(cols, ColumnInfo{Name: a.Name, TypID: a.TypID, Type: types.FormatType(a.TypID, a.TypMod, a.NDims), NotNull: a.NotNull})
 		}
 	}
-	return &TableDump{OID: table.OID, Name: table.Name, Filenode: table.Filenode, Kind: table.Kind, Columns: cols, Rows: rows, RowCount: len(rows)}
+	td := &TableDump{OID: table.OID, Schema: table.Schema, Name: table.Name, Filenode: table.Filenode, Kind: table.Kind, Columns: cols, Rows: rows, RowCount: len(rows)}
+	c.cache.schemas[dbOID].describe(td)
+	return td
 }
 
 func (c *RemoteClient) DumpDatabase(dbOID uint32) *DatabaseDump {
@@ -399,13 +470,17 @@ func (c *RemoteClient) DumpDatabase(dbOID uint32) *DatabaseDump {
 	}
 	dump := &DatabaseDump{OID: dbOID, Name: db.Name}
 	for _, t := range c.Tables(dbOID) {
-		if strings.HasPrefix(t.Name, "pg_") || strings.HasPrefix(t.Name, "sql_") {
+		if strings.HasPrefix(t.Name, "pg_") || strings.HasPrefix(t.Name, "sql_") || isSystemSchema(t.Schema) {
 			continue
 		}
 		if td := c.DumpTable(dbOID, &t); td != nil && len(td.Rows) > 0 {
 			dump.Tables = append(dump.Tables, *td)
 		}
 	}
+	dump.Sequences = c.cache.schemas[dbOID].sequenceDumps(func(seq TableInfo) []byte {
+		data, _ := ReadRelation(c.reader, c.spaces.RelationPath(*db, seq.Tablespace, seq.Filenode), c.segSize)
+		return data
+	})
 	return dump
 }
 
@@ -438,6 +513,23 @@ func (c *RemoteClient) findDB(oid uint32) *DatabaseInfo {
 	return nil
 }
 
+// dbInfo returns the pg_database entry for dbOID, or a bare entry in the
+// default tablespace if pg_database could not be read
+func (c *RemoteClient) dbInfo(dbOID uint32) DatabaseInfo {
+	if db := c.findDB(dbOID); db != nil {
+		return *db
+	}
+	return DatabaseInfo{OID: dbOID}
+}
+
+// Tablespaces returns the entries of pg_tablespace
+func (c *RemoteClient) Tablespaces() []TablespaceInfo {
+	if data, err := ReadMappedCatalog(c.reader, "global", PGTablespace); err == nil {
+		return ParsePGTablespace(data)
+	}
+	return nil
+}
+
 func (c *RemoteClient) Summary() SummaryResult {
 	s := SummaryResult{
 		version: c.Version(),
@@ -522,24 +614,11 @@ func formatDump(dump *DatabaseDump) string {
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("=== %s ===\n", dump.Name))
 	for _, t := range dump.Tables {
-		b.WriteString(fmt.Sprintf("\n[%s] %d rows\n", t.Name, len(t.Rows)))
+		b.WriteString(fmt.Sprintf("\n[%s] %d rows\n", t.QualifiedName(), len(t.Rows)))
 		if len(t.Rows) == 0 {
 			continue
 		}
-		var cols []string
-		for k := range t.Rows[0] {
-			cols = append(cols, k)
-		}
-		for _, col := range cols {
-			b.WriteString(fmt.Sprintf("%-20s", truncate(col, 20)))
-		}
-		b.WriteString("\n")
-		for _, row := range t.Rows {
-			for _, col := range cols {
-				b.WriteString(fmt.Sprintf("%-20s", truncate(fmt.Sprintf("%v", row[col]), 20)))
-			}
-			b.WriteString("\n")
-		}
+		writeRows(&b, t.Rows)
 	}
 	return b.String()
 }
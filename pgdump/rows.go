@@ -0,0 +1,369 @@
+package pgdump
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding"
+)
+
+// Row is a decoded tuple, its values in catalog column order. Columns is
+// shared by the rows of a relation. Two columns may have the same name (a
+// user column called like a system column, say), so prefer indexing Values
+// over looking values up by name.
+type Row struct {
+	Columns []string
+	Values  []interface{}
+}
+
+// Get returns the value of the first column named name
+func (r Row) Get(name string) (interface{}, bool) {
+	for i, col := range r.Columns {
+		if col == name {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// at returns the value of column i of a relation, falling back to the name
+// for rows built with other columns
+func (r Row) at(i int, name string) (interface{}, bool) {
+	if i < len(r.Columns) && r.Columns[i] == name {
+		return r.Values[i], true
+	}
+	return r.Get(name)
+}
+
+// Map returns the row as a map. Of columns with the same name, only the
+// first is kept.
+func (r Row) Map() map[string]interface{} {
+	if r.Values == nil {
+		return nil
+	}
+	m := make(map[string]interface{}, len(r.Columns))
+	for i := len(r.Columns) - 1; i >= 0; i-- {
+		m[r.Columns[i]] = r.Values[i]
+	}
+	return m
+}
+
+// MarshalJSON writes the row as an object with its columns in order. Like
+// PostgreSQL's row_to_json, columns with the same name are all written.
+func (r Row) MarshalJSON() ([]byte, error) {
+	if r.Values == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range r.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(col)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(r.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads an object written by MarshalJSON, keeping the order
+// of its keys
+func (r *Row) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*r = Row{}
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("row: expected an object, got %v", tok)
+	}
+	*r = Row{Columns: []string{}, Values: []interface{}{}}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+		r.Columns = append(r.Columns, tok.(string))
+		r.Values = append(r.Values, val)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// columnNames returns the names shared by the rows of a relation
+func columnNames(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// RowIterator decodes a relation one page at a time, so memory use stays
+// flat however large the table is. Pages are read from an io.ReaderAt: an
+// *os.File, a RelationFile spanning all segments, or a bytes.Reader.
+//
+//	it := pgdump.NewRowIterator(f, columns)
+//	for it.Next() {
+//	    row := it.Row()
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type RowIterator struct {
+	src      io.ReaderAt
+	columns  []Column
+	names    []string
+	dec      *rowDecoder
+	decoder  *encoding.Decoder // database encoding to UTF-8, may be nil
+	encoder  *encoding.Encoder // UTF-8 to output encoding, may be nil
+	closer   io.Closer         // files opened for the iterator
+	ctx      context.Context   // stops reading when done, may be nil
+	system   bool              // rows start with the system columns
+	sysNames []string          // systemColumns then names
+
+	rows []Row // decoded rows, when there is no src
+
+	// feed hands over rows decoded ahead by a pipeline, io.EOF at the end.
+	// Once it is exhausted, Reset reads the pages again from src.
+	feed  func() ([]Row, error)
+	batch []Row
+
+	start, end int64        // byte range of the pages to read, end 0 = all
+	off        int64        // offset of the next page
+	pending    []TupleEntry // visible tuples of the current page
+	row        Row
+	n          int // rows returned since the start
+	done       bool
+	err        error
+}
+
+// NewRowIterator returns an iterator over the visible rows of a heap relation
+func NewRowIterator(src io.ReaderAt, columns []Column) *RowIterator {
+	return NewRowIteratorWithTOAST(src, columns, nil)
+}
+
+// NewRowIteratorWithTOAST is NewRowIterator resolving TOAST pointers
+func NewRowIteratorWithTOAST(src io.ReaderAt, columns []Column, toastReader *TOASTReader) *RowIterator {
+	return newRowIterator(src, columns, &rowDecoder{toast: toastReader}, nil, nil)
+}
+
+func newRowIterator(src io.ReaderAt, columns []Column, dec *rowDecoder, decoder *encoding.Decoder, encoder *encoding.Encoder) *RowIterator {
+	return &RowIterator{src: src, columns: columns, names: columnNames(columns), dec: dec, decoder: decoder, encoder: encoder}
+}
+
+// clone returns an iterator over the same relation with the same settings,
+// converting strings with decoder and encoder, which are not safe to share
+// between iterators read concurrently
+func (it *RowIterator) clone(decoder *encoding.Decoder, encoder *encoding.Encoder) *RowIterator {
+	c := newRowIterator(it.src, it.columns, it.dec, decoder, encoder)
+	c.ctx, c.system = it.ctx, it.system
+	return c
+}
+
+// rowSlice iterates over rows that are already decoded
+func rowSlice(rows []Row) *RowIterator {
+	return &RowIterator{rows: rows}
+}
+
+// Next advances to the next row, reporting false at the end or on error
+func (it *RowIterator) Next() bool {
+	for it.feed != nil {
+		if len(it.batch) > 0 {
+			it.row = it.batch[0]
+			it.batch = it.batch[1:]
+			it.n++
+			return true
+		}
+		batch, err := it.feed()
+		if err != nil {
+			if err != io.EOF {
+				it.err = err
+			}
+			it.feed, it.row, it.done = nil, Row{}, true
+			return false
+		}
+		it.batch = batch
+	}
+
+	if it.src == nil {
+		if it.n >= len(it.rows) {
+			it.row = Row{}
+			return false
+		}
+		it.row = it.rows[it.n]
+		it.n++
+		return true
+	}
+
+	for {
+		for len(it.pending) > 0 {
+			e := it.pending[0]
+			it.pending = it.pending[1:]
+			row := it.entryRow(e)
+			if row.Values == nil {
+				continue
+			}
+			it.row = row
+			it.n++
+			return true
+		}
+		page := it.readPage()
+		if page == nil {
+			it.row = Row{}
+			return false
+		}
+		it.pending = pageTuples(page, int(it.off-PageSize), it.dec.visible)
+	}
+}
+
+// decode decodes a tuple of the relation and converts its strings
+func (it *RowIterator) decode(t *HeapTupleData) Row {
+	row := it.dec.decodeTuple(t, it.columns, it.names)
+	if row.Values != nil && (it.decoder != nil || it.encoder != nil) {
+		convertRowStrings(row, it.decoder, it.encoder)
+	}
+	return row
+}
+
+// entryRow decodes the tuple of e, with its system columns in front if
+// the iterator adds them
+func (it *RowIterator) entryRow(e TupleEntry) Row {
+	row := it.decode(e.Tuple)
+	if !it.system || row.Values == nil {
+		return row
+	}
+	if it.sysNames == nil {
+		it.sysNames = make([]string, 0, len(systemColumns)+len(it.names))
+		for _, col := range systemColumns {
+			it.sysNames = append(it.sysNames, col.Name)
+		}
+		it.sysNames = append(it.sysNames, it.names...)
+	}
+	return Row{Columns: it.sysNames, Values: append(newTupleInfo(e).values(), row.Values...)}
+}
+
+// readPage reads the next full page, nil at the end. A trailing partial
+// page is ignored, as ReadTuples does.
+func (it *RowIterator) readPage() []byte {
+	if it.done {
+		return nil
+	}
+	if it.ctx != nil {
+		if err := it.ctx.Err(); err != nil {
+			it.err, it.done = err, true
+			return nil
+		}
+	}
+	if it.end > 0 && it.off >= it.end {
+		it.done = true
+		return nil
+	}
+	// Tuples point into the page, so every page gets its own buffer
+	page := make([]byte, PageSize)
+	n, err := it.src.ReadAt(page, it.off)
+	if n < PageSize {
+		if err != nil && err != io.EOF {
+			it.err = err
+		}
+		it.done = true
+		return nil
+	}
+	it.off += PageSize
+	return page
+}
+
+// Row returns the current row
+func (it *RowIterator) Row() Row {
+	return it.row
+}
+
+// Err returns the first read error
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Reset rewinds the iterator to the first row, for writers that need two
+// passes (e.g. to size columns)
+func (it *RowIterator) Reset() {
+	it.off, it.pending, it.row, it.n = it.start, nil, Row{}, 0
+	it.feed, it.batch = nil, nil
+	it.done, it.err = false, nil
+}
+
+// Count returns the number of rows without decoding them, reading the pages
+// once more. Next is not affected.
+func (it *RowIterator) Count() (int, error) {
+	if it.src == nil {
+		return len(it.rows), nil
+	}
+	count := 0
+	page := make([]byte, PageSize)
+	for off := it.start; it.end == 0 || off < it.end; off += PageSize {
+		if it.ctx != nil {
+			if err := it.ctx.Err(); err != nil {
+				return count, err
+			}
+		}
+		n, err := it.src.ReadAt(page, off)
+		if n < PageSize {
+			if err != nil && err != io.EOF {
+				return count, err
+			}
+			return count, nil
+		}
+		for _, e := range pageTuples(page, int(off), it.dec.visible) {
+			if len(e.Tuple.Data) > 0 {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// Close releases the files opened for the iterator by StreamDataDir. A
+// source passed to NewRowIterator is left open.
+func (it *RowIterator) Close() error {
+	if it.closer == nil {
+		return nil
+	}
+	err := it.closer.Close()
+	it.closer = nil
+	return err
+}
+
+// streaming reports whether rows are decoded from pages rather than replayed
+func (it *RowIterator) streaming() bool {
+	return it.src != nil
+}
+
+// all decodes the remaining rows, nil if there are none
+func (it *RowIterator) all() []Row {
+	var rows []Row
+	for it.Next() {
+		rows = append(rows, it.Row())
+	}
+	return rows
+}
@@ -0,0 +1,171 @@
+package pgdump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testInt4Rows(vals ...uint32) [][]byte {
+	tuples := make([][]byte, len(vals))
+	for i, v := range vals {
+		b := make([]byte, 4)
+		putU32(b, 0, v)
+		tuples[i] = testHeapTuple(1, b)
+	}
+	return tuples
+}
+
+var testInt4Columns = []Column{{Name: "id", TypID: OidInt4, Len: 4, Num: 1, Align: 'i'}}
+
+// testRow builds a row from alternating column names and values
+func testRow(kv ...interface{}) Row {
+	row := Row{Columns: []string{}, Values: []interface{}{}}
+	for i := 0; i+1 < len(kv); i += 2 {
+		row.Columns = append(row.Columns, kv[i].(string))
+		row.Values = append(row.Values, kv[i+1])
+	}
+	return row
+}
+
+func TestRowJSON(t *testing.T) {
+	row := testRow("zeta", int32(1), "alpha", "a", "oid", nil, "oid", int32(7))
+	data, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"zeta":1,"alpha":"a","oid":null,"oid":7}`; string(data) != want {
+		t.Errorf("MarshalJSON = %s, want %s", data, want)
+	}
+	if v, ok := row.Get("oid"); !ok || v != nil {
+		t.Errorf("Get(oid) = %v, %v, want the first column", v, ok)
+	}
+	if m := row.Map(); len(m) != 3 || m["oid"] != nil {
+		t.Errorf("Map = %v", m)
+	}
+
+	var back Row
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if !reflect.DeepEqual(back.Columns, row.Columns) || back.Values[0] != json.Number("1") {
+		t.Errorf("round trip = %+v", back)
+	}
+
+	if data, _ := json.Marshal(Row{}); string(data) != "null" {
+		t.Errorf("empty row = %s", data)
+	}
+}
+
+func TestRowIterator(t *testing.T) {
+	data := append(testHeapPage(testInt4Rows(1, 2, 3)...), testHeapPage(testInt4Rows(4, 5)...)...)
+
+	it := NewRowIterator(bytes.NewReader(data), testInt4Columns)
+	got := it.all()
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := ReadRows(data, testInt4Columns, true); !reflect.DeepEqual(rowMaps(got), want) {
+		t.Errorf("iterator rows = %v, ReadRows = %v", got, want)
+	}
+	if len(got) != 5 || got[4].Values[0] != int32(5) {
+		t.Errorf("rows = %v", got)
+	}
+
+	if n, err := it.Count(); n != 5 || err != nil {
+		t.Errorf("Count = %d, %v", n, err)
+	}
+	it.Reset()
+	if !it.Next() || it.Row().Values[0] != int32(1) {
+		t.Errorf("after Reset: first row %v", it.Row())
+	}
+
+	// Streamed tables are counted as they are written, not read twice
+	table := &TableDump{Name: "t", Columns: []ColumnInfo{{Name: "id", Type: "int4", TypID: OidInt4}}}
+	for name, write := range map[string]func(io.Writer, *RowIterator) error{"SQL": table.writeSQL, "COPY": table.writeCopy} {
+		var out bytes.Buffer
+		if err := write(&out, NewRowIterator(bytes.NewReader(data), testInt4Columns)); err != nil {
+			t.Fatal(err)
+		}
+		if s := out.String(); !strings.HasPrefix(s, "-- Table: t\n") || !strings.HasSuffix(s, "-- t: 5 rows\n") {
+			t.Errorf("streamed %s:\n%s", name, s)
+		}
+	}
+
+	// A trailing partial page is ignored
+	it = NewRowIterator(bytes.NewReader(append(data, 1, 2, 3)), testInt4Columns)
+	if rows := it.all(); len(rows) != 5 {
+		t.Errorf("with a partial page: %d rows", len(rows))
+	}
+}
+
+func TestOpenRelationSegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "16400")
+	seg0 := append(testHeapPage(testInt4Rows(1)...), testHeapPage(testInt4Rows(2)...)...)
+	seg1 := testHeapPage(testInt4Rows(3, 4)...)
+	if err := os.WriteFile(path, seg0, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".1", seg1, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := OpenRelation(path, 2*PageSize)
+	if err != nil {
+		t.Fatalf("OpenRelation failed: %v", err)
+	}
+	defer rel.Close()
+	if rel.Size() != 3*PageSize {
+		t.Errorf("Size = %d, want %d", rel.Size(), 3*PageSize)
+	}
+
+	// A read straddling the segment boundary
+	buf := make([]byte, 16)
+	if n, err := rel.ReadAt(buf, 2*PageSize-8); n != 16 || err != nil {
+		t.Fatalf("ReadAt = %d, %v", n, err)
+	}
+	if !bytes.Equal(buf, append(append([]byte{}, seg0[2*PageSize-8:]...), seg1[:8]...)) {
+		t.Errorf("ReadAt across segments = %v", buf)
+	}
+
+	var ids []interface{}
+	it := NewRowIterator(rel, testInt4Columns)
+	for it.Next() {
+		ids = append(ids, it.Row().Values[0])
+	}
+	if want := []interface{}{int32(1), int32(2), int32(3), int32(4)}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+func TestDumpResultToJSON(t *testing.T) {
+	db := testArchiveDatabase()
+	db.Tables = append(db.Tables, TableDump{Name: "empty", Kind: "r"})
+	db.Tables[0].DeletedRows = []DeletedRow{{Ctid: ItemPointer{0, 3}, Xmin: 100, Xmax: 101, Data: db.Tables[0].Rows[0], RawSize: 12}}
+	results := []DumpResult{
+		{},
+		{Databases: []DatabaseDump{db, {OID: 5, Name: "bare"}, {Name: "none", Tables: []TableDump{}}}},
+	}
+	for _, result := range results {
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		if err := result.ToJSON(&got); err != nil {
+			t.Fatalf("ToJSON failed: %v", err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("ToJSON =\n%s\nwant\n%s", got.String(), want.String())
+		}
+	}
+}
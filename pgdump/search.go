@@ -1,18 +1,20 @@
 package pgdump
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 )
 
 // SearchResult represents a match found during search
 type SearchResult struct {
-	Database string                 `json:"database"`
-	Table    string                 `json:"table"`
-	Column   string                 `json:"column"`
-	RowNum   int                    `json:"row_num"`
-	Value    interface{}            `json:"value"`
-	Row      map[string]interface{} `json:"row,omitempty"`
+	Database string      `json:"database"`
+	Table    string      `json:"table"`
+	Column   string      `json:"column"`
+	RowNum   int         `json:"row_num"`
+	Value    interface{} `json:"value"`
+	Row      *Row        `json:"row,omitempty"`
+	Tuple    *TupleInfo  `json:"tuple,omitempty"` // with SystemColumns
 }
 
 // SearchOptions configures the search behavior
@@ -21,10 +23,17 @@ type SearchOptions struct {
 	CaseSensitive bool   // Case-sensitive search
 	IncludeRow    bool   // Include full row in results
 	MaxResults    int    // Maximum results (0 = unlimited)
+	Workers       int    // Tables decoded concurrently (see Options.Workers)
+	SystemColumns bool   // Pin matches to their tuple (see Options.SystemColumns)
 }
 
 // Search searches across all databases and tables for a pattern
 func Search(dataDir string, opts *SearchOptions) ([]SearchResult, error) {
+	return SearchContext(context.Background(), dataDir, opts)
+}
+
+// SearchContext is Search stopping early with ctx's error once ctx is done
+func SearchContext(ctx context.Context, dataDir string, opts *SearchOptions) ([]SearchResult, error) {
 	if opts == nil {
 		return nil, fmt.Errorf("search options required")
 	}
@@ -40,7 +49,7 @@ func Search(dataDir string, opts *SearchOptions) ([]SearchResult, error) {
 	}
 
 	// Dump everything
-	result, err := DumpDataDir(dataDir, &Options{SkipSystemTables: true})
+	result, err := DumpDataDirContext(ctx, dataDir, &Options{SkipSystemTables: true, Workers: opts.Workers, SystemColumns: opts.SystemColumns})
 	if err != nil {
 		return nil, err
 	}
@@ -50,17 +59,21 @@ func Search(dataDir string, opts *SearchOptions) ([]SearchResult, error) {
 	for _, db := range result.Databases {
 		for _, table := range db.Tables {
 			for rowNum, row := range table.Rows {
-				for colName, value := range row {
+				for i, value := range row.Values {
+					if table.systemColumn(i) {
+						continue
+					}
 					if matchValue(value, re) {
 						match := SearchResult{
 							Database: db.Name,
 							Table:    table.Name,
-							Column:   colName,
+							Column:   row.Columns[i],
 							RowNum:   rowNum,
 							Value:    value,
+							Tuple:    rowTupleInfo(row),
 						}
 						if opts.IncludeRow {
-							match.Row = row
+							match.Row = &table.Rows[rowNum]
 						}
 						matches = append(matches, match)
 
@@ -96,17 +109,21 @@ func SearchInDump(result *DumpResult, opts *SearchOptions) ([]SearchResult, erro
 	for _, db := range result.Databases {
 		for _, table := range db.Tables {
 			for rowNum, row := range table.Rows {
-				for colName, value := range row {
+				for i, value := range row.Values {
+					if table.systemColumn(i) {
+						continue
+					}
 					if matchValue(value, re) {
 						match := SearchResult{
 							Database: db.Name,
 							Table:    table.Name,
-							Column:   colName,
+							Column:   row.Columns[i],
 							RowNum:   rowNum,
 							Value:    value,
+							Tuple:    rowTupleInfo(row),
 						}
 						if opts.IncludeRow {
-							match.Row = row
+							match.Row = &table.Rows[rowNum]
 						}
 						matches = append(matches, match)
 
@@ -136,6 +153,9 @@ func matchValue(value interface{}, re *regexp.Regexp) bool {
 	case map[string]interface{}:
 		// Search in JSON/JSONB
 		return matchMap(v, re)
+	case Record:
+		// Search in composite attributes, by name and value
+		return matchMap(v.Map(), re)
 	case []interface{}:
 		// Search in arrays
 		for _, elem := range v {
@@ -191,10 +211,9 @@ func SearchSecrets(dataDir string) ([]SearchResult, error) {
 			Column:   f.Column,
 			RowNum:   f.RowIndex,
 			Value:    f.Raw,
-			Row: map[string]interface{}{
-				"detector": f.DetectorName,
-				"redacted": f.Redacted,
-				"verified": f.Verified,
+			Row: &Row{
+				Columns: []string{"detector", "redacted", "verified"},
+				Values:  []interface{}{f.DetectorName, f.Redacted, f.Verified},
 			},
 		})
 	}
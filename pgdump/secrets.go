@@ -22,6 +22,7 @@ type SecretFinding struct {
 	Redacted     string            `json:"redacted,omitempty"`
 	Verified     bool              `json:"verified"`
 	ExtraData    map[string]string `json:"extra_data,omitempty"`
+	Tuple        *TupleInfo        `json:"tuple,omitempty"` // with Options.SystemColumns
 }
 
 // SecretScanner scans for secrets using trufflehog detectors
@@ -97,7 +98,10 @@ func (s *SecretScanner) scanTable(dbName string, table *TableDump) []SecretFindi
 	var findings []SecretFinding
 
 	for rowIdx, row := range table.Rows {
-		for colName, value := range row {
+		for i, value := range row.Values {
+			if table.systemColumn(i) {
+				continue
+			}
 			strVal := fmt.Sprintf("%v", value)
 			if len(strVal) < 8 {
 				continue // Too short to be a secret
@@ -109,12 +113,13 @@ func (s *SecretScanner) scanTable(dbName string, table *TableDump) []SecretFindi
 					DetectorName: res.DetectorType.String(),
 					Database:     dbName,
 					Table:        table.Name,
-					Column:       colName,
+					Column:       row.Columns[i],
 					RowIndex:     rowIdx,
 					Raw:          string(res.Raw),
 					Redacted:     res.Redacted,
 					Verified:     res.Verified,
 					ExtraData:    res.ExtraData,
+					Tuple:        rowTupleInfo(row),
 				}
 				findings = append(findings, finding)
 			}
@@ -126,7 +131,13 @@ func (s *SecretScanner) scanTable(dbName string, table *TableDump) []SecretFindi
 
 // ScanDataDir scans a PostgreSQL data directory for secrets
 func ScanForSecrets(dataDir string, opts *Options) ([]SecretFinding, error) {
-	result, err := DumpDataDir(dataDir, opts)
+	return ScanForSecretsContext(context.Background(), dataDir, opts)
+}
+
+// ScanForSecretsContext is ScanForSecrets stopping early with ctx's error
+// once ctx is done
+func ScanForSecretsContext(ctx context.Context, dataDir string, opts *Options) ([]SecretFinding, error) {
+	result, err := DumpDataDirContext(ctx, dataDir, opts)
 	if err != nil {
 		return nil, err
 	}
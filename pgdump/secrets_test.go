@@ -104,11 +104,11 @@ func TestSecretScannerWithDump(t *testing.T) {
 				Tables: []TableDump{
 					{
 						Name: "credentials",
-						Rows: []map[string]interface{}{
-							{"key": "stripe", "value": generateTestToken("sk_live_51", 40)},
-							{"key": "slack", "value": fmt.Sprintf("xoxb-%d-%d-%s", 41521398724+mrand.Int63()%1000, 8174928371924+mrand.Int63()%1000, generateRandomHex(24))},
-							{"key": "gitlab", "value": generateTestToken("glpat-", 20)},
-							{"key": "normal", "value": "just some text without secrets"},
+						Rows: []Row{
+							testRow("key", "stripe", "value", generateTestToken("sk_live_51", 40)),
+							testRow("key", "slack", "value", fmt.Sprintf("xoxb-%d-%d-%s", 41521398724+mrand.Int63()%1000, 8174928371924+mrand.Int63()%1000, generateRandomHex(24))),
+							testRow("key", "gitlab", "value", generateTestToken("glpat-", 20)),
+							testRow("key", "normal", "value", "just some text without secrets"),
 						},
 					},
 				},
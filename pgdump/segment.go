@@ -2,6 +2,7 @@ package pgdump
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -183,6 +184,139 @@ func ReadMultiSegmentFile(basePath string, globalBlockStart, globalBlockEnd int,
 	return result, nil
 }
 
+// ReadRelation reads a relation and all of its extra segments (path.1,
+// path.2, ...) through reader and concatenates them. segSize is the size of a
+// full segment (0 = DefaultSegmentSize): PostgreSQL only starts a new segment
+// once the previous one is full, so the next file is tried only in that case.
+func ReadRelation(reader RemoteReader, path string, segSize int) ([]byte, error) {
+	data, err := reader(path)
+	if err != nil {
+		return nil, err
+	}
+	if segSize <= 0 {
+		segSize = DefaultSegmentSize
+	}
+
+	last := len(data)
+	for seg := 1; last >= segSize; seg++ {
+		next, err := reader(fmt.Sprintf("%s.%d", path, seg))
+		if err != nil || len(next) == 0 {
+			break
+		}
+		data = append(data, next...)
+		last = len(next)
+	}
+	return data, nil
+}
+
+// ReadRelationFile reads all segments of a relation from the local filesystem
+func ReadRelationFile(path string, segSize int) ([]byte, error) {
+	return ReadRelation(os.ReadFile, path, segSize)
+}
+
+// RelationFile reads a relation across its segment files (path, path.1, ...)
+// as one io.ReaderAt, without loading it into memory
+type RelationFile struct {
+	path     string // of the first segment
+	segments []*os.File
+	segSize  int64
+	size     int64
+}
+
+// OpenRelation opens a relation and its extra segments. segSize is the size
+// of a full segment (0 = DefaultSegmentSize), as for ReadRelation.
+func OpenRelation(path string, segSize int) (*RelationFile, error) {
+	if segSize <= 0 {
+		segSize = DefaultSegmentSize
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RelationFile{path: path, segSize: int64(segSize)}
+	for f != nil {
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			r.Close()
+			return nil, err
+		}
+		r.segments = append(r.segments, f)
+		r.size += st.Size()
+		if st.Size() < r.segSize {
+			break
+		}
+		f, _ = os.Open(fmt.Sprintf("%s.%d", path, len(r.segments)))
+	}
+	return r, nil
+}
+
+// ReadAt reads from the logical relation, crossing segment boundaries
+func (r *RelationFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		seg := pos / r.segSize
+		if seg >= int64(len(r.segments)) {
+			return n, io.EOF
+		}
+		chunk := p[n:]
+		if rest := r.segSize - pos%r.segSize; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		m, err := r.segments[seg].ReadAt(chunk, pos%r.segSize)
+		n += m
+		if m < len(chunk) {
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Size returns the total size of all segments
+func (r *RelationFile) Size() int64 {
+	return r.size
+}
+
+// Close closes all segment files
+func (r *RelationFile) Close() error {
+	var first error
+	for _, f := range r.segments {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	r.segments = nil
+	return first
+}
+
+// relationSegmentSize returns the segment size recorded in global/pg_control
+func relationSegmentSize(reader RemoteReader) int {
+	var cf *ControlFile
+	if data, err := reader("global/pg_control"); err == nil {
+		cf, _ = ParseControlFile(data)
+	}
+	return cf.SegmentSize()
+}
+
+// dataDirSegmentSize returns the segment size recorded in the pg_control
+// of the data directory the relation file at path is in, base/<db>/,
+// global/ or pg_tblspc/<oid>/<version>/<db>/, or 0 outside of one
+func dataDirSegmentSize(path string) int {
+	dir := filepath.Dir(path)
+	for i := 0; i < 5; i++ {
+		if _, err := os.Stat(filepath.Join(dir, "global", "pg_control")); err == nil {
+			return relationSegmentSize(LocalReader(dir))
+		}
+		dir = filepath.Dir(dir)
+	}
+	return 0
+}
+
 // GlobalBlockToSegment converts a global block number to segment info
 func GlobalBlockToSegment(globalBlock int, segmentSize int) (segmentNum, localBlock int) {
 	if segmentSize <= 0 {
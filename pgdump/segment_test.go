@@ -1,6 +1,7 @@
 package pgdump
 
 import (
+	"os"
 	"testing"
 )
 
@@ -92,3 +93,42 @@ func TestDefaultSegmentSize(t *testing.T) {
 		t.Errorf("DefaultSegmentSize = %d, want %d", DefaultSegmentSize, expected)
 	}
 }
+
+func TestReadRelation(t *testing.T) {
+	segSize := 2 * PageSize
+	files := map[string][]byte{
+		"base/1/16384":   make([]byte, segSize),
+		"base/1/16384.1": make([]byte, segSize),
+		"base/1/16384.2": make([]byte, PageSize),
+		"base/1/16384.3": make([]byte, PageSize), // unreachable: .2 is not full
+		"base/1/16385":   make([]byte, PageSize),
+		"base/1/16385.1": make([]byte, PageSize), // stale, first segment not full
+	}
+	reader := func(path string) ([]byte, error) {
+		if data, ok := files[path]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"base/1/16384", 5 * PageSize},
+		{"base/1/16385", PageSize},
+	}
+	for _, tt := range tests {
+		data, err := ReadRelation(reader, tt.path, segSize)
+		if err != nil {
+			t.Fatalf("ReadRelation(%s) failed: %v", tt.path, err)
+		}
+		if len(data) != tt.want {
+			t.Errorf("ReadRelation(%s) = %d bytes, want %d", tt.path, len(data), tt.want)
+		}
+	}
+
+	if _, err := ReadRelation(reader, "base/1/99999", segSize); err == nil {
+		t.Error("expected error for missing relation")
+	}
+}
@@ -3,9 +3,6 @@ package pgdump
 import (
 	"encoding/binary"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strconv"
 )
 
 // SequenceMagic is the magic number for sequence pages
@@ -14,6 +11,7 @@ const SequenceMagic = 0x1717
 // SequenceData represents a PostgreSQL sequence
 type SequenceData struct {
 	Name        string `json:"name,omitempty"`
+	Schema      string `json:"schema,omitempty"`
 	OID         uint32 `json:"oid,omitempty"`
 	Filenode    uint32 `json:"filenode,omitempty"`
 	LastValue   int64  `json:"last_value"`
@@ -154,6 +152,10 @@ func parseSequenceTuple(data []byte) (*SequenceData, error) {
 			if len(data) >= 8 {
 				seq.LastValue = int64(binary.LittleEndian.Uint64(data[0:8]))
 			}
+			// PG 10+ relation data: last_value (8), log_cnt (8), is_called (1)
+			if len(data) >= 17 {
+				seq.IsCalled = data[16] != 0
+			}
 			return seq, nil
 		}
 
@@ -208,20 +210,21 @@ func IsSequenceFile(data []byte) bool {
 // FindSequences finds all sequences in a database
 func FindSequences(dataDir, dbName string) ([]SequenceData, error) {
 	// Find database OID
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
 
-	dbOID := FindDatabaseOID(dbData, dbName)
-	if dbOID == 0 {
+	db := FindDatabase(dbData, dbName)
+	if db == nil {
 		return nil, fmt.Errorf("database %q not found", dbName)
 	}
 
-	basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(dbOID), 10))
+	local := LocalReader(dataDir)
+	spaces := loadLocalTablespaces(dataDir, nil)
 
 	// Read pg_class to find sequences (relkind = 'S')
-	classData, err := os.ReadFile(filepath.Join(basePath, "1259"))
+	classData, err := ReadDatabaseCatalog(dataDir, *db, PGClass)
 	if err != nil {
 		return nil, err
 	}
@@ -236,8 +239,7 @@ func FindSequences(dataDir, dbName string) ([]SequenceData, error) {
 		}
 
 		// Read the sequence file
-		seqPath := filepath.Join(basePath, strconv.FormatUint(uint64(filenode), 10))
-		seqData, err := os.ReadFile(seqPath)
+		seqData, err := local(spaces.RelationPath(*db, info.Tablespace, filenode))
 		if err != nil {
 			continue
 		}
@@ -260,7 +262,7 @@ func FindSequences(dataDir, dbName string) ([]SequenceData, error) {
 func ScanAllSequences(dataDir string) (map[string][]SequenceData, error) {
 	results := make(map[string][]SequenceData)
 
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,8 @@ package pgdump
 import (
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strings"
 	"time"
 )
@@ -10,89 +12,315 @@ import (
 // ToSQL writes the dump result as SQL statements to the writer.
 // Generates CREATE TABLE and INSERT statements that can be imported into PostgreSQL.
 func (r *DumpResult) ToSQL(w io.Writer) error {
-	fmt.Fprintf(w, "-- PostgreSQL dump generated by pgread\n")
-	fmt.Fprintf(w, "-- Generated at: %s\n\n", time.Now().Format(time.RFC3339))
+	return r.writeTo(NewSQLWriter(w))
+}
 
-	for _, db := range r.Databases {
-		fmt.Fprintf(w, "-- Database: %s (OID: %d)\n", db.Name, db.OID)
-		fmt.Fprintf(w, "-- \\connect %s\n\n", db.Name)
+// NewSQLWriter returns a DumpWriter producing the output of ToSQL
+func NewSQLWriter(w io.Writer) DumpWriter {
+	return &scriptWriter{w: w, table: (*TableDump).writeSQL, header: true}
+}
 
-		if err := db.ToSQL(w); err != nil {
-			return err
+// scriptWriter writes databases as a psql script: the schemas, each table
+// through table, then the post-data statements
+type scriptWriter struct {
+	w       io.Writer
+	table   func(t *TableDump, w io.Writer, rows *RowIterator) error
+	header  bool // file and per-database headers, as for a DumpResult
+	started bool
+}
+
+func (s *scriptWriter) start() {
+	if s.header && !s.started {
+		fmt.Fprintf(s.w, "-- PostgreSQL dump generated by pgread\n")
+		fmt.Fprintf(s.w, "-- Generated at: %s\n\n", time.Now().Format(time.RFC3339))
+	}
+	s.started = true
+}
+
+// BeginDatabase creates the schemas first, so qualified tables restore in place
+func (s *scriptWriter) BeginDatabase(db *DatabaseDump) error {
+	s.start()
+	if s.header {
+		fmt.Fprintf(s.w, "-- Database: %s (OID: %d)\n", db.Name, db.OID)
+		fmt.Fprintf(s.w, "-- \\connect %s\n\n", db.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, table := range db.Tables {
+		if table.Schema == "" || seen[table.Schema] {
+			continue
 		}
+		seen[table.Schema] = true
+		fmt.Fprintf(s.w, "CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdent(table.Schema))
+	}
+	if len(seen) > 0 {
+		_, err := fmt.Fprintln(s.w)
+		return err
+	}
+	return nil
+}
+
+func (s *scriptWriter) WriteTable(_ *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	if err := s.table(t, s.w, rows); err != nil {
+		return err
 	}
+	_, err := fmt.Fprintln(s.w)
+	return err
+}
+
+// EndDatabase writes defaults, constraints and indexes after the data
+func (s *scriptWriter) EndDatabase(db *DatabaseDump) error {
+	db.writePostData(s.w)
+	return nil
+}
+
+func (s *scriptWriter) Close() error {
+	s.start()
 	return nil
 }
 
 // ToSQL writes a single database dump as SQL statements.
+// Schemas are created first so qualified tables restore in place, and
+// defaults, constraints and indexes follow the data (see writePostData).
 func (d *DatabaseDump) ToSQL(w io.Writer) error {
-	for _, table := range d.Tables {
-		if err := table.ToSQL(w); err != nil {
-			return err
+	return d.writeTo(&scriptWriter{w: w, table: (*TableDump).writeSQL})
+}
+
+// postDataStatement is one statement of the post-data section, with the
+// object type and tag pg_dump gives it in an archive TOC
+type postDataStatement struct {
+	step   int    // restore order, see postData
+	desc   string // TOC object type, e.g. "FK CONSTRAINT"
+	schema string
+	table  string // owning table, or the sequence itself
+	tag    string
+	sql    string
+	drop   string
+}
+
+// postData lists what pg_dump keeps for after the data: sequences and
+// defaults, NOT NULL, CHECK, primary key/unique/exclusion constraints, the
+// remaining indexes, and foreign keys last so every referenced key exists.
+// The second result lists what could not be rendered.
+func (d *DatabaseDump) postData() ([]postDataStatement, []string) {
+	var stmts []postDataStatement
+	add := func(step int, desc, schema, table, tag, sql, drop string) {
+		stmts = append(stmts, postDataStatement{step, desc, schema, table, tag, sql, drop})
+	}
+
+	for _, seq := range d.Sequences {
+		name := quotedRelationName(seq.Schema, seq.Name)
+		stmt := "CREATE SEQUENCE IF NOT EXISTS " + name
+		if seq.IncrementBy != 0 {
+			stmt += fmt.Sprintf(" INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d CACHE %d",
+				seq.IncrementBy, seq.MinValue, seq.MaxValue, seq.StartValue, seq.CacheValue)
+			if seq.IsCycled {
+				stmt += " CYCLE"
+			}
+		}
+		add(0, "SEQUENCE", seq.Schema, seq.Name, seq.Name, stmt+";", "DROP SEQUENCE "+name+";")
+		if seq.LastValue != 0 {
+			add(0, "SEQUENCE SET", seq.Schema, seq.Name, seq.Name,
+				fmt.Sprintf("SELECT pg_catalog.setval(%s, %d, %t);", quoteLiteral(name), seq.LastValue, seq.IsCalled), "")
 		}
-		fmt.Fprintln(w)
 	}
-	return nil
+
+	var skipped []string
+	for _, t := range d.Tables {
+		alter := "ALTER TABLE ONLY " + t.quotedName()
+		for _, col := range t.Columns {
+			column := alter + " ALTER COLUMN " + quoteIdent(col.Name)
+			if col.Default != "" {
+				add(0, "DEFAULT", t.Schema, t.Name, t.Name+" "+col.Name,
+					fmt.Sprintf("%s SET DEFAULT %s;", column, col.Default), column+" DROP DEFAULT;")
+			}
+			if col.NotNull {
+				add(1, "CONSTRAINT", t.Schema, t.Name, t.Name+" "+col.Name+" NOT NULL",
+					column+" SET NOT NULL;", column+" DROP NOT NULL;")
+			}
+		}
+		for _, c := range t.Constraints {
+			step, desc := 2, "CHECK CONSTRAINT"
+			switch c.Type {
+			case "p", "u", "x":
+				step, desc = 3, "CONSTRAINT"
+			case "f":
+				step, desc = 5, "FK CONSTRAINT"
+			}
+			add(step, desc, t.Schema, t.Name, t.Name+" "+c.Name,
+				fmt.Sprintf("%s ADD CONSTRAINT %s %s;", alter, quoteIdent(c.Name), c.Definition),
+				fmt.Sprintf("%s DROP CONSTRAINT %s;", alter, quoteIdent(c.Name)))
+		}
+		for _, idx := range t.Indexes {
+			add(4, "INDEX", t.Schema, t.Name, idx.Name, idx.Definition+";",
+				"DROP INDEX "+quotedRelationName(t.Schema, idx.Name)+";")
+		}
+		for _, s := range t.Skipped {
+			skipped = append(skipped, fmt.Sprintf("-- Skipped on %s: %s", t.QualifiedName(), s))
+		}
+	}
+
+	sort.SliceStable(stmts, func(i, j int) bool { return stmts[i].step < stmts[j].step })
+	return stmts, skipped
+}
+
+// writePostData writes the post-data statements after the tables
+func (d *DatabaseDump) writePostData(w io.Writer) {
+	stmts, skipped := d.postData()
+	if len(stmts)+len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "-- Post-data: defaults, constraints and indexes")
+	for _, line := range skipped {
+		fmt.Fprintln(w, line)
+	}
+	for _, stmt := range stmts {
+		fmt.Fprintln(w, stmt.sql)
+	}
+	fmt.Fprintln(w)
 }
 
 // ToSQL writes a single table as CREATE TABLE and INSERT statements.
 func (t *TableDump) ToSQL(w io.Writer) error {
+	return t.writeSQL(w, rowSlice(t.Rows))
+}
+
+// writeSQL writes the table with one INSERT for all of its rows, written
+// as they are read
+func (t *TableDump) writeSQL(w io.Writer, rows *RowIterator) error {
 	// CREATE TABLE
-	fmt.Fprintf(w, "-- Table: %s (%d rows)\n", t.Name, t.RowCount)
-	fmt.Fprintf(w, "CREATE TABLE IF NOT EXISTS %s (\n", quoteIdent(t.Name))
+	t.writeHeader(w, rows)
+	fmt.Fprintln(w, t.createTableSQL())
 
-	for i, col := range t.Columns {
-		sqlType := pgTypeToSQL(col.Type, col.TypID)
-		fmt.Fprintf(w, "    %s %s", quoteIdent(col.Name), sqlType)
-		if i < len(t.Columns)-1 {
-			fmt.Fprint(w, ",")
+	// INSERT statements
+	n := 0
+	for rows.Next() {
+		if n == 0 {
+			fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", t.quotedName(), t.sqlColumns())
+		} else {
+			fmt.Fprintln(w, ",")
+		}
+		if _, err := fmt.Fprintf(w, "    (%s)", t.sqlValues(rows.Row())); err != nil {
+			return err
 		}
-		fmt.Fprintln(w)
+		n++
 	}
-	fmt.Fprintln(w, ");")
-	fmt.Fprintln(w)
-
-	// INSERT statements
-	if len(t.Rows) == 0 {
-		return nil
+	if n > 0 {
+		fmt.Fprintln(w, ";")
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
+	if err := t.writeFooter(w, rows, n); err != nil {
+		return err
+	}
+	return t.writeDeletedSQL(w)
+}
 
-	// Get column names in order
+// sqlColumns returns the quoted column names, comma-separated
+func (t *TableDump) sqlColumns() string {
 	colNames := make([]string, len(t.Columns))
 	for i, col := range t.Columns {
-		colNames[i] = quoteIdent(col.Name)
+		colNames[i] = quoteIdent(col.sqlName())
 	}
+	return strings.Join(colNames, ", ")
+}
 
-	fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", quoteIdent(t.Name), strings.Join(colNames, ", "))
-
-	for i, row := range t.Rows {
-		values := make([]string, len(t.Columns))
-		for j, col := range t.Columns {
-			val, ok := row[col.Name]
-			if !ok || val == nil {
-				values[j] = "NULL"
-			} else {
-				values[j] = formatSQLValue(val, col.TypID)
-			}
-		}
-		fmt.Fprintf(w, "    (%s)", strings.Join(values, ", "))
-		if i < len(t.Rows)-1 {
-			fmt.Fprintln(w, ",")
+// sqlValues formats a row as SQL literals, comma-separated
+func (t *TableDump) sqlValues(row Row) string {
+	values := make([]string, len(t.Columns))
+	for j, col := range t.Columns {
+		val, ok := row.at(j, col.Name)
+		if !ok || val == nil {
+			values[j] = "NULL"
 		} else {
-			fmt.Fprintln(w, ";")
+			values[j] = formatSQLValue(val, col.TypID)
 		}
 	}
+	return strings.Join(values, ", ")
+}
 
+// writeDeletedSQL writes the deleted rows as commented-out INSERTs, so
+// restoring the dump does not bring them back. Every line of a statement
+// is commented, values spanning lines included: removing the "-- " prefixes
+// restores it exactly.
+func (t *TableDump) writeDeletedSQL(w io.Writer) error {
+	if len(t.DeletedRows) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "-- Deleted rows of %s, not vacuumed yet (%d rows)\n", t.QualifiedName(), len(t.DeletedRows))
+	for _, d := range t.DeletedRows {
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s); -- ctid %s, xmin %d, xmax %d",
+			t.quotedName(), t.sqlColumns(), t.sqlValues(d.Data), d.Ctid, d.Xmin, d.Xmax)
+		if _, err := fmt.Fprintf(w, "-- %s\n", strings.ReplaceAll(stmt, "\n", "\n-- ")); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// quoteIdent quotes a PostgreSQL identifier
+// writeHeader writes the comment opening the table's statements, with its
+// row count when it is known before the rows are read. Counting streamed
+// rows would read the relation twice: see writeFooter.
+func (t *TableDump) writeHeader(w io.Writer, rows *RowIterator) {
+	if rows.streaming() {
+		fmt.Fprintf(w, "-- Table: %s\n", t.QualifiedName())
+		return
+	}
+	fmt.Fprintf(w, "-- Table: %s (%d rows)\n", t.QualifiedName(), t.RowCount)
+}
+
+// writeFooter writes the count of the n streamed rows written, after them
+func (t *TableDump) writeFooter(w io.Writer, rows *RowIterator, n int) error {
+	if !rows.streaming() {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "-- %s: %d rows\n", t.QualifiedName(), n)
+	return err
+}
+
+// createTableSQL returns the CREATE TABLE statement, ending with a newline
+func (t *TableDump) createTableSQL() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CREATE TABLE IF NOT EXISTS %s (\n", t.quotedName())
+	for i, col := range t.Columns {
+		fmt.Fprintf(&sb, "    %s %s", quoteIdent(col.sqlName()), pgTypeToSQL(col.Type, col.TypID))
+		if i < len(t.Columns)-1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(");\n")
+	return sb.String()
+}
+
+// quotedName returns the table name quoted and qualified by its schema
+func (t *TableDump) quotedName() string {
+	return quotedRelationName(t.Schema, t.Name)
+}
+
+// quoteIdent quotes a PostgreSQL identifier, as quote_ident does: only
+// names of lower case letters, digits, _ and $, starting with a letter or
+// _, that are not keywords are left bare, as the parser folds the case of
+// the rest
 func quoteIdent(name string) string {
-	// Simple quoting - escape double quotes
-	if strings.ContainsAny(name, " \t\n\"") || isReservedWord(name) {
-		return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+	if isBareIdent(name) && !isReservedWord(name) {
+		return name
+	}
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+// isBareIdent reports whether name matches [a-z_][a-z0-9_$]*
+func isBareIdent(name string) bool {
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '$'):
+		default:
+			return false
+		}
 	}
-	return name
+	return name != ""
 }
 
 // formatSQLValue formats a Go value as a SQL literal
@@ -100,6 +328,10 @@ func formatSQLValue(val interface{}, typID int) string {
 	if val == nil {
 		return "NULL"
 	}
+	// Whatever the JSON value is, as a JSON document
+	if typID == OidJSON || typID == OidJSONB {
+		return quoteLiteral(jsonText(val))
+	}
 
 	switch v := val.(type) {
 	case bool:
@@ -111,29 +343,71 @@ func formatSQLValue(val interface{}, typID int) string {
 	case int, int16, int32, int64, uint32:
 		return fmt.Sprintf("%d", v)
 
-	case float32, float64:
-		return fmt.Sprintf("%v", v)
+	case float32:
+		return formatSQLFloat(float64(v), 32)
+	case float64:
+		return formatSQLFloat(v, 64)
 
 	case string:
+		// numeric is decoded to its exact digits; NaN and infinities are
+		// cast so they keep their type inside ARRAY[...]
+		if typID == OidNumeric {
+			if isDecimal(v) {
+				return v
+			}
+			return quoteLiteral(v) + "::numeric"
+		}
 		return quoteLiteral(v)
 
 	case []interface{}:
 		// Array
+		elemType := typID
+		if elem, ok := arrayElemTypes[typID]; ok {
+			elemType = elem
+		}
 		elements := make([]string, len(v))
 		for i, elem := range v {
-			elements[i] = formatSQLValue(elem, 0)
+			elements[i] = formatSQLValue(elem, elemType)
 		}
 		return "ARRAY[" + strings.Join(elements, ", ") + "]"
 
+	case Record:
+		// Composite, as a row literal
+		return quoteLiteral(v.String())
+
 	case map[string]interface{}:
-		// JSON/JSONB
-		return quoteLiteral(mapToJSON(v))
+		// JSON, with sorted keys so that dumps can be diffed
+		return quoteLiteral(jsonText(v))
 
 	default:
 		return quoteLiteral(fmt.Sprintf("%v", v))
 	}
 }
 
+// formatSQLFloat keeps every digit of a float, quoting NaN and the
+// infinities, which are not numeric literals
+func formatSQLFloat(f float64, bits int) string {
+	s := floatText(f, bits)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return quoteLiteral(s)
+	}
+	return s
+}
+
+// isDecimal reports whether s is a plain decimal number, -12.50 say
+func isDecimal(s string) bool {
+	intPart, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if intPart == "" && frac == "" {
+		return false
+	}
+	for _, c := range intPart + frac {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // quoteLiteral quotes a string for use as a SQL literal
 func quoteLiteral(s string) string {
 	// Use dollar quoting if string contains single quotes and backslashes
@@ -150,59 +424,36 @@ func quoteLiteral(s string) string {
 	return "'" + escaped + "'"
 }
 
-// mapToJSON converts a map to a JSON string
-func mapToJSON(m map[string]interface{}) string {
-	var sb strings.Builder
-	sb.WriteByte('{')
-	first := true
-	for k, v := range m {
-		if !first {
-			sb.WriteByte(',')
-		}
-		first = false
-		sb.WriteByte('"')
-		sb.WriteString(strings.ReplaceAll(k, "\"", "\\\""))
-		sb.WriteString("\":")
-		writeJSONValue(&sb, v)
+// pgTypeToSQL converts PostgreSQL type name to SQL type. Modifiers and
+// array dimensions rendered in the name (see FormatType) are kept.
+func pgTypeToSQL(typeName string, typID int) string {
+	dims := ""
+	for strings.HasSuffix(typeName, "[]") {
+		typeName, dims = strings.TrimSuffix(typeName, "[]"), dims+"[]"
 	}
-	sb.WriteByte('}')
-	return sb.String()
-}
-
-func writeJSONValue(sb *strings.Builder, v interface{}) {
-	switch val := v.(type) {
-	case nil:
-		sb.WriteString("null")
-	case bool:
-		if val {
-			sb.WriteString("true")
-		} else {
-			sb.WriteString("false")
+	if elem, ok := arrayElemTypes[typID]; ok {
+		if dims == "" {
+			dims = "[]"
 		}
-	case int, int16, int32, int64, uint32, float32, float64:
-		fmt.Fprintf(sb, "%v", val)
-	case string:
-		sb.WriteByte('"')
-		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(val, "\\", "\\\\"), "\"", "\\\""))
-		sb.WriteByte('"')
-	case map[string]interface{}:
-		sb.WriteString(mapToJSON(val))
-	case []interface{}:
-		sb.WriteByte('[')
-		for i, elem := range val {
-			if i > 0 {
-				sb.WriteByte(',')
-			}
-			writeJSONValue(sb, elem)
+		if typeName == TypeName(typID) {
+			typeName = TypeName(elem)
 		}
-		sb.WriteByte(']')
-	default:
-		fmt.Fprintf(sb, "\"%v\"", val)
+		return pgTypeToSQL(typeName, elem) + dims
+	}
+
+	mod := ""
+	if i := strings.IndexByte(typeName, '('); i > 0 {
+		typeName, mod = typeName[:i], typeName[i:]
 	}
+	base := baseSQLType(typeName, typID)
+	if tz := " WITH TIME ZONE"; mod != "" && strings.HasSuffix(base, tz) {
+		return strings.TrimSuffix(base, tz) + mod + tz + dims
+	}
+	return base + mod + dims
 }
 
-// pgTypeToSQL converts PostgreSQL type name to SQL type
-func pgTypeToSQL(typeName string, typID int) string {
+// baseSQLType converts a PostgreSQL type to its SQL spelling, without modifiers
+func baseSQLType(typeName string, typID int) string {
 	switch typID {
 	case OidBool:
 		return "BOOLEAN"
@@ -299,7 +550,9 @@ func pgTypeToSQL(typeName string, typID int) string {
 	}
 }
 
-// isReservedWord checks if a word is a PostgreSQL reserved word
+// isReservedWord checks if a word is a PostgreSQL keyword that cannot be
+// used bare as any identifier: reserved, type or function name, and column
+// name keywords (kwlist.h)
 func isReservedWord(word string) bool {
 	reserved := map[string]bool{
 		"all": true, "analyse": true, "analyze": true, "and": true, "any": true,
@@ -318,6 +571,28 @@ func isReservedWord(word string) bool {
 		"some": true, "symmetric": true, "table": true, "then": true, "to": true,
 		"trailing": true, "true": true, "union": true, "unique": true, "user": true,
 		"using": true, "variadic": true, "when": true, "where": true, "window": true, "with": true,
+		"system_user": true,
+
+		// type and function name keywords
+		"authorization": true, "binary": true, "collation": true, "concurrently": true,
+		"cross": true, "current_schema": true, "freeze": true, "full": true, "ilike": true,
+		"inner": true, "is": true, "isnull": true, "join": true, "left": true, "like": true,
+		"natural": true, "notnull": true, "outer": true, "overlaps": true, "right": true,
+		"similar": true, "tablesample": true, "verbose": true,
+
+		// column name keywords
+		"between": true, "bigint": true, "bit": true, "boolean": true, "char": true,
+		"character": true, "coalesce": true, "dec": true, "decimal": true, "exists": true,
+		"extract": true, "float": true, "greatest": true, "grouping": true, "inout": true,
+		"int": true, "integer": true, "interval": true, "json": true, "json_array": true,
+		"json_arrayagg": true, "json_object": true, "json_objectagg": true, "least": true,
+		"national": true, "nchar": true, "none": true, "normalize": true, "nullif": true,
+		"numeric": true, "out": true, "overlay": true, "position": true, "precision": true,
+		"real": true, "row": true, "setof": true, "smallint": true, "substring": true,
+		"time": true, "timestamp": true, "treat": true, "trim": true, "values": true,
+		"varchar": true, "xmlattributes": true, "xmlconcat": true, "xmlelement": true,
+		"xmlexists": true, "xmlforest": true, "xmlnamespaces": true, "xmlparse": true,
+		"xmlpi": true, "xmlroot": true, "xmlserialize": true, "xmltable": true,
 	}
 	return reserved[strings.ToLower(word)]
 }
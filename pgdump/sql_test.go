@@ -2,6 +2,8 @@ package pgdump
 
 import (
 	"bytes"
+	"encoding/json"
+	"math"
 	"strings"
 	"testing"
 )
@@ -16,9 +18,9 @@ func TestTableToSQL(t *testing.T) {
 			{Name: "name", Type: "text", TypID: OidText},
 			{Name: "active", Type: "bool", TypID: OidBool},
 		},
-		Rows: []map[string]interface{}{
-			{"id": int32(1), "name": "alice", "active": true},
-			{"id": int32(2), "name": "bob", "active": false},
+		Rows: []Row{
+			testRow("id", int32(1), "name", "alice", "active", true),
+			testRow("id", int32(2), "name", "bob", "active", false),
 		},
 		RowCount: 2,
 	}
@@ -73,8 +75,8 @@ func TestDatabaseToSQL(t *testing.T) {
 				Columns: []ColumnInfo{
 					{Name: "val", Type: "int4", TypID: OidInt4},
 				},
-				Rows: []map[string]interface{}{
-					{"val": int32(42)},
+				Rows: []Row{
+					testRow("val", int32(42)),
 				},
 				RowCount: 1,
 			},
@@ -96,6 +98,101 @@ func TestDatabaseToSQL(t *testing.T) {
 	}
 }
 
+func TestDatabaseToSQLSchemas(t *testing.T) {
+	db := DatabaseDump{
+		Name: "testdb",
+		Tables: []TableDump{
+			{Schema: "public", Name: "users", Columns: []ColumnInfo{{Name: "id", Type: "int4", TypID: OidInt4}},
+				Rows: []Row{testRow("id", int32(1))}, RowCount: 1},
+			{Schema: "audit", Name: "users", Columns: []ColumnInfo{{Name: "id", Type: "int4", TypID: OidInt4}},
+				Rows: []Row{testRow("id", int32(2))}, RowCount: 1},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := db.ToSQL(&buf); err != nil {
+		t.Fatalf("ToSQL failed: %v", err)
+	}
+
+	sql := buf.String()
+	for _, want := range []string{
+		"CREATE SCHEMA IF NOT EXISTS audit;",
+		"CREATE TABLE IF NOT EXISTS public.users (",
+		"CREATE TABLE IF NOT EXISTS audit.users (",
+		"INSERT INTO audit.users (id) VALUES",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("missing %q in:\n%s", want, sql)
+		}
+	}
+	if strings.Index(sql, "CREATE SCHEMA") > strings.Index(sql, "CREATE TABLE") {
+		t.Error("CREATE SCHEMA should precede CREATE TABLE")
+	}
+}
+
+func TestDatabaseToSQLPostData(t *testing.T) {
+	db := DatabaseDump{
+		Name:      "shop",
+		Sequences: []SequenceData{{Name: "orders_id_seq", Schema: "public", LastValue: 42, IsCalled: true}},
+		Tables: []TableDump{
+			{Schema: "public", Name: "orders",
+				Columns: []ColumnInfo{
+					{Name: "id", Type: "int8", TypID: OidInt8, NotNull: true, Default: "nextval('public.orders_id_seq'::regclass)"},
+					{Name: "customer_id", Type: "int4", TypID: OidInt4},
+				},
+				Rows:     []Row{testRow("id", int64(1), "customer_id", int32(7))},
+				RowCount: 1,
+				Constraints: []ConstraintDef{
+					{Name: "orders_customer_id_fkey", Type: "f", Definition: "FOREIGN KEY (customer_id) REFERENCES public.customers(id)"},
+					{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)"},
+				},
+				Skipped: []string{"index orders_tsv_idx: unsupported expression node WINDOWFUNC"},
+			},
+			{Schema: "public", Name: "customers",
+				Columns:     []ColumnInfo{{Name: "id", Type: "int4", TypID: OidInt4, NotNull: true}},
+				Constraints: []ConstraintDef{{Name: "customers_id_check", Type: "c", Definition: "CHECK ((id > 0))"}},
+				Indexes:     []IndexDef{{Name: "customers_id_idx", Definition: "CREATE INDEX customers_id_idx ON public.customers USING btree (id)"}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := db.ToSQL(&buf); err != nil {
+		t.Fatalf("ToSQL failed: %v", err)
+	}
+	sql := buf.String()
+
+	// Everything after the rows, in dependency order
+	ordered := []string{
+		"INSERT INTO public.orders",
+		"CREATE TABLE IF NOT EXISTS public.customers",
+		"-- Skipped on public.orders: index orders_tsv_idx",
+		"CREATE SEQUENCE IF NOT EXISTS public.orders_id_seq;",
+		"SELECT pg_catalog.setval('public.orders_id_seq', 42, true);",
+		"ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);",
+		"ALTER TABLE ONLY public.orders ALTER COLUMN id SET NOT NULL;",
+		"ALTER TABLE ONLY public.customers ADD CONSTRAINT customers_id_check CHECK ((id > 0));",
+		"ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);",
+		"CREATE INDEX customers_id_idx ON public.customers USING btree (id);",
+		"ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_customer_id_fkey FOREIGN KEY (customer_id) REFERENCES public.customers(id);",
+	}
+	last := -1
+	for _, want := range ordered {
+		i := strings.Index(sql, want)
+		if i < 0 {
+			t.Errorf("missing %q in:\n%s", want, sql)
+			continue
+		}
+		if i < last {
+			t.Errorf("%q is out of order in:\n%s", want, sql)
+		}
+		last = i
+	}
+	if strings.Contains(sql, "customer_id SET NOT NULL") {
+		t.Error("nullable column marked NOT NULL")
+	}
+}
+
 func TestDumpResultToSQL(t *testing.T) {
 	result := DumpResult{
 		Databases: []DatabaseDump{
@@ -108,7 +205,7 @@ func TestDumpResultToSQL(t *testing.T) {
 						Columns: []ColumnInfo{
 							{Name: "x", Type: "int4", TypID: OidInt4},
 						},
-						Rows:     []map[string]interface{}{{"x": int32(1)}},
+						Rows:     []Row{testRow("x", int32(1))},
 						RowCount: 1,
 					},
 				},
@@ -146,6 +243,17 @@ func TestFormatSQLValueTypes(t *testing.T) {
 		{"float64", float64(3.14), OidFloat8, "3.14"},
 		{"string", "hello", OidText, "'hello'"},
 		{"string with quote", "it's", OidText, "'it''s'"},
+		{"numeric", "12345678901234.56", OidNumeric, "12345678901234.56"},
+		{"numeric NaN", "NaN", OidNumeric, "'NaN'::numeric"},
+		{"numeric array", []interface{}{"-0.10", nil, "Infinity"}, 1231, "ARRAY[-0.10, NULL, 'Infinity'::numeric]"},
+		{"float NaN", math.NaN(), OidFloat8, "'NaN'"},
+		{"float infinity", float32(math.Inf(-1)), OidFloat4, "'-Infinity'"},
+		{"timestamptz", "2024-02-29 19:15:30.12+05:30", OidTimestampTZ, "'2024-02-29 19:15:30.12+05:30'"},
+		{"jsonb array", []interface{}{json.Number("1"), "a"}, OidJSONB, `'[1,"a"]'`},
+		{"jsonb string", "abc", OidJSONB, `'"abc"'`},
+		{"jsonb true", true, OidJSONB, "'true'"},
+		{"json number", json.Number("12345678901234567890.5"), OidJSON, "'12345678901234567890.5'"},
+		{"jsonb array column", []interface{}{map[string]interface{}{"k": "it's"}, nil}, 3807, `ARRAY['{"k":"it''s"}', NULL]`},
 	}
 
 	for _, tt := range tests {
@@ -172,6 +280,14 @@ func TestFormatSQLValueJSON(t *testing.T) {
 	if !strings.Contains(got, "key") || !strings.Contains(got, "value") {
 		t.Errorf("formatSQLValue(json) = %q, expected JSON with key/value", got)
 	}
+
+	// Same output every run, with strings escaped
+	m = map[string]interface{}{"z": 1, "a": "two\nlines", "m": map[string]interface{}{"y": nil, "b": true}}
+	for i := 0; i < 10; i++ {
+		if got := formatSQLValue(m, OidJSONB); got != `'{"a":"two\nlines","m":{"b":true,"y":null},"z":1}'` {
+			t.Fatalf("formatSQLValue(json) = %s", got)
+		}
+	}
 }
 
 func TestQuoteIdent(t *testing.T) {
@@ -183,6 +299,13 @@ func TestQuoteIdent(t *testing.T) {
 		{"with space", "\"with space\""},
 		{"select", "\"select\""},  // reserved word
 		{"has\"quote", "\"has\"\"quote\""},
+		{"User", "\"User\""},
+		{"My-Schema", "\"My-Schema\""},
+		{"a.b", "\"a.b\""},
+		{"1st", "\"1st\""},
+		{"col_2$", "col_2$"},
+		{"time", "\"time\""}, // column name keyword
+		{"", "\"\""},
 	}
 
 	for _, tt := range tests {
@@ -191,6 +314,9 @@ func TestQuoteIdent(t *testing.T) {
 			t.Errorf("quoteIdent(%q) = %q, want %q", tt.input, got, tt.want)
 		}
 	}
+	if got := quotedRelationName("My-Schema", "User"); got != `"My-Schema"."User"` {
+		t.Errorf("quotedRelationName = %s", got)
+	}
 }
 
 func TestQuoteLiteral(t *testing.T) {
@@ -234,6 +360,29 @@ func TestPgTypeToSQL(t *testing.T) {
 	}
 }
 
+func TestPgTypeToSQLModifiers(t *testing.T) {
+	tests := []struct {
+		typeName string
+		typID    int
+		want     string
+	}{
+		{"varchar(255)", OidVarchar, "VARCHAR(255)"},
+		{"numeric(12,2)", OidNumeric, "NUMERIC(12,2)"},
+		{"char(3)", OidBpchar, "CHAR(3)"},
+		{"timestamptz(3)", OidTimestampTZ, "TIMESTAMP(3) WITH TIME ZONE"},
+		{"bit(8)", OidBit, "BIT(8)"},
+		{"varchar(20)[]", 1015, "VARCHAR(20)[]"},
+		{"int4[][]", 1007, "INTEGER[][]"},
+		{"oid:1003", 1003, "NAME[]"},
+		{"mood[]", 16401, "MOOD[]"},
+	}
+	for _, tt := range tests {
+		if got := pgTypeToSQL(tt.typeName, tt.typID); got != tt.want {
+			t.Errorf("pgTypeToSQL(%q, %d) = %q, want %q", tt.typeName, tt.typID, got, tt.want)
+		}
+	}
+}
+
 func TestEmptyTable(t *testing.T) {
 	table := TableDump{
 		Name: "empty",
@@ -266,8 +415,8 @@ func TestNullValues(t *testing.T) {
 			{Name: "id", Type: "int4", TypID: OidInt4},
 			{Name: "name", Type: "text", TypID: OidText},
 		},
-		Rows: []map[string]interface{}{
-			{"id": int32(1), "name": nil},
+		Rows: []Row{
+			testRow("id", int32(1), "name", nil),
 		},
 		RowCount: 1,
 	}
@@ -0,0 +1,214 @@
+package pgdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DumpWriter receives a dump as StreamDataDir decodes it. Each table comes
+// with an iterator over its rows, so rows can be written as they are read.
+type DumpWriter interface {
+	// BeginDatabase starts a database. Its tables are described (columns,
+	// constraints, indexes) but have no rows yet.
+	BeginDatabase(db *DatabaseDump) error
+	// WriteTable writes a table of db. rows may be read more than once
+	// with Reset; the table's RowCount is set once WriteTable returns.
+	WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error
+	// EndDatabase finishes a database, with the row counts of its tables
+	EndDatabase(db *DatabaseDump) error
+	// Close finishes the output once all databases are written
+	Close() error
+}
+
+// resultWriter collects a streamed dump into a DumpResult
+type resultWriter struct {
+	result *DumpResult
+}
+
+func (r *resultWriter) BeginDatabase(*DatabaseDump) error { return nil }
+
+func (r *resultWriter) WriteTable(_ *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	t.Rows = rows.all()
+	return rows.Err()
+}
+
+func (r *resultWriter) EndDatabase(db *DatabaseDump) error {
+	r.result.Databases = append(r.result.Databases, *db)
+	return nil
+}
+
+func (r *resultWriter) Close() error { return nil }
+
+// writeTo replays a dump that is already in memory through a DumpWriter
+func (r *DumpResult) writeTo(w DumpWriter) error {
+	for i := range r.Databases {
+		if err := r.Databases[i].writeTo(w); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// writeTo replays a database through a DumpWriter, without closing it
+func (d *DatabaseDump) writeTo(w DumpWriter) error {
+	if err := w.BeginDatabase(d); err != nil {
+		return err
+	}
+	for i := range d.Tables {
+		if err := w.WriteTable(d, &d.Tables[i], rowSlice(d.Tables[i].Rows)); err != nil {
+			return err
+		}
+	}
+	return w.EndDatabase(d)
+}
+
+// jsonWriter writes the same document as encoding/json with two-space
+// indentation would for a DumpResult, one row at a time
+type jsonWriter struct {
+	w         io.Writer
+	databases int
+	tables    int
+	err       error
+}
+
+// NewJSONWriter returns a DumpWriter producing the CLI's JSON output
+func NewJSONWriter(w io.Writer) DumpWriter {
+	return &jsonWriter{w: w}
+}
+
+// JSON nesting: databases at 2, their fields at 6, table fields at 10, row
+// fields at 14
+const (
+	jsonDatabase = "    "
+	jsonTable    = "        "
+)
+
+func (j *jsonWriter) printf(format string, args ...interface{}) {
+	if j.err == nil {
+		_, j.err = fmt.Fprintf(j.w, format, args...)
+	}
+}
+
+// field writes ,\n then "key": value, value indented at indent
+func (j *jsonWriter) field(indent, key string, v interface{}) {
+	b, err := json.MarshalIndent(v, indent, "  ")
+	if err != nil {
+		if j.err == nil {
+			j.err = err
+		}
+		return
+	}
+	j.printf(",\n%s%q: %s", indent, key, b)
+}
+
+func (j *jsonWriter) BeginDatabase(db *DatabaseDump) error {
+	if j.databases == 0 {
+		j.printf("{\n  \"databases\": [\n")
+	} else {
+		j.printf(",\n")
+	}
+	j.databases++
+	j.tables = 0
+
+	in := jsonDatabase + "  "
+	j.printf("%s{\n%s\"oid\": %d", jsonDatabase, in, db.OID)
+	j.field(in, "name", db.Name)
+	if db.Tables == nil {
+		j.printf(",\n%s\"tables\": null", in)
+	} else {
+		j.printf(",\n%s\"tables\": [", in)
+	}
+	return j.err
+}
+
+func (j *jsonWriter) WriteTable(_ *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	if j.tables > 0 {
+		j.printf(",")
+	}
+	j.tables++
+
+	in := jsonTable + "  "
+	j.printf("\n%s{\n%s\"oid\": %d", jsonTable, in, t.OID)
+	if t.Schema != "" {
+		j.field(in, "schema", t.Schema)
+	}
+	j.field(in, "name", t.Name)
+	j.field(in, "filenode", t.Filenode)
+	j.field(in, "kind", t.Kind)
+	if len(t.Columns) > 0 {
+		j.field(in, "columns", t.Columns)
+	}
+
+	count := 0
+	for rows.Next() {
+		if count == 0 {
+			j.printf(",\n%s\"rows\": [\n", in)
+		} else {
+			j.printf(",\n")
+		}
+		b, err := json.MarshalIndent(rows.Row(), in+"  ", "  ")
+		if err != nil {
+			return err
+		}
+		j.printf("%s  %s", in, b)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if count > 0 {
+		j.printf("\n%s]", in)
+	}
+
+	if !rows.streaming() {
+		count = t.RowCount
+	}
+	j.field(in, "row_count", count)
+	if len(t.DeletedRows) > 0 {
+		j.field(in, "deleted_rows", t.DeletedRows)
+	}
+	if len(t.Constraints) > 0 {
+		j.field(in, "constraints", t.Constraints)
+	}
+	if len(t.Indexes) > 0 {
+		j.field(in, "indexes", t.Indexes)
+	}
+	if len(t.Skipped) > 0 {
+		j.field(in, "skipped", t.Skipped)
+	}
+	if t.Dropped {
+		j.field(in, "dropped", t.Dropped)
+	}
+	j.printf("\n%s}", jsonTable)
+	return j.err
+}
+
+func (j *jsonWriter) EndDatabase(db *DatabaseDump) error {
+	in := jsonDatabase + "  "
+	if db.Tables != nil {
+		if len(db.Tables) > 0 {
+			j.printf("\n%s", in)
+		}
+		j.printf("]")
+	}
+	if len(db.Sequences) > 0 {
+		j.field(in, "sequences", db.Sequences)
+	}
+	j.printf("\n%s}", jsonDatabase)
+	return j.err
+}
+
+func (j *jsonWriter) Close() error {
+	if j.databases == 0 {
+		j.printf("{\n  \"databases\": null\n}\n")
+	} else {
+		j.printf("\n  ]\n}\n")
+	}
+	return j.err
+}
+
+// ToJSON writes the dump result as indented JSON, as the CLI prints it
+func (r *DumpResult) ToJSON(w io.Writer) error {
+	return r.writeTo(NewJSONWriter(w))
+}
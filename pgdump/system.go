@@ -0,0 +1,85 @@
+package pgdump
+
+// systemColumns are added in front of the columns of each table with
+// Options.SystemColumns. PostgreSQL reserves the names of the first five,
+// so they cannot clash with user columns; infomask is pageinspect's
+// decoding of t_infomask and t_infomask2.
+var systemColumns = []ColumnInfo{
+	{Name: "ctid", Type: "tid", TypID: OidTid, System: true},
+	{Name: "xmin", Type: "xid", TypID: OidXid, System: true},
+	{Name: "xmax", Type: "xid", TypID: OidXid, System: true},
+	{Name: "cmin", Type: "cid", TypID: OidCid, System: true},
+	{Name: "cmax", Type: "cid", TypID: OidCid, System: true},
+	{Name: "infomask", Type: "text[]", TypID: 1009, System: true},
+}
+
+// TupleInfo pins a row to the tuple it was decoded from: its page and line
+// pointer, and its transaction stamps
+type TupleInfo struct {
+	Ctid     ItemPointer `json:"ctid"`
+	Xmin     uint32      `json:"xmin"`
+	Xmax     uint32      `json:"xmax"`
+	Cid      uint32      `json:"cid"` // cmin and cmax
+	Infomask []string    `json:"infomask,omitempty"`
+}
+
+// newTupleInfo describes the tuple of entry
+func newTupleInfo(e TupleEntry) TupleInfo {
+	h := e.Tuple.Header
+	return TupleInfo{
+		Ctid:     ItemPointer{Block: uint32(e.PageOffset / PageSize), Offset: e.Item},
+		Xmin:     h.Xmin,
+		Xmax:     h.Xmax,
+		Cid:      h.Cid,
+		Infomask: h.Flags(),
+	}
+}
+
+// values returns the system column values, in systemColumns order
+func (ti TupleInfo) values() []interface{} {
+	var flags interface{} // NULL without flags, rather than an empty array
+	if len(ti.Infomask) > 0 {
+		list := make([]interface{}, len(ti.Infomask))
+		for i, f := range ti.Infomask {
+			list[i] = f
+		}
+		flags = list
+	}
+	return []interface{}{ti.Ctid, ti.Xmin, ti.Xmax, ti.Cid, ti.Cid, flags}
+}
+
+// rowTupleInfo reads back the system columns of a row, nil if it has none
+func rowTupleInfo(row Row) *TupleInfo {
+	if len(row.Values) < len(systemColumns) || row.Columns[0] != "ctid" {
+		return nil
+	}
+	ctid, ok := row.Values[0].(ItemPointer)
+	if !ok {
+		return nil
+	}
+	ti := &TupleInfo{Ctid: ctid}
+	ti.Xmin, _ = row.Values[1].(uint32)
+	ti.Xmax, _ = row.Values[2].(uint32)
+	ti.Cid, _ = row.Values[3].(uint32)
+	flags, _ := row.Values[5].([]interface{})
+	for _, f := range flags {
+		if s, ok := f.(string); ok {
+			ti.Infomask = append(ti.Infomask, s)
+		}
+	}
+	return ti
+}
+
+// systemColumn reports whether column i of the table is a system column
+func (t *TableDump) systemColumn(i int) bool {
+	return i < len(t.Columns) && t.Columns[i].System
+}
+
+// sqlName is the column's name in SQL output. System columns take a "_"
+// prefix, as PostgreSQL refuses user columns named like them.
+func (c ColumnInfo) sqlName() string {
+	if c.System {
+		return "_" + c.Name
+	}
+	return c.Name
+}
@@ -0,0 +1,64 @@
+package pgdump
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSystemColumns(t *testing.T) {
+	tup := testVersion(100, 0, ItemPointer{Offset: 2}, heapHotUpdated, 7, 70)
+	putU32(tup, 8, 3) // cid
+	putU16(tup, 20, 0x0900)
+	page := testHeapPage(testVersion(100, 0, ItemPointer{Offset: 1}, 0, 1, 10), tup)
+
+	it := newRowIterator(bytes.NewReader(page), testHistoryColumns, &rowDecoder{}, nil, nil)
+	it.system = true
+	rows := it.all()
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	row := rows[1]
+	if want := []string{"ctid", "xmin", "xmax", "cmin", "cmax", "infomask", "id", "v"}; !reflect.DeepEqual(row.Columns, want) {
+		t.Errorf("columns = %v", row.Columns)
+	}
+	flags := []interface{}{"HEAP_XMIN_COMMITTED", "HEAP_XMAX_INVALID", "HEAP_HOT_UPDATED"}
+	want := []interface{}{ItemPointer{Offset: 2}, uint32(100), uint32(0), uint32(3), uint32(3), flags, int32(7), int32(70)}
+	if !reflect.DeepEqual(row.Values, want) {
+		t.Errorf("values = %v, want %v", row.Values, want)
+	}
+
+	info := rowTupleInfo(row)
+	if info == nil || info.Ctid != (ItemPointer{Offset: 2}) || info.Cid != 3 || len(info.Infomask) != 3 {
+		t.Errorf("rowTupleInfo = %+v", info)
+	}
+	if rowTupleInfo(testRow("id", int32(1))) != nil {
+		t.Error("rowTupleInfo of a row without system columns")
+	}
+
+	table := TableDump{
+		Name:    "t",
+		Columns: append(append([]ColumnInfo(nil), systemColumns...), ColumnInfo{Name: "id", Type: "int4", TypID: OidInt4}, ColumnInfo{Name: "v", Type: "int4", TypID: OidInt4}),
+		Rows:    rows[1:],
+	}
+	var sql bytes.Buffer
+	if err := table.ToSQL(&sql); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    _ctid TID,\n    _xmin XID,",
+		"_infomask TEXT[],",
+		"INSERT INTO t (_ctid, _xmin, _xmax, _cmin, _cmax, _infomask, id, v) VALUES",
+		"('(0,2)', 100, 0, 3, 3, ARRAY['HEAP_XMIN_COMMITTED', 'HEAP_XMAX_INVALID', 'HEAP_HOT_UPDATED'], 7, 70)",
+	} {
+		if !strings.Contains(sql.String(), want) {
+			t.Errorf("ToSQL missing %q:\n%s", want, sql.String())
+		}
+	}
+
+	results, _ := SearchInDump(&DumpResult{Databases: []DatabaseDump{{Tables: []TableDump{table}}}}, &SearchOptions{Pattern: "^(7|100|HEAP.*)$"})
+	if len(results) != 1 || results[0].Column != "id" || results[0].Tuple == nil || results[0].Tuple.Xmin != 100 {
+		t.Errorf("search results = %+v, want the id column only, with its tuple", results)
+	}
+}
@@ -9,39 +9,83 @@ import (
 
 // TableFormat writes dump results as psql-style formatted tables
 func (r *DumpResult) TableFormat(w io.Writer) {
-	for _, db := range r.Databases {
-		for _, t := range db.Tables {
-			if t.RowCount == 0 {
-				continue
-			}
-			writeTable(w, db.Name, t)
-		}
-	}
+	r.writeTo(NewTableWriter(w))
+}
+
+// NewTableWriter returns a DumpWriter producing the output of TableFormat.
+// Rows are read twice, first to size the columns.
+func NewTableWriter(w io.Writer) DumpWriter {
+	return &tableWriter{w: w}
+}
+
+type tableWriter struct {
+	w io.Writer
 }
 
-func writeTable(w io.Writer, dbName string, t TableDump) {
-	if len(t.Columns) == 0 || len(t.Rows) == 0 {
-		return
+func (tw *tableWriter) BeginDatabase(*DatabaseDump) error { return nil }
+
+func (tw *tableWriter) WriteTable(db *DatabaseDump, t *TableDump, rows *RowIterator) error {
+	return writeTable(tw.w, db.Name, t, rows)
+}
+
+func (tw *tableWriter) EndDatabase(*DatabaseDump) error { return nil }
+
+func (tw *tableWriter) Close() error { return nil }
+
+func writeTable(w io.Writer, dbName string, t *TableDump, rows *RowIterator) error {
+	if len(t.Columns) == 0 {
+		return nil
 	}
 
-	// Collect column names
+	// Collect column names, and headers naming their types
 	colNames := make([]string, len(t.Columns))
+	headers := make([]string, len(t.Columns))
 	for i, c := range t.Columns {
 		colNames[i] = c.Name
+		headers[i] = c.Name
+		if c.Type != "" {
+			headers[i] += " " + c.Type
+		}
 	}
 
 	// Calculate max width for each column
 	widths := make([]int, len(colNames))
-	for i, name := range colNames {
-		widths[i] = len(name)
+	for i, header := range headers {
+		widths[i] = len(header)
 	}
-	for _, row := range t.Rows {
+	n := 0
+	for rows.Next() {
+		row := rows.Row()
 		for i, name := range colNames {
-			val := formatCell(row[name])
+			cell, _ := row.at(i, name)
+			val := formatCell(cell)
 			if len(val) > widths[i] {
 				widths[i] = len(val)
 			}
 		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, d := range t.DeletedRows {
+		for i, name := range colNames {
+			cell, _ := d.Data.at(i, name)
+			if val := formatCell(cell); len(val) > widths[i] {
+				widths[i] = len(val)
+			}
+		}
+	}
+	count := n
+	if !rows.streaming() {
+		count = t.RowCount
+	}
+	if (n == 0 || count == 0) && len(t.DeletedRows) == 0 {
+		return nil
+	}
+	counts := fmt.Sprintf("%d rows", count)
+	if len(t.DeletedRows) > 0 {
+		counts += fmt.Sprintf(", %d deleted", len(t.DeletedRows))
 	}
 
 	// Cap column width
@@ -53,32 +97,53 @@ func writeTable(w io.Writer, dbName string, t TableDump) {
 	}
 
 	// Print header
-	fmt.Fprintf(w, "\n %s.%s (%d rows)\n", dbName, t.Name, t.RowCount)
+	fmt.Fprintf(w, "\n %s.%s (%s)\n", dbName, t.QualifiedName(), counts)
 
 	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
 
-	// Column names
-	var header []string
-	var separator []string
-	for i, name := range colNames {
+	// Column names with their types
+	var header, separator []string
+	for i, name := range headers {
 		header = append(header, fmt.Sprintf(" %-*s", widths[i], truncateCell(name, widths[i])))
 		separator = append(separator, strings.Repeat("-", widths[i]+1))
 	}
 	fmt.Fprintln(tw, strings.Join(header, " |"))
 	fmt.Fprintln(tw, strings.Join(separator, "-+"))
 
-	// Rows
-	for _, row := range t.Rows {
+	line := func(row Row) string {
 		var cells []string
 		for i, name := range colNames {
-			val := formatCell(row[name])
+			cell, _ := row.at(i, name)
+			val := formatCell(cell)
 			cells = append(cells, fmt.Sprintf(" %-*s", widths[i], truncateCell(val, widths[i])))
 		}
-		fmt.Fprintln(tw, strings.Join(cells, " |"))
+		return strings.Join(cells, " |")
+	}
+
+	// Rows, second pass
+	rows.Reset()
+	for rows.Next() {
+		fmt.Fprintln(tw, line(rows.Row()))
+		// Cells are padded to fixed widths, so lines can go out as they come
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// Deleted rows below a separator, each marked after its last cell
+	if len(t.DeletedRows) > 0 {
+		fmt.Fprintln(tw, strings.Join(separator, "-+"))
+	}
+	for _, d := range t.DeletedRows {
+		fmt.Fprintf(tw, "%s  -- deleted: ctid %s, xmin %d, xmax %d\n", line(d.Data), d.Ctid, d.Xmin, d.Xmax)
 	}
 
 	tw.Flush()
-	fmt.Fprintf(w, "(%d rows)\n\n", t.RowCount)
+	_, err := fmt.Fprintf(w, "(%s)\n\n", counts)
+	if err == nil {
+		err = rows.Err()
+	}
+	return err
 }
 
 func formatCell(v interface{}) string {
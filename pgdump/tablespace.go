@@ -0,0 +1,141 @@
+package pgdump
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Built-in tablespaces
+const (
+	PGTablespace      = 1213 // pg_tablespace - tablespaces (global)
+	DefaultTablespace = 1663 // pg_default, stored under base/
+	GlobalTablespace  = 1664 // pg_global, stored under global/
+)
+
+// TablespaceInfo represents a pg_tablespace entry
+type TablespaceInfo struct {
+	OID   uint32 `json:"oid"`
+	Name  string `json:"name"`
+	Owner uint32 `json:"owner"`
+}
+
+var schemaPGTablespace = []Column{
+	{Name: "oid", TypID: OidOid, Len: 4},
+	{Name: "spcname", TypID: OidName, Len: 64},
+	{Name: "spcowner", TypID: OidOid, Len: 4},
+}
+
+// ParsePGTablespace extracts tablespaces from pg_tablespace heap file
+func ParsePGTablespace(data []byte) []TablespaceInfo {
+	var result []TablespaceInfo
+	for _, row := range ReadRows(data, schemaPGTablespace, true) {
+		if oid, name := getOID(row, "oid"), getString(row, "spcname"); oid > 0 && name != "" {
+			result = append(result, TablespaceInfo{OID: oid, Name: name, Owner: getOID(row, "spcowner")})
+		}
+	}
+	return result
+}
+
+// Tablespaces resolves the directory of a relation from its tablespace.
+//
+// Non-default tablespaces live under pg_tblspc/<spcoid>/PG_<major>_<catver>/<dboid>.
+// pg_tblspc/<spcoid> is a symlink the reader follows transparently (the OS
+// does it for local files and for most remote file-read primitives). For
+// copied evidence where the link is broken, Remap points a tablespace OID at
+// the directory the link used to target.
+type Tablespaces struct {
+	VersionDir string            // PG_<major>_<catversion>
+	Remap      map[uint32]string // tablespace OID -> location (replaces pg_tblspc/<oid>)
+}
+
+// LoadTablespaces derives the version directory from PG_VERSION and pg_control
+func LoadTablespaces(reader RemoteReader, remap map[uint32]string) *Tablespaces {
+	t := &Tablespaces{Remap: remap}
+	data, err := reader("PG_VERSION")
+	if err != nil {
+		return t
+	}
+	major := strings.TrimSpace(string(data))
+	if ctrl, err := reader("global/pg_control"); err == nil {
+		if cf, err := ParseControlFile(ctrl); err == nil && cf.CatalogVersionNo != 0 {
+			t.VersionDir = fmt.Sprintf("PG_%s_%d", major, cf.CatalogVersionNo)
+		}
+	}
+	return t
+}
+
+// loadLocalTablespaces is LoadTablespaces for a data directory on disk. If
+// pg_control is unreadable, the version directory is taken from pg_tblspc.
+func loadLocalTablespaces(dataDir string, remap map[uint32]string) *Tablespaces {
+	t := LoadTablespaces(LocalReader(dataDir), remap)
+	if t.VersionDir == "" {
+		if matches, _ := filepath.Glob(filepath.Join(dataDir, "pg_tblspc", "*", "PG_*")); len(matches) > 0 {
+			t.VersionDir = filepath.Base(matches[0])
+		}
+	}
+	return t
+}
+
+// Dir returns the directory holding database dbOID's files in tablespace spcOID
+func (t *Tablespaces) Dir(spcOID, dbOID uint32) string {
+	switch spcOID {
+	case 0, DefaultTablespace:
+		return databaseDir(dbOID)
+	case GlobalTablespace:
+		return "global"
+	}
+	loc, versionDir := fmt.Sprintf("pg_tblspc/%d", spcOID), ""
+	if t != nil {
+		if l, ok := t.Remap[spcOID]; ok {
+			loc = strings.TrimRight(filepath.ToSlash(l), "/")
+		}
+		versionDir = t.VersionDir
+	}
+	return fmt.Sprintf("%s/%s/%d", loc, versionDir, dbOID)
+}
+
+// DatabaseDir returns the directory of a database's default tablespace,
+// where its pg_class, pg_attribute and pg_filenode.map live
+func (t *Tablespaces) DatabaseDir(db DatabaseInfo) string {
+	return t.Dir(db.Tablespace, db.OID)
+}
+
+// RelationPath returns the path of a relation's first segment. A reltablespace
+// of 0 means the database's default tablespace.
+func (t *Tablespaces) RelationPath(db DatabaseInfo, spcOID, filenode uint32) string {
+	if spcOID == 0 {
+		spcOID = db.Tablespace
+	}
+	return fmt.Sprintf("%s/%d", t.Dir(spcOID, db.OID), filenode)
+}
+
+// ParseTablespaceMap parses "oid=path" pairs separated by commas
+func ParseTablespaceMap(s string) (map[uint32]string, error) {
+	remap := make(map[uint32]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		eq := strings.IndexByte(pair, '=')
+		if eq <= 0 || eq == len(pair)-1 {
+			return nil, fmt.Errorf("invalid tablespace mapping %q (want oid=path)", pair)
+		}
+		oid, err := strconv.ParseUint(pair[:eq], 10, 32)
+		if err != nil || oid == 0 {
+			return nil, fmt.Errorf("invalid tablespace OID in %q", pair)
+		}
+		remap[uint32(oid)] = pair[eq+1:]
+	}
+	return remap, nil
+}
+
+// ListTablespaces returns tablespaces from a data directory
+func ListTablespaces(dataDir string) []TablespaceInfo {
+	data, err := ReadGlobalCatalog(dataDir, PGTablespace)
+	if err != nil {
+		return nil
+	}
+	return ParsePGTablespace(data)
+}
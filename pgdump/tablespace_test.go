@@ -0,0 +1,158 @@
+package pgdump
+
+import "testing"
+
+func testTablespaceRow(oid uint32, name string) []byte {
+	row := make([]byte, 72)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, 10)
+	return testHeapTuple(3, row)
+}
+
+// testDatabaseRow builds a pg_database tuple in the PG15+ layout
+func testDatabaseRow(oid uint32, name string, spc uint32) []byte {
+	row := make([]byte, 96)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 72, PGEncUTF8)
+	row[76] = 'c' // datlocprovider
+	row[78] = 1   // datallowconn
+	putU32(row, 80, 0xFFFFFFFF)
+	putU32(row, 92, spc)
+	return testHeapTuple(11, row)
+}
+
+func TestParsePGTablespace(t *testing.T) {
+	data := testHeapPage(
+		testTablespaceRow(DefaultTablespace, "pg_default"),
+		testTablespaceRow(GlobalTablespace, "pg_global"),
+		testTablespaceRow(16400, "fast_ssd"),
+	)
+
+	spcs := ParsePGTablespace(data)
+	if len(spcs) != 3 {
+		t.Fatalf("expected 3 tablespaces, got %d", len(spcs))
+	}
+	if spcs[2].OID != 16400 || spcs[2].Name != "fast_ssd" || spcs[2].Owner != 10 {
+		t.Errorf("unexpected tablespace: %+v", spcs[2])
+	}
+}
+
+func TestParsePGDatabaseTablespace(t *testing.T) {
+	// PG12-14: datcollate/datctype names, dattablespace at offset 224
+	v14 := make([]byte, 228)
+	putU32(v14, 0, 16384)
+	copy(v14[4:], testName("legacy"))
+	putU32(v14, 72, PGEncUTF8)
+	copy(v14[76:], testName("C"))
+	copy(v14[140:], testName("C"))
+	putU32(v14, 224, 16400)
+
+	data := testHeapPage(
+		testHeapTuple(13, v14),
+		testDatabaseRow(16385, "modern", DefaultTablespace),
+	)
+
+	dbs := ParsePGDatabase(data)
+	if len(dbs) != 2 {
+		t.Fatalf("expected 2 databases, got %d", len(dbs))
+	}
+	for _, db := range dbs {
+		switch db.Name {
+		case "legacy":
+			if db.Tablespace != 16400 {
+				t.Errorf("legacy: Tablespace = %d, want 16400", db.Tablespace)
+			}
+		case "modern":
+			if db.Tablespace != DefaultTablespace || db.Encoding != PGEncUTF8 {
+				t.Errorf("modern: got %+v", db)
+			}
+		default:
+			t.Errorf("unexpected database %q", db.Name)
+		}
+	}
+}
+
+func TestTablespacesRelationPath(t *testing.T) {
+	spaces := &Tablespaces{VersionDir: "PG_16_202307071", Remap: map[uint32]string{16401: "/evidence/ts2/"}}
+	db := DatabaseInfo{OID: 16384, Tablespace: DefaultTablespace}
+	moved := DatabaseInfo{OID: 16385, Tablespace: 16400}
+
+	tests := []struct {
+		db      DatabaseInfo
+		spc, fn uint32
+		want    string
+	}{
+		{db, 0, 16500, "base/16384/16500"},
+		{db, DefaultTablespace, 16500, "base/16384/16500"},
+		{db, 16400, 16500, "pg_tblspc/16400/PG_16_202307071/16384/16500"},
+		{db, 16401, 16500, "/evidence/ts2/PG_16_202307071/16384/16500"},
+		{moved, 0, 1259, "pg_tblspc/16400/PG_16_202307071/16385/1259"},
+		{moved, DefaultTablespace, 16500, "base/16385/16500"},
+		{DatabaseInfo{OID: 1}, 0, 1259, "base/1/1259"},
+	}
+	for _, tt := range tests {
+		if got := spaces.RelationPath(tt.db, tt.spc, tt.fn); got != tt.want {
+			t.Errorf("RelationPath(%d, %d, %d) = %q, want %q", tt.db.OID, tt.spc, tt.fn, got, tt.want)
+		}
+	}
+}
+
+func TestParseTablespaceMap(t *testing.T) {
+	remap, err := ParseTablespaceMap("16400=/mnt/ts1, 16401=/mnt/ts2")
+	if err != nil {
+		t.Fatalf("ParseTablespaceMap failed: %v", err)
+	}
+	if len(remap) != 2 || remap[16400] != "/mnt/ts1" || remap[16401] != "/mnt/ts2" {
+		t.Errorf("unexpected map: %v", remap)
+	}
+
+	if remap, err := ParseTablespaceMap(""); err != nil || len(remap) != 0 {
+		t.Errorf("empty map: got %v, %v", remap, err)
+	}
+	for _, bad := range []string{"16400", "=/mnt", "abc=/mnt", "16400=", "0=/mnt"} {
+		if _, err := ParseTablespaceMap(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestDumpDataDirTablespace(t *testing.T) {
+	dir := t.TempDir()
+	tsDir := t.TempDir()
+
+	control := make([]byte, 300)
+	putU32(control, 12, 202307071)
+	testWriteFile(t, dir, "PG_VERSION", []byte("16\n"))
+	testWriteFile(t, dir, "global/pg_control", control)
+	testWriteFile(t, dir, "global/1262", testHeapPage(testDatabaseRow(16384, "app", DefaultTablespace)))
+	testWriteFile(t, dir, "base/16384/1259", testHeapPage(
+		testClassRow(16500, "local_t", 2200, 16500, 'r'),
+		testClassRowIn(16400, 16501, "remote_t", 2200, 16501, 'r'),
+	))
+
+	// remote_t only exists in the relocated tablespace copy
+	testWriteFile(t, tsDir, "PG_16_202307071/16384/16501", testHeapPage(testHeapTuple(1, []byte{1, 0, 0, 0})))
+
+	dump := func(remap map[uint32]string) map[string]bool {
+		result, err := DumpDataDir(dir, &Options{SkipSystemTables: true, TablespaceMap: remap})
+		if err != nil {
+			t.Fatalf("DumpDataDir failed: %v", err)
+		}
+		found := make(map[string]bool)
+		for _, db := range result.Databases {
+			for _, tbl := range db.Tables {
+				found[tbl.Name] = tbl.RowCount > 0
+			}
+		}
+		return found
+	}
+
+	if found := dump(nil); found["remote_t"] {
+		t.Error("remote_t should have no rows without the tablespace")
+	}
+	if found := dump(map[uint32]string{16400: tsDir}); !found["remote_t"] {
+		t.Errorf("remote_t rows not read from remapped tablespace: %v", found)
+	}
+}
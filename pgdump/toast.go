@@ -6,10 +6,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/pierrec/lz4/v4"
 )
@@ -306,8 +306,10 @@ func decompressLZ4(data []byte, rawSize int) ([]byte, error) {
 	return result[:n], nil
 }
 
-// TOASTReader provides TOAST-aware value reading
+// TOASTReader provides TOAST-aware value reading. It is safe for concurrent
+// use, so tables decoded in parallel can share one reader.
 type TOASTReader struct {
+	mu       sync.RWMutex
 	chunks   map[uint32][]TOASTChunk // keyed by ToastRelID
 	dataDir  string
 	dbOID    uint32
@@ -331,7 +333,25 @@ func NewTOASTReaderForDB(dataDir string, dbOID uint32) *TOASTReader {
 
 // LoadTOASTTable loads chunks from a TOAST table
 func (r *TOASTReader) LoadTOASTTable(toastRelID uint32, data []byte) {
-	r.chunks[toastRelID] = ReadTOASTTable(data)
+	chunks := ReadTOASTTable(data)
+	r.mu.Lock()
+	r.chunks[toastRelID] = chunks
+	r.mu.Unlock()
+}
+
+// loaded reports whether a TOAST table's chunks are already loaded
+func (r *TOASTReader) loaded(toastRelID uint32) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.chunks[toastRelID]
+	return ok
+}
+
+// release drops every loaded chunk
+func (r *TOASTReader) release() {
+	r.mu.Lock()
+	r.chunks = make(map[uint32][]TOASTChunk)
+	r.mu.Unlock()
 }
 
 // LoadTOASTTableFromFile loads a TOAST table from the data directory
@@ -343,7 +363,7 @@ func (r *TOASTReader) LoadTOASTTableFromFile(toastRelID uint32) error {
 	basePath := filepath.Join(r.dataDir, "base", strconv.FormatUint(uint64(r.dbOID), 10))
 	toastPath := filepath.Join(basePath, strconv.FormatUint(uint64(toastRelID), 10))
 	
-	data, err := os.ReadFile(toastPath)
+	data, err := ReadRelationFile(toastPath, relationSegmentSize(LocalReader(r.dataDir)))
 	if err != nil {
 		return err
 	}
@@ -360,13 +380,13 @@ func (r *TOASTReader) ReadValue(data []byte) []byte {
 	}
 
 	// Try to load TOAST table if not already loaded
-	if _, ok := r.chunks[ptr.ToastRelID]; !ok {
-		if r.dataDir != "" {
-			r.LoadTOASTTableFromFile(ptr.ToastRelID)
-		}
+	if !r.loaded(ptr.ToastRelID) && r.dataDir != "" {
+		r.LoadTOASTTableFromFile(ptr.ToastRelID)
 	}
 
+	r.mu.RLock()
 	chunks, ok := r.chunks[ptr.ToastRelID]
+	r.mu.RUnlock()
 	if !ok {
 		return nil
 	}
@@ -472,25 +492,27 @@ func GetTOASTVerboseInfo(toastRelID uint32, data []byte) *TOASTVerboseInfo {
 // AnalyzeTOAST analyzes TOAST usage for a database
 func AnalyzeTOAST(dataDir, dbName string) ([]TOASTInfo, error) {
 	// Find database OID
-	dbData, err := os.ReadFile(filepath.Join(dataDir, "global", "1262"))
+	dbData, err := ReadGlobalCatalog(dataDir, PGDatabase)
 	if err != nil {
 		return nil, err
 	}
 	
-	dbOID := FindDatabaseOID(dbData, dbName)
-	if dbOID == 0 {
+	db := FindDatabase(dbData, dbName)
+	if db == nil {
 		return nil, fmt.Errorf("database %q not found", dbName)
 	}
 
-	basePath := filepath.Join(dataDir, "base", strconv.FormatUint(uint64(dbOID), 10))
+	local := LocalReader(dataDir)
+	spaces := loadLocalTablespaces(dataDir, nil)
 
 	// Read pg_class to find TOAST tables
-	classData, err := os.ReadFile(filepath.Join(basePath, "1259"))
+	classData, err := ReadDatabaseCatalog(dataDir, *db, PGClass)
 	if err != nil {
 		return nil, err
 	}
 	
 	var results []TOASTInfo
+	segSize := relationSegmentSize(local)
 	
 	// Parse pg_class with extended schema to get reltoastrelid
 	for _, entry := range ReadTuples(classData, true) {
@@ -507,8 +529,7 @@ func AnalyzeTOAST(dataDir, dbName string) ([]TOASTInfo, error) {
 		}
 		
 		// Try to read the TOAST table
-		toastPath := filepath.Join(basePath, strconv.FormatUint(uint64(toastRelID), 10))
-		toastData, err := os.ReadFile(toastPath)
+		toastData, err := ReadRelation(local, spaces.RelationPath(*db, 0, toastRelID), segSize)
 		if err != nil {
 			continue
 		}
@@ -1,5 +1,10 @@
 package pgdump
 
+import (
+	"fmt"
+	"time"
+)
+
 const tupleHeaderSize = 23
 
 // HeapTupleHeader contains tuple metadata
@@ -13,6 +18,36 @@ type HeapTupleHeader struct {
 	XmaxInvalid   bool
 	XmaxCommitted bool
 	HasNull       bool
+
+	// Ctid points to the tuple itself, or to its newer version once an
+	// UPDATE committed or not
+	Ctid ItemPointer
+
+	// HotUpdated is set when the newer version is a heap-only tuple on the
+	// same page, HeapOnly on that newer version (infomask2)
+	HotUpdated bool
+	HeapOnly   bool
+
+	// Cid is the command ID within the inserting or deleting transaction,
+	// shown as both cmin and cmax
+	Cid       uint32
+	Infomask2 uint16
+}
+
+// ItemPointer is a tuple's physical location, as in the ctid system column
+type ItemPointer struct {
+	Block  uint32
+	Offset uint16 // line pointer number on the page, from 1
+}
+
+// String formats the pointer as PostgreSQL's tid type does: "(0,1)"
+func (p ItemPointer) String() string {
+	return fmt.Sprintf("(%d,%d)", p.Block, p.Offset)
+}
+
+// MarshalText writes the pointer in its text form in JSON
+func (p ItemPointer) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
 }
 
 // HeapTupleData represents a complete tuple
@@ -48,6 +83,11 @@ func ParseHeapTuple(data []byte) *HeapTupleData {
 		XminCommitted: infomask&0x0100 != 0,
 		XmaxCommitted: infomask&0x0400 != 0,
 		XmaxInvalid:   infomask&0x0800 != 0,
+		Ctid:          ItemPointer{Block: uint32(u16(data, 12))<<16 | uint32(u16(data, 14)), Offset: u16(data, 16)},
+		HotUpdated:    infomask2&heapHotUpdated != 0,
+		HeapOnly:      infomask2&heapOnlyTuple != 0,
+		Cid:           u32(data, 8),
+		Infomask2:     infomask2,
 	}
 
 	tuple := &HeapTupleData{
@@ -65,23 +105,207 @@ func ParseHeapTuple(data []byte) *HeapTupleData {
 	return tuple
 }
 
-// IsVisible checks if tuple is visible.
+// Infomask bits beyond the hint bits decoded in HeapTupleHeader (htup_details.h)
+const (
+	heapXmaxKeyshrLock = 0x0010
+	heapXmaxExclLock   = 0x0040
+	heapXmaxLockOnly   = 0x0080
+	heapXminInvalid    = 0x0200
+	heapXmaxIsMulti    = 0x1000
+	heapUpdated        = 0x2000
+
+	// infomask2
+	heapHotUpdated = 0x4000
+	heapOnlyTuple  = 0x8000
+)
+
+// tupleFlag names an infomask bit, as pageinspect's
+// heap_tuple_infomask_flags does
+type tupleFlag struct {
+	bit  uint16
+	name string
+}
+
+var infomaskFlags = []tupleFlag{
+	{0x0001, "HEAP_HASNULL"}, {0x0002, "HEAP_HASVARWIDTH"}, {0x0004, "HEAP_HASEXTERNAL"},
+	{0x0008, "HEAP_HASOID_OLD"}, {0x0010, "HEAP_XMAX_KEYSHR_LOCK"}, {0x0020, "HEAP_COMBOCID"},
+	{0x0040, "HEAP_XMAX_EXCL_LOCK"}, {0x0080, "HEAP_XMAX_LOCK_ONLY"}, {0x0100, "HEAP_XMIN_COMMITTED"},
+	{0x0200, "HEAP_XMIN_INVALID"}, {0x0400, "HEAP_XMAX_COMMITTED"}, {0x0800, "HEAP_XMAX_INVALID"},
+	{0x1000, "HEAP_XMAX_IS_MULTI"}, {0x2000, "HEAP_UPDATED"}, {0x4000, "HEAP_MOVED_OFF"},
+	{0x8000, "HEAP_MOVED_IN"},
+}
+
+var infomask2Flags = []tupleFlag{
+	{0x2000, "HEAP_KEYS_UPDATED"}, {heapHotUpdated, "HEAP_HOT_UPDATED"}, {heapOnlyTuple, "HEAP_ONLY_TUPLE"},
+}
+
+// Flags returns the names of the infomask and infomask2 bits set
+func (h *HeapTupleHeader) Flags() []string {
+	return infomaskFlagNames(h.Infomask, h.Infomask2)
+}
+
+func infomaskFlagNames(infomask, infomask2 uint16) []string {
+	var flags []string
+	for _, f := range infomaskFlags {
+		if infomask&f.bit != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	for _, f := range infomask2Flags {
+		if infomask2&f.bit != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// IsVisible checks if tuple is visible from its hint bits alone.
 // Without access to PostgreSQL's CLOG, we cannot confirm xmin committed status
 // (hint bits may not be set for recently inserted or VACUUM FULL'd tuples).
 // Instead, accept all tuples that are not provably dead.
 func (t *HeapTupleData) IsVisible() bool {
+	return t.IsVisibleWithCommitLog(nil)
+}
+
+// IsVisibleWithCommitLog is IsVisible looking up transactions that have no
+// hint bits yet in clog, so rows of aborted inserts are dropped and rows
+// whose delete aborted are kept. Transactions clog cannot resolve are
+// judged as IsVisible does.
+func (t *HeapTupleData) IsVisibleWithCommitLog(clog *CommitLog) bool {
+	switch t.XminStatus(clog) {
+	case TxAborted, TxInProgress:
+		return false
+	}
+	// Unknown: xmax set (targeted by DELETE/UPDATE) and no hint bits yet
+	switch t.XmaxStatus(clog) {
+	case TxCommitted, TxUnknown:
+		return false
+	}
+	return true
+}
+
+// Snapshot is a past point to reproduce table contents at: the start of
+// transaction XID, a commit time, or both
+type Snapshot struct {
+	// XID sees the transactions before it, in XID order. A transaction
+	// that started earlier but committed after XID started is counted as
+	// seen, which the XID alone cannot tell apart.
+	XID uint32
+
+	// Time sees the transactions committed at or before it, by their
+	// pg_commit_ts timestamp. Transactions without one (committed before
+	// track_commit_timestamp was on) are counted as seen.
+	Time time.Time
+}
+
+// IsVisibleAsOf reports whether the tuple was visible at snap: inserted by
+// a transaction committed before it, and not deleted by one. Rows deleted
+// since, but not yet vacuumed, are visible again.
+func (t *HeapTupleData) IsVisibleAsOf(clog *CommitLog, snap Snapshot) bool {
 	h := t.Header
-	// Provably dead: xmax is committed and not invalid
-	if h.XmaxCommitted && !h.XmaxInvalid {
+	switch t.XminStatus(clog) {
+	case TxAborted, TxInProgress:
+		return false
+	}
+	// A frozen xmin may be from before XID wraparound, so it is not compared
+	if !t.xminFrozen() && !snap.sees(clog, h.Xmin) {
 		return false
 	}
-	// Provably dead: xmax set (targeted by DELETE/UPDATE) and no hint bits yet
-	if h.Xmax != 0 && !h.XmaxInvalid {
+
+	switch t.XmaxStatus(clog) {
+	case TxAborted, TxInProgress:
+		return true
+	}
+	if h.Infomask&heapXmaxIsMulti != 0 && !h.XmaxCommitted {
+		return false // a multixact ID, not comparable; as IsVisible
+	}
+	return !snap.sees(clog, h.Xmax)
+}
+
+// sees reports whether a transaction that committed is part of the snapshot
+func (s Snapshot) sees(clog *CommitLog, xid uint32) bool {
+	if xid < firstNormalXid {
+		return true
+	}
+	if s.XID != 0 && int32(xid-s.XID) >= 0 {
 		return false
 	}
+	if !s.Time.IsZero() {
+		if ts, ok := clog.CommitTime(xid); ok && ts.After(s.Time) {
+			return false
+		}
+	}
 	return true
 }
 
+// xminFrozen reports whether VACUUM froze the tuple (both xmin hint bits)
+func (t *HeapTupleData) xminFrozen() bool {
+	return t.Header.XminCommitted && t.Header.Infomask&heapXminInvalid != 0
+}
+
+// orderXmin is the xmin to order tuples by: the frozen XID once VACUUM
+// froze the tuple, as its own xmin may be from before XID wraparound
+func (t *HeapTupleData) orderXmin() uint32 {
+	if t.xminFrozen() {
+		return firstNormalXid - 1
+	}
+	return t.Header.Xmin
+}
+
+// xminPrecedes reports whether t was inserted before u
+func (t *HeapTupleData) xminPrecedes(u *HeapTupleData) bool {
+	return xidPrecedes(t.orderXmin(), u.orderXmin())
+}
+
+// supersedes reports whether t is a later version of a catalog entry than
+// prev. Versions an aborted transaction wrote come after all others, which
+// never saw them; then the later xmin wins.
+func (t *HeapTupleData) supersedes(prev *HeapTupleData, clog *CommitLog) bool {
+	aborted, prevAborted := t.XminStatus(clog) == TxAborted, prev.XminStatus(clog) == TxAborted
+	if aborted != prevAborted {
+		return prevAborted
+	}
+	return !t.xminPrecedes(prev)
+}
+
+// XminStatus returns the status of the transaction that inserted the tuple
+func (t *HeapTupleData) XminStatus(clog *CommitLog) TxStatus {
+	h := t.Header
+	switch {
+	case h.XminCommitted: // also set on frozen tuples
+		return TxCommitted
+	case h.Infomask&heapXminInvalid != 0:
+		return TxAborted
+	}
+	return clog.Status(h.Xmin)
+}
+
+// XmaxStatus returns the status of the transaction that deleted or updated
+// the tuple. Like the XMAX_INVALID hint bit, it is TxAborted when no
+// transaction did, including when xmax only locked the row.
+func (t *HeapTupleData) XmaxStatus(clog *CommitLog) TxStatus {
+	h := t.Header
+	switch {
+	case h.XmaxInvalid, t.xmaxLockOnly():
+		return TxAborted
+	case h.XmaxCommitted:
+		return TxCommitted
+	case h.Xmax == 0:
+		return TxAborted
+	case h.Infomask&heapXmaxIsMulti != 0:
+		// The updater is in pg_multixact, which is not read
+		return TxUnknown
+	}
+	return clog.Status(h.Xmax)
+}
+
+// xmaxLockOnly reports whether xmax is a row lock (SELECT ... FOR UPDATE)
+// rather than a delete, as HEAP_XMAX_IS_LOCKED_ONLY does
+func (t *HeapTupleData) xmaxLockOnly() bool {
+	m := t.Header.Infomask
+	return m&heapXmaxLockOnly != 0 || m&(heapXmaxIsMulti|heapXmaxExclLock|heapXmaxKeyshrLock) == heapXmaxExclLock
+}
+
 // IsNull checks if attribute at position is null (1-indexed)
 func (t *HeapTupleData) IsNull(attnum int) bool {
 	if t.Bitmap == nil || attnum <= 0 {
@@ -1,9 +1,11 @@
 package pgdump
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"strings"
 	"time"
@@ -71,6 +73,12 @@ const (
 	// pg_lsn
 	OidPgLsn = 3220
 
+	// anyarray (pg_statistic, attmissingval): element type is in the array header
+	OidAnyArray = 2277
+
+	// regclass, the OID of a relation (nextval('seq'::regclass))
+	OidRegclass = 2205
+
 	// Text search
 	OidTsvector = 3614
 	OidTsquery  = 3615
@@ -147,18 +155,103 @@ func TypeName(oid int) string {
 	return fmt.Sprintf("oid:%d", oid)
 }
 
+// FormatType renders a column type with its modifier and array dimensions,
+// e.g. varchar(255), numeric(12,2) or timestamp(3)[]
+func FormatType(oid, typmod, ndims int) string {
+	return (*TypeCatalog)(nil).FormatType(oid, typmod, ndims)
+}
+
+// withTypeModifier appends atttypmod to the built-in types that take one.
+// typmod is -1 when the column was declared without a modifier.
+func withTypeModifier(name string, oid, typmod int) string {
+	if typmod < 0 {
+		return name
+	}
+	switch oid {
+	case OidVarchar:
+		if typmod >= 4 {
+			return fmt.Sprintf("varchar(%d)", typmod-4)
+		}
+	case OidBpchar:
+		if typmod >= 4 {
+			return fmt.Sprintf("char(%d)", typmod-4)
+		}
+	case OidNumeric:
+		if typmod >= 4 {
+			// precision in the high 16 bits, scale in the low 11 (signed)
+			m := typmod - 4
+			precision, scale := (m>>16)&0xFFFF, ((m&0x7FF)^1024)-1024
+			return fmt.Sprintf("numeric(%d,%d)", precision, scale)
+		}
+	case OidTimestamp, OidTimestampTZ, OidTime, OidTimeTZ, OidBit, OidVarbit:
+		return fmt.Sprintf("%s(%d)", name, typmod)
+	case OidInterval:
+		// the field restriction in the high 16 bits, the precision below
+		if fields, ok := intervalFields[typmod>>16&0x7FFF]; ok {
+			name += " " + fields
+		}
+		if precision := typmod & 0xFFFF; precision != 0xFFFF {
+			return fmt.Sprintf("%s(%d)", name, precision)
+		}
+	}
+	return name
+}
+
+// Interval field bits of an interval typmod's range (datetime.h)
+const (
+	intervalMonth  = 1 << 1
+	intervalYear   = 1 << 2
+	intervalDay    = 1 << 3
+	intervalHour   = 1 << 10
+	intervalMinute = 1 << 11
+	intervalSecond = 1 << 12
+)
+
+// intervalFields renders the field restrictions interval accepts, as
+// intervaltypmodout does
+var intervalFields = map[int]string{
+	intervalYear:                 "year",
+	intervalMonth:                "month",
+	intervalDay:                  "day",
+	intervalHour:                 "hour",
+	intervalMinute:               "minute",
+	intervalSecond:               "second",
+	intervalYear | intervalMonth: "year to month",
+	intervalDay | intervalHour:   "day to hour",
+	intervalDay | intervalHour | intervalMinute:                  "day to minute",
+	intervalDay | intervalHour | intervalMinute | intervalSecond: "day to second",
+	intervalHour | intervalMinute:                                "hour to minute",
+	intervalHour | intervalMinute | intervalSecond:               "hour to second",
+	intervalMinute | intervalSecond:                              "minute to second",
+}
+
 // DecodeType decodes PostgreSQL binary data to Go value
 func DecodeType(data []byte, oid int) interface{} {
+	return decodeType(data, oid, nil)
+}
+
+// decodeType is DecodeType with user-defined types resolved through the
+// decoder's catalog and timestamptz shown in its time zone
+func decodeType(data []byte, oid int, d *rowDecoder) interface{} {
 	if len(data) == 0 {
 		return nil
 	}
 	if elemOid, ok := arrayElemTypes[oid]; ok {
-		return decodeArray(data, elemOid)
+		return decodeArray(data, elemOid, d)
+	}
+	if oid == OidAnyArray && len(data) >= 12 {
+		return decodeArray(data, int(u32(data, 8)), d)
+	}
+	if _, builtin := typeNames[oid]; !builtin && d.catalog() != nil {
+		if v, ok := d.types.decode(data, oid, d); ok {
+			return v
+		}
 	}
-	return decodeScalar(data, oid)
+	return decodeScalar(data, oid, d.location())
 }
 
-func decodeScalar(data []byte, oid int) interface{} {
+// decodeScalar decodes a built-in type. timestamptz is shown in loc.
+func decodeScalar(data []byte, oid int, loc *time.Location) interface{} {
 	switch oid {
 	// Boolean
 	case OidBool:
@@ -191,17 +284,24 @@ func decodeScalar(data []byte, oid int) interface{} {
 	// Money (int64 in cents)
 	case OidMoney:
 		cents := i64(data, 0)
-		return fmt.Sprintf("$%.2f", float64(cents)/100)
+		if cents < 0 {
+			return fmt.Sprintf("-$%d.%02d", -(cents / 100), -(cents % 100))
+		}
+		return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
 
 	// Text types
 	case OidText, OidVarchar, OidBpchar, OidXML, OidJSONPath:
 		return safeString(data)
 	
-	// JSON (stored as text, parse it)
+	// JSON (stored as text, parse it, keeping the digits of numbers)
 	case OidJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
 		var v interface{}
-		if err := json.Unmarshal(data, &v); err == nil {
-			return v
+		if err := dec.Decode(&v); err == nil {
+			if _, err := dec.Token(); err == io.EOF {
+				return v
+			}
 		}
 		return safeString(data)
 	case OidBytea:
@@ -213,16 +313,18 @@ func decodeScalar(data []byte, oid int) interface{} {
 
 	// Date/Time
 	case OidDate:
-		return pgEpoch.AddDate(0, 0, int(i32(data, 0))).Format("2006-01-02")
+		return formatDate(i32(data, 0))
 	case OidTime:
-		us := i64(data, 0)
-		return fmt.Sprintf("%02d:%02d:%02d", us/3600e6, (us/60e6)%60, (us/1e6)%60)
+		return formatTime(i64(data, 0))
 	case OidTimeTZ:
-		us := i64(data, 0)
-		tz := i32(data, 8) // timezone offset in seconds
-		return fmt.Sprintf("%02d:%02d:%02d%+03d", us/3600e6, (us/60e6)%60, (us/1e6)%60, -tz/3600)
-	case OidTimestamp, OidTimestampTZ:
-		return pgEpoch.Add(time.Duration(i64(data, 0)) * time.Microsecond).Format("2006-01-02 15:04:05")
+		return formatTimeTZ(i64(data, 0), i32(data, 8))
+	case OidTimestamp:
+		return formatTimestamp(i64(data, 0), nil)
+	case OidTimestampTZ:
+		if loc == nil {
+			loc = time.UTC
+		}
+		return formatTimestamp(i64(data, 0), loc)
 	case OidInterval:
 		return decodeInterval(data)
 
@@ -273,7 +375,7 @@ func decodeScalar(data []byte, oid int) interface{} {
 
 	// Range types
 	case OidInt4Range, OidInt8Range, OidNumRange, OidTsRange, OidTsTzRange, OidDateRange:
-		return decodeRange(data, oid)
+		return decodeRange(data, oid, loc)
 
 	default:
 		return safeString(data)
@@ -333,7 +435,7 @@ func decodeBitString(data []byte) string {
 	return sb.String()
 }
 
-func decodeRange(data []byte, oid int) string {
+func decodeRange(data []byte, oid int, loc *time.Location) string {
 	// PostgreSQL range format (after varlena header):
 	// - range type OID: 4 bytes
 	// - lower bound (if present): fixed size based on element type
@@ -395,20 +497,21 @@ func decodeRange(data []byte, oid int) string {
 		if offset+elemSize > dataEnd {
 			return "[?,?]"
 		}
-		lb = fmt.Sprintf("%v", DecodeType(data[offset:offset+elemSize], elemOid))
+		lb = rangeBound(fmt.Sprintf("%v", decodeScalar(data[offset:offset+elemSize], elemOid, loc)))
 		offset += elemSize
 	}
 
 	// Read upper bound if present (may need alignment)
 	if !ubInf {
-		// Align offset for upper bound
+		// Align offset for upper bound, as in memory after the 4-byte
+		// varlena header
 		if elemSize > 1 {
-			offset = align(offset, elemSize)
+			offset = align(offset+4, elemSize) - 4
 		}
 		if offset+elemSize > dataEnd {
 			return "[?,?]"
 		}
-		ub = fmt.Sprintf("%v", DecodeType(data[offset:offset+elemSize], elemOid))
+		ub = rangeBound(fmt.Sprintf("%v", decodeScalar(data[offset:offset+elemSize], elemOid, loc)))
 	}
 
 	// Format output
@@ -436,6 +539,16 @@ func decodeRange(data []byte, oid int) string {
 	return result.String()
 }
 
+// rangeBound quotes a bound as range_out does when it would not parse back
+// on its own, e.g. a timestamp with its space
+func rangeBound(s string) string {
+	if s != "" && !strings.ContainsAny(s, "\"\\()[], \t\n\r\v\f") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
 func decodeNumericRange(data []byte, flags byte) string {
 	// Numeric ranges have variable-length bounds, more complex to parse
 	// For now, return a simplified representation
@@ -477,32 +590,9 @@ func decodeNumericRange(data []byte, flags byte) string {
 
 func decodeInterval(data []byte) string {
 	if len(data) < 16 {
-		return "0"
-	}
-	us, days, months := i64(data, 0), i32(data, 8), i32(data, 12)
-	var parts []string
-	if y := months / 12; y > 0 {
-		parts = append(parts, fmt.Sprintf("%dy", y))
-	}
-	if m := months % 12; m > 0 {
-		parts = append(parts, fmt.Sprintf("%dmo", m))
-	}
-	if days > 0 {
-		parts = append(parts, fmt.Sprintf("%dd", days))
+		return "00:00:00"
 	}
-	if h := us / 3600e6; h > 0 {
-		parts = append(parts, fmt.Sprintf("%dh", h))
-	}
-	if m := (us / 60e6) % 60; m > 0 {
-		parts = append(parts, fmt.Sprintf("%dm", m))
-	}
-	if s := (us / 1e6) % 60; s > 0 {
-		parts = append(parts, fmt.Sprintf("%ds", s))
-	}
-	if len(parts) == 0 {
-		return "0"
-	}
-	return strings.Join(parts, " ")
+	return formatInterval(i64(data, 0), i32(data, 8), i32(data, 12))
 }
 
 func decodeInet(data []byte) string {
@@ -558,7 +648,7 @@ func decodeInet(data []byte) string {
 	return fmt.Sprintf("inet:%x", data)
 }
 
-func decodeArray(raw []byte, elemOid int) []interface{} {
+func decodeArray(raw []byte, elemOid int, d *rowDecoder) []interface{} {
 	if len(raw) < 20 {
 		return nil
 	}
@@ -584,7 +674,10 @@ func decodeArray(raw []byte, elemOid int) []interface{} {
 	}
 
 	elemLen, fixed := fixedLengths[elemOid]
-	elem := arrayElemType{oid: elemOid, len: elemLen, fixed: fixed}
+	if !fixed {
+		elemLen, fixed = d.catalog().fixedLength(elemOid)
+	}
+	elem := arrayElemType{oid: elemOid, len: elemLen, fixed: fixed, dec: d}
 	return parseArrayElements(raw, int(dataStart), int(total), elem, nullBitmap)
 }
 
@@ -592,6 +685,7 @@ type arrayElemType struct {
 	oid   int
 	len   int
 	fixed bool
+	dec   *rowDecoder
 }
 
 func parseArrayElements(raw []byte, off, count int, elem arrayElemType, nulls []byte) []interface{} {
@@ -605,7 +699,7 @@ func parseArrayElements(raw []byte, off, count int, elem arrayElemType, nulls []
 			if off+elem.len > len(raw) {
 				break
 			}
-			elems = append(elems, DecodeType(raw[off:off+elem.len], elem.oid))
+			elems = append(elems, decodeType(raw[off:off+elem.len], elem.oid, elem.dec))
 			off += elem.len
 		} else {
 			if i > 0 {
@@ -616,14 +710,14 @@ func parseArrayElements(raw []byte, off, count int, elem arrayElemType, nulls []
 			}
 			if hdr := raw[off]; hdr&1 == 1 {
 				n := int(hdr >> 1)
-				elems = append(elems, DecodeType(raw[off+1:off+n], elem.oid))
+				elems = append(elems, decodeType(raw[off+1:off+n], elem.oid, elem.dec))
 				off += n
 			} else {
 				if off+4 > len(raw) {
 					break
 				}
 				n := int(u32(raw, off) >> 2)
-				elems = append(elems, DecodeType(raw[off+4:off+n], elem.oid))
+				elems = append(elems, decodeType(raw[off+4:off+n], elem.oid, elem.dec))
 				off += n
 			}
 		}
@@ -0,0 +1,331 @@
+package pgdump
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type catalogs and pseudo-types used to resolve user-defined types
+const (
+	PGType = 1247 // pg_type - data types (mapped)
+	PGEnum = 3501 // pg_enum - enum labels
+
+	OidRecord = 2249 // record pseudo-type, the row type is stored in the datum
+)
+
+// typtype values
+const (
+	typTypeComposite = 'c'
+	typTypeDomain    = 'd'
+	typTypeEnum      = 'e'
+)
+
+// TypeInfo represents a pg_type entry
+type TypeInfo struct {
+	OID       uint32
+	Name      string
+	Namespace uint32
+	Len       int    // typlen, -1 = varlena, -2 = cstring
+	Type      byte   // typtype: b=base, c=composite, d=domain, e=enum, p=pseudo, r=range
+	RelID     uint32 // typrelid, the pg_class entry of a composite type
+	Elem      uint32 // typelem, element type of an array
+	BaseType  uint32 // typbasetype, underlying type of a domain
+	TypMod    int    // typtypmod, typmod applied to the domain's base type
+}
+
+// pg_type layouts up to typtypmod
+var (
+	// PostgreSQL 12-13
+	schemaPGTypeV12 = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "typname", TypID: OidName, Len: 64},
+		{Name: "typnamespace", TypID: OidOid, Len: 4},
+		{Name: "typowner", TypID: OidOid, Len: 4},
+		{Name: "typlen", TypID: OidInt2, Len: 2},
+		{Name: "typbyval", TypID: OidBool, Len: 1},
+		{Name: "typtype", TypID: OidChar, Len: 1},
+		{Name: "typcategory", TypID: OidChar, Len: 1},
+		{Name: "typispreferred", TypID: OidBool, Len: 1},
+		{Name: "typisdefined", TypID: OidBool, Len: 1},
+		{Name: "typdelim", TypID: OidChar, Len: 1},
+		{Name: "typrelid", TypID: OidOid, Len: 4},
+		{Name: "typelem", TypID: OidOid, Len: 4},
+		{Name: "typarray", TypID: OidOid, Len: 4},
+		{Name: "typinput", TypID: OidOid, Len: 4},
+		{Name: "typoutput", TypID: OidOid, Len: 4},
+		{Name: "typreceive", TypID: OidOid, Len: 4},
+		{Name: "typsend", TypID: OidOid, Len: 4},
+		{Name: "typmodin", TypID: OidOid, Len: 4},
+		{Name: "typmodout", TypID: OidOid, Len: 4},
+		{Name: "typanalyze", TypID: OidOid, Len: 4},
+		{Name: "typalign", TypID: OidChar, Len: 1},
+		{Name: "typstorage", TypID: OidChar, Len: 1},
+		{Name: "typnotnull", TypID: OidBool, Len: 1},
+		{Name: "typbasetype", TypID: OidOid, Len: 4},
+		{Name: "typtypmod", TypID: OidInt4, Len: 4},
+	}
+
+	// PostgreSQL 14+ (typsubscript added after typrelid)
+	schemaPGTypeV14 = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "typname", TypID: OidName, Len: 64},
+		{Name: "typnamespace", TypID: OidOid, Len: 4},
+		{Name: "typowner", TypID: OidOid, Len: 4},
+		{Name: "typlen", TypID: OidInt2, Len: 2},
+		{Name: "typbyval", TypID: OidBool, Len: 1},
+		{Name: "typtype", TypID: OidChar, Len: 1},
+		{Name: "typcategory", TypID: OidChar, Len: 1},
+		{Name: "typispreferred", TypID: OidBool, Len: 1},
+		{Name: "typisdefined", TypID: OidBool, Len: 1},
+		{Name: "typdelim", TypID: OidChar, Len: 1},
+		{Name: "typrelid", TypID: OidOid, Len: 4},
+		{Name: "typsubscript", TypID: OidOid, Len: 4},
+		{Name: "typelem", TypID: OidOid, Len: 4},
+		{Name: "typarray", TypID: OidOid, Len: 4},
+		{Name: "typinput", TypID: OidOid, Len: 4},
+		{Name: "typoutput", TypID: OidOid, Len: 4},
+		{Name: "typreceive", TypID: OidOid, Len: 4},
+		{Name: "typsend", TypID: OidOid, Len: 4},
+		{Name: "typmodin", TypID: OidOid, Len: 4},
+		{Name: "typmodout", TypID: OidOid, Len: 4},
+		{Name: "typanalyze", TypID: OidOid, Len: 4},
+		{Name: "typalign", TypID: OidChar, Len: 1},
+		{Name: "typstorage", TypID: OidChar, Len: 1},
+		{Name: "typnotnull", TypID: OidBool, Len: 1},
+		{Name: "typbasetype", TypID: OidOid, Len: 4},
+		{Name: "typtypmod", TypID: OidInt4, Len: 4},
+	}
+
+	schemaPGEnum = []Column{
+		{Name: "oid", TypID: OidOid, Len: 4},
+		{Name: "enumtypid", TypID: OidOid, Len: 4},
+		{Name: "enumsortorder", TypID: OidFloat4, Len: 4},
+		{Name: "enumlabel", TypID: OidName, Len: 64},
+	}
+)
+
+// ParsePGType extracts type info from pg_type heap file, keyed by OID
+func ParsePGType(data []byte) map[uint32]TypeInfo {
+	types := make(map[uint32]TypeInfo)
+	for _, row := range ReadRows(data, detectTypeSchema(data), true) {
+		oid := getOID(row, "oid")
+		if oid == 0 {
+			continue
+		}
+		info := TypeInfo{
+			OID:       oid,
+			Name:      getString(row, "typname"),
+			Namespace: getOID(row, "typnamespace"),
+			Len:       toInt(row["typlen"]),
+			RelID:     getOID(row, "typrelid"),
+			Elem:      getOID(row, "typelem"),
+			BaseType:  getOID(row, "typbasetype"),
+			TypMod:    toInt(row["typtypmod"]),
+		}
+		if t := getString(row, "typtype"); t != "" {
+			info.Type = t[0]
+		}
+		types[oid] = info
+	}
+	return types
+}
+
+// detectTypeSchema picks the pg_type layout by checking where _int4 (1007)
+// keeps its element type
+func detectTypeSchema(data []byte) []Column {
+	for _, tuple := range ReadTuples(data, true) {
+		if d := tuple.Tuple.Data; len(d) >= 96 && u32(d, 0) == 1007 {
+			if u32(d, 92) == OidInt4 {
+				return schemaPGTypeV14
+			}
+			return schemaPGTypeV12
+		}
+	}
+	return schemaPGTypeV14
+}
+
+// ParsePGEnum extracts enum labels from pg_enum heap file, keyed by label OID
+func ParsePGEnum(data []byte) map[uint32]string {
+	labels := make(map[uint32]string)
+	for _, row := range ReadRows(data, schemaPGEnum, true) {
+		if oid := getOID(row, "oid"); oid > 0 {
+			labels[oid] = getString(row, "enumlabel")
+		}
+	}
+	return labels
+}
+
+// TypeCatalog resolves user-defined types of a database: enum values decode
+// to their label, domains to their base type, composite and record values to
+// a Record of their attributes.
+type TypeCatalog struct {
+	Types      map[uint32]TypeInfo
+	EnumLabels map[uint32]string     // enum value OID -> label
+	Attrs      map[uint32][]AttrInfo // composite typrelid -> attributes
+}
+
+// NewTypeCatalog builds a catalog from pg_type and pg_enum heap files and the
+// attributes already parsed from pg_attribute. Returns nil without pg_type.
+func NewTypeCatalog(typeData, enumData []byte, attrs map[uint32][]AttrInfo) *TypeCatalog {
+	if len(typeData) == 0 {
+		return nil
+	}
+	return &TypeCatalog{
+		Types:      ParsePGType(typeData),
+		EnumLabels: ParsePGEnum(enumData),
+		Attrs:      attrs,
+	}
+}
+
+// Name returns the type name for a column, resolving user-defined types.
+// User-defined arrays are shown as elem[].
+func (tc *TypeCatalog) Name(oid int) string {
+	if _, builtin := typeNames[oid]; builtin || tc == nil {
+		return TypeName(oid)
+	}
+	t, ok := tc.Types[uint32(oid)]
+	if !ok {
+		return TypeName(oid)
+	}
+	if t.Elem != 0 && t.Len == -1 {
+		return tc.Name(int(t.Elem)) + "[]"
+	}
+	return t.Name
+}
+
+// FormatType is FormatType with user-defined types resolved by name
+func (tc *TypeCatalog) FormatType(oid, typmod, ndims int) string {
+	elem, isArray := arrayElemTypes[oid]
+	if !isArray && tc != nil {
+		if t, ok := tc.Types[uint32(oid)]; ok && t.Elem != 0 && t.Len == -1 {
+			elem, isArray = int(t.Elem), true
+		}
+	}
+	if !isArray {
+		return withTypeModifier(tc.Name(oid), oid, typmod)
+	}
+	// attndims is informational and may be 0 (e.g. CREATE TABLE AS)
+	if ndims < 1 {
+		ndims = 1
+	}
+	return withTypeModifier(tc.Name(elem), elem, typmod) + strings.Repeat("[]", ndims)
+}
+
+// fixedLength returns typlen for fixed-length user-defined types
+func (tc *TypeCatalog) fixedLength(oid int) (int, bool) {
+	if tc == nil {
+		return 0, false
+	}
+	if t, ok := tc.Types[uint32(oid)]; ok && t.Len > 0 {
+		return t.Len, true
+	}
+	return 0, false
+}
+
+// decode decodes a user-defined type, reporting false if oid is not one.
+// Values inside it are decoded with d.
+func (tc *TypeCatalog) decode(data []byte, oid int, d *rowDecoder) (interface{}, bool) {
+	if oid == OidRecord {
+		return tc.decodeRecord(data, d)
+	}
+	t, ok := tc.Types[uint32(oid)]
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case t.Type == typTypeEnum:
+		if len(data) < 4 {
+			return nil, false
+		}
+		label, ok := tc.EnumLabels[u32(data, 0)]
+		if !ok {
+			return fmt.Sprintf("enum:%d", u32(data, 0)), true
+		}
+		return label, true
+	case t.Type == typTypeDomain && t.BaseType != 0:
+		return decodeType(data, int(t.BaseType), d), true
+	case t.Type == typTypeComposite:
+		return tc.decodeComposite(data, t.RelID, d)
+	case t.Elem != 0 && t.Len == -1:
+		return decodeArray(data, int(t.Elem), d), true
+	}
+	return nil, false
+}
+
+// Record is a decoded composite or record value: its attributes in order,
+// with their types to render them back as row literals. It marshals to JSON
+// as its Row does.
+type Record struct {
+	Row
+	types []int
+}
+
+// String renders the record as record_out does, (1,"a b",), which is also
+// the text a composite column takes in INSERT, COPY and CSV
+func (r Record) String() string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, v := range r.Values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if v == nil {
+			continue // NULL is an empty field
+		}
+		typID := 0
+		if i < len(r.types) {
+			typID = r.types[i]
+		}
+		sb.WriteString(recordFieldQuote(copyText(v, typID)))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// recordFieldQuote double-quotes a record field when record_in would
+// otherwise misread it: empty, or holding quotes, backslashes, parentheses,
+// commas or spaces. Quotes and backslashes inside are doubled.
+func recordFieldQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, "\\\"(), \t\n\r\v\f") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// decodeComposite decodes a composite datum. The varlena payload is a heap
+// tuple header without its length word (datum_len_ overlays t_xmin). The
+// attributes are decoded with d itself, so TOASTed ones are fetched as the
+// outer row's are.
+func (tc *TypeCatalog) decodeComposite(data []byte, relID uint32, d *rowDecoder) (interface{}, bool) {
+	attrs, ok := tc.Attrs[relID]
+	if !ok {
+		return nil, false
+	}
+	tuple := ParseHeapTuple(append(make([]byte, 4), data...))
+	if tuple == nil {
+		return nil, false
+	}
+	cols := attrColumns(attrs)
+	rec := Record{Row: d.decodeTuple(tuple, cols, nil), types: make([]int, len(cols))}
+	for i, c := range cols {
+		rec.types[i] = c.TypID
+	}
+	if rec.Values == nil {
+		rec.Row = Row{Columns: columnNames(cols), Values: make([]interface{}, len(cols))}
+	}
+	return rec, true
+}
+
+// decodeRecord decodes a record datum through the row type in datum_typeid.
+// Anonymous record types are only known to the backend that built them.
+func (tc *TypeCatalog) decodeRecord(data []byte, d *rowDecoder) (interface{}, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	t, ok := tc.Types[u32(data, 4)]
+	if !ok || t.Type != typTypeComposite {
+		return nil, false
+	}
+	return tc.decodeComposite(data, t.RelID, d)
+}
@@ -0,0 +1,158 @@
+package pgdump
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testTypeRow builds a pg_type tuple in the PG14+ layout
+func testTypeRow(oid uint32, name string, typLen int16, typType byte, relid, elem, base uint32) []byte {
+	row := make([]byte, 140)
+	putU32(row, 0, oid)
+	copy(row[4:], testName(name))
+	putU32(row, 68, 2200)
+	putU16(row, 76, uint16(typLen))
+	row[79] = typType
+	putU32(row, 84, relid)
+	putU32(row, 92, elem)
+	row[128] = 'i'
+	putU32(row, 132, base)
+	putU32(row, 136, 0xFFFFFFFF)
+	return testHeapTuple(27, row)
+}
+
+func testEnumRow(oid, typid uint32, order float32, label string) []byte {
+	row := make([]byte, 76)
+	putU32(row, 0, oid)
+	putU32(row, 4, typid)
+	putU32(row, 8, math.Float32bits(order))
+	copy(row[12:], testName(label))
+	return testHeapTuple(4, row)
+}
+
+func testTypeCatalog() *TypeCatalog {
+	typeData := testHeapPage(
+		testTypeRow(1007, "_int4", -1, 'b', 0, OidInt4, 0),
+		testTypeRow(16400, "mood", 4, 'e', 0, 0, 0),
+		testTypeRow(16401, "_mood", -1, 'b', 0, 16400, 0),
+		testTypeRow(16402, "email", -1, 'd', 0, 0, OidText),
+		testTypeRow(16403, "address", -1, 'c', 16500, 0, 0),
+	)
+	enumData := testHeapPage(
+		testEnumRow(16410, 16400, 1, "sad"),
+		testEnumRow(16411, 16400, 2, "happy"),
+	)
+	attrs := map[uint32][]AttrInfo{
+		16500: {
+			{Name: "city", TypID: OidText, Num: 1, Len: -1, Align: 'i'},
+			{Name: "zip", TypID: OidInt4, Num: 2, Len: 4, Align: 'i'},
+			{Name: "mood", TypID: 16400, Num: 3, Len: 4, Align: 'i'},
+		},
+	}
+	return NewTypeCatalog(typeData, enumData, attrs)
+}
+
+func TestParsePGType(t *testing.T) {
+	types := ParsePGType(testHeapPage(
+		testTypeRow(1007, "_int4", -1, 'b', 0, OidInt4, 0),
+		testTypeRow(16402, "email", -1, 'd', 0, 0, OidText),
+	))
+	if email := types[16402]; email.Type != 'd' || email.BaseType != OidText || email.Len != -1 {
+		t.Errorf("unexpected domain: %+v", email)
+	}
+
+	// PG12-13: no typsubscript, so typelem sits 4 bytes earlier
+	v12 := make([]byte, 136)
+	putU32(v12, 0, 1007)
+	copy(v12[4:], testName("_int4"))
+	putU16(v12, 76, 0xFFFF)
+	v12[79] = 'b'
+	putU32(v12, 88, OidInt4)
+	types = ParsePGType(testHeapPage(testHeapTuple(26, v12)))
+	if arr := types[1007]; arr.Elem != OidInt4 || arr.Len != -1 {
+		t.Errorf("PG12 layout not detected: %+v", arr)
+	}
+}
+
+func TestTypeCatalogDecode(t *testing.T) {
+	tc := testTypeCatalog()
+
+	enum := make([]byte, 4)
+	putU32(enum, 0, 16411)
+	if got := decodeType(enum, 16400, &rowDecoder{types: tc}); got != "happy" {
+		t.Errorf("enum = %v, want happy", got)
+	}
+
+	if got := decodeType([]byte("a@b.c"), 16402, &rowDecoder{types: tc}); got != "a@b.c" {
+		t.Errorf("domain = %v, want a@b.c", got)
+	}
+
+	// 1-D array of two enum values
+	arr := make([]byte, 28)
+	putU32(arr, 0, 1)
+	putU32(arr, 8, 16400)
+	putU32(arr, 12, 2)
+	putU32(arr, 16, 1)
+	putU32(arr, 20, 16410)
+	putU32(arr, 24, 16411)
+	if got, ok := decodeType(arr, 16401, &rowDecoder{types: tc}).([]interface{}); !ok || len(got) != 2 || got[0] != "sad" || got[1] != "happy" {
+		t.Errorf("enum array = %v", got)
+	}
+
+	// Composite: heap tuple header without its length word, then the fields
+	fields := append([]byte{0x0D}, "Paris"...)
+	fields = append(fields, 0, 0)
+	fields = append(fields, 0x20, 0x4E, 0, 0, 0x1B, 0x40, 0, 0)
+	datum := testHeapTuple(3, fields)[4:]
+	putU32(datum, 4, 16403) // datum_typeid
+	want := Record{Row: testRow("city", "Paris", "zip", int32(20000), "mood", "happy"), types: []int{OidText, OidInt4, 16400}}
+	for _, oid := range []int{16403, OidRecord} {
+		if got := decodeType(datum, oid, &rowDecoder{types: tc}); !reflect.DeepEqual(got, want) {
+			t.Errorf("composite %d = %#v, want %#v", oid, got, want)
+		}
+	}
+
+	// Rendered as a row literal wherever PostgreSQL reads it back
+	if got := formatSQLValue(want, 16403); got != "'(Paris,20000,happy)'" {
+		t.Errorf("SQL composite = %s", got)
+	}
+	quoted := Record{Row: testRow("city", "Le Mans", "zip", nil, "mood", `a"b\c`), types: []int{OidText, OidInt4, 16400}}
+	if got := copyText(quoted, 16403); got != `("Le Mans",,"a""b\\c")` {
+		t.Errorf("COPY composite = %s", got)
+	}
+
+	// An attribute TOASTed out of line is fetched through the outer decoder
+	toasted := []byte{0x01, 0x12, 9, 0, 0, 0, 5, 0, 0, 0x80, 7, 0, 0, 0, 0xD8, 0x40, 0, 0, 0, 0}
+	toasted = append(toasted, 0x20, 0x4E, 0, 0, 0x1B, 0x40, 0, 0)
+	datum = testHeapTuple(3, toasted)[4:]
+	toast := NewTOASTReader()
+	toast.chunks[16600] = []TOASTChunk{{ChunkID: 7, Data: []byte("Lyon!")}}
+	got, _ := decodeType(datum, 16403, &rowDecoder{types: tc, toast: toast}).(Record)
+	if city, _ := got.Get("city"); city != "Lyon!" {
+		t.Errorf("TOASTed composite attribute = %v", city)
+	}
+
+	if got := decodeType(enum, 16400, nil); got == "happy" {
+		t.Error("enum decoded without a catalog")
+	}
+}
+
+func TestTypeCatalogName(t *testing.T) {
+	tc := testTypeCatalog()
+	tests := map[int]string{
+		OidInt4: "int4",
+		16400:   "mood",
+		16401:   "mood[]",
+		16403:   "address",
+		99999:   "oid:99999",
+	}
+	for oid, want := range tests {
+		if got := tc.Name(oid); got != want {
+			t.Errorf("Name(%d) = %q, want %q", oid, got, want)
+		}
+	}
+	if got := (*TypeCatalog)(nil).Name(16400); got != "oid:16400" {
+		t.Errorf("nil catalog Name = %q", got)
+	}
+}